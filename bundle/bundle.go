@@ -0,0 +1,107 @@
+// Package bundle carries releases across an air gap. Export packages a
+// release's metadata and files into a single tarball with a signed
+// manifest of checksums, and Import verifies such a tarball and unpacks it
+// into a mirror directory or an offline catalog.
+//
+// A bundle holds, in order, the release's files under files/,
+// metadata.json, manifest.json and manifest.json.sig, the base64 encoded
+// ed25519 signature of the manifest.
+package bundle
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+const (
+	MetadataPath  = "metadata.json"
+	ManifestPath  = "manifest.json"
+	SignaturePath = "manifest.json.sig"
+
+	filesDirectory  = "files/"
+	manifestVersion = 1
+)
+
+// Contents is the metadata of a bundled release.
+type Contents struct {
+	ProductSlug  string                      `json:"product_slug"`
+	Release      pivnet.Release              `json:"release"`
+	Files        []File                      `json:"files"`
+	FileGroups   []pivnet.FileGroup          `json:"file_groups"`
+	Dependencies []pivnet.ReleaseDependency  `json:"dependencies"`
+	UpgradePaths []pivnet.ReleaseUpgradePath `json:"upgrade_paths"`
+
+	// EULA, with its text, is set if the release has one.
+	EULA *pivnet.EULA `json:"eula,omitempty"`
+}
+
+// File is a product file included in a bundle under files/Name.
+type File struct {
+	Name        string             `json:"name"`
+	FileGroup   string             `json:"file_group,omitempty"`
+	ProductFile pivnet.ProductFile `json:"product_file"`
+}
+
+// Manifest lists every other entry of a bundle with its checksum.
+type Manifest struct {
+	Version        int             `json:"version"`
+	ProductSlug    string          `json:"product_slug"`
+	ReleaseVersion string          `json:"release_version"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Entries        []ManifestEntry `json:"entries"`
+}
+
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// ErrInvalidSignature is returned when a bundle's manifest is not signed
+// by any trusted key.
+type ErrInvalidSignature struct{}
+
+func (e ErrInvalidSignature) Error() string {
+	return "bundle manifest is not signed by a trusted key"
+}
+
+func signManifest(b []byte, key ed25519.PrivateKey) []byte {
+	signature := ed25519.Sign(key, b)
+	return []byte(base64.StdEncoding.EncodeToString(signature) + "\n")
+}
+
+func verifyManifest(b []byte, encodedSignature []byte, trustedKeys []ed25519.PublicKey) (Manifest, error) {
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encodedSignature)))
+	if err != nil {
+		return Manifest{}, ErrInvalidSignature{}
+	}
+
+	trusted := false
+	for _, key := range trustedKeys {
+		if len(key) == ed25519.PublicKeySize && ed25519.Verify(key, b, signature) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return Manifest{}, ErrInvalidSignature{}
+	}
+
+	var manifest Manifest
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("invalid bundle manifest: %s", err)
+	}
+
+	if manifest.Version != manifestVersion {
+		return Manifest{}, fmt.Errorf("unsupported bundle manifest version %d", manifest.Version)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,466 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type ExportConfig struct {
+	ProductSlug string
+	ReleaseID   int
+
+	// Globs and Selector limit the files included in the bundle, as in
+	// pivnet.DownloadPlanConfig. When both are empty every file of the
+	// release and its file groups is included.
+	Globs    []string
+	Selector *pivnet.ProductFileSelector
+
+	// Output is the path of the bundle.
+	Output string
+
+	// SigningKey signs the bundle's manifest.
+	SigningKey ed25519.PrivateKey
+
+	// WorkDirectory holds the downloaded files until the bundle is
+	// complete. Defaults to Output with a .work suffix.
+	WorkDirectory string
+
+	// Concurrency and Progress configure the downloads, as in
+	// pivnet.DownloadManager.
+	Concurrency int
+	Progress    pivnet.ProgressReporter
+}
+
+// Export writes a bundle of a release.
+//
+// Exports are resumable: files already downloaded to the work directory
+// are not downloaded again, and entries already written to the unfinished
+// bundle, Output with a .partial suffix, are kept as long as they are
+// unchanged. Running Export again with the same configuration after a
+// failure continues where it stopped.
+func Export(ctx context.Context, client pivnet.Client, config ExportConfig) (Manifest, error) {
+	if config.Output == "" {
+		return Manifest{}, fmt.Errorf("bundle output must be set")
+	}
+	if len(config.SigningKey) != ed25519.PrivateKeySize {
+		return Manifest{}, fmt.Errorf("bundle signing key must be an ed25519 private key")
+	}
+
+	workDir := config.WorkDirectory
+	if workDir == "" {
+		workDir = config.Output + ".work"
+	}
+	filesDir := filepath.Join(workDir, "files")
+
+	err := os.MkdirAll(filesDir, 0755)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manager := pivnet.NewDownloadManager(client)
+	manager.Concurrency = config.Concurrency
+	manager.Progress = config.Progress
+
+	plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+		ProductSlug: config.ProductSlug,
+		ReleaseID:   config.ReleaseID,
+		Globs:       config.Globs,
+		Selector:    config.Selector,
+		Directory:   filesDir,
+	})
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	report := manager.Download(ctx, plan)
+	err = report.Err()
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	contents, err := fetchContents(client, config.ProductSlug, config.ReleaseID)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	for _, result := range report.Results {
+		contents.Files = append(contents.Files, File{
+			Name:        filepath.Base(result.Path),
+			FileGroup:   result.FileGroup,
+			ProductFile: result.ProductFile,
+		})
+	}
+
+	metadata, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	// Files come first so that an export resumed after the release's
+	// metadata changed only rewrites the metadata.
+	var entries []entry
+	for _, result := range report.Results {
+		e, err := newFileEntry(filesDirectory+filepath.Base(result.Path), result.Path, result.ProductFile.SHA256)
+		if err != nil {
+			return Manifest{}, err
+		}
+		entries = append(entries, e)
+	}
+	entries = append(entries, newDataEntry(MetadataPath, metadata))
+
+	manifest := Manifest{
+		Version:        manifestVersion,
+		ProductSlug:    config.ProductSlug,
+		ReleaseVersion: contents.Release.Version,
+		CreatedAt:      time.Now().UTC(),
+	}
+	for _, e := range entries {
+		manifest.Entries = append(manifest.Entries, e.ManifestEntry)
+	}
+
+	err = writeBundle(ctx, config.Output, entries, manifest, config.SigningKey)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	err = os.RemoveAll(workDir)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return manifest, nil
+}
+
+func fetchContents(client pivnet.Client, productSlug string, releaseID int) (Contents, error) {
+	contents := Contents{ProductSlug: productSlug}
+
+	var err error
+	contents.Release, err = client.Releases.Get(productSlug, releaseID)
+	if err != nil {
+		return Contents{}, err
+	}
+
+	contents.FileGroups, err = client.FileGroups.ListForRelease(productSlug, releaseID)
+	if err != nil {
+		return Contents{}, err
+	}
+
+	contents.Dependencies, err = client.ReleaseDependencies.List(productSlug, releaseID)
+	if err != nil {
+		return Contents{}, err
+	}
+
+	contents.UpgradePaths, err = client.ReleaseUpgradePaths.Get(productSlug, releaseID)
+	if err != nil {
+		return Contents{}, err
+	}
+
+	if contents.Release.EULA != nil && contents.Release.EULA.Slug != "" {
+		eula, err := client.EULA.Get(contents.Release.EULA.Slug)
+		if err != nil {
+			return Contents{}, err
+		}
+		contents.EULA = &eula
+	}
+
+	return contents, nil
+}
+
+// entry is a bundle entry read from memory or from a file.
+type entry struct {
+	ManifestEntry
+	data []byte
+	path string
+}
+
+func newDataEntry(name string, data []byte) entry {
+	sum := sha256.Sum256(data)
+
+	return entry{
+		ManifestEntry: ManifestEntry{
+			Path:   name,
+			Size:   int64(len(data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		},
+		data: data,
+	}
+}
+
+// newFileEntry describes the file at path. The checksum is computed unless
+// known.
+func newFileEntry(name string, path string, sha256sum string) (entry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return entry{}, err
+	}
+
+	if sha256sum == "" {
+		sha256sum, err = hashFile(path)
+		if err != nil {
+			return entry{}, err
+		}
+	}
+
+	return entry{
+		ManifestEntry: ManifestEntry{
+			Path:   name,
+			Size:   info.Size(),
+			SHA256: strings.ToLower(sha256sum),
+		},
+		path: path,
+	}, nil
+}
+
+func (e entry) open() (io.ReadCloser, error) {
+	if e.path == "" {
+		return ioutil.NopCloser(bytes.NewReader(e.data)), nil
+	}
+
+	return os.Open(e.path)
+}
+
+// journal records the entries completely written to an unfinished bundle
+// and where each of them ends.
+type journal struct {
+	Entries []journalEntry `json:"entries"`
+}
+
+type journalEntry struct {
+	ManifestEntry
+	End int64 `json:"end"`
+}
+
+// writeBundle writes entries, the manifest and its signature to output,
+// resuming an unfinished bundle if its journal shows it started with the
+// same entries.
+func writeBundle(ctx context.Context, output string, entries []entry, manifest Manifest, key ed25519.PrivateKey) error {
+	partialPath := output + ".partial"
+	journalPath := output + ".partial.json"
+
+	f, err := os.OpenFile(partialPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %s", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	j := resumableEntries(readJournal(journalPath), entries, info.Size())
+
+	var offset int64
+	if len(j.Entries) > 0 {
+		offset = j.Entries[len(j.Entries)-1].End
+	}
+
+	err = f.Truncate(offset)
+	if err != nil {
+		return err
+	}
+
+	err = writeJournal(journalPath, j)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	cw := &countingWriter{w: f, n: offset}
+	tw := tar.NewWriter(cw)
+
+	for _, e := range entries[len(j.Entries):] {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		err = writeEntry(tw, e)
+		if err != nil {
+			return err
+		}
+
+		err = tw.Flush()
+		if err != nil {
+			return err
+		}
+
+		err = f.Sync()
+		if err != nil {
+			return err
+		}
+
+		j.Entries = append(j.Entries, journalEntry{ManifestEntry: e.ManifestEntry, End: cw.n})
+
+		err = writeJournal(journalPath, j)
+		if err != nil {
+			return err
+		}
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for _, e := range []entry{
+		newDataEntry(ManifestPath, manifestBytes),
+		newDataEntry(SignaturePath, signManifest(manifestBytes, key)),
+	} {
+		err = writeEntry(tw, e)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(partialPath, output)
+	if err != nil {
+		return fmt.Errorf("failed to move bundle into place: %s", err)
+	}
+
+	os.Remove(journalPath)
+
+	return nil
+}
+
+// resumableEntries returns the journaled entries that match the start of
+// entries and lie within the unfinished bundle's size.
+func resumableEntries(j journal, entries []entry, size int64) journal {
+	var resumable journal
+
+	for i, je := range j.Entries {
+		if i >= len(entries) || je.ManifestEntry != entries[i].ManifestEntry || je.End > size {
+			break
+		}
+
+		resumable.Entries = append(resumable.Entries, je)
+	}
+
+	return resumable
+}
+
+// writeEntry copies an entry into the bundle, checking that its contents
+// still match its checksum.
+func writeEntry(tw *tar.Writer, e entry) error {
+	r, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:     e.Path,
+		Mode:     0644,
+		Size:     e.Size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tw, h), r)
+	if err != nil {
+		return fmt.Errorf("failed to write %s to bundle: %s", e.Path, err)
+	}
+
+	actual := hex.EncodeToString(h.Sum(nil))
+	if actual != e.SHA256 {
+		return fmt.Errorf("%s changed while writing bundle: sha256 is %s, expected %s", e.Path, actual, e.SHA256)
+	}
+
+	return nil
+}
+
+// readJournal returns the journal at path, or an empty journal if there is
+// none or it cannot be read.
+func readJournal(path string) journal {
+	var j journal
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return journal{}
+	}
+
+	err = json.Unmarshal(b, &j)
+	if err != nil {
+		return journal{}
+	}
+
+	return j
+}
+
+func writeJournal(path string, j journal) error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write bundle journal: %s", err)
+	}
+
+	return os.Rename(tmp, path)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,214 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/bundle"
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Export", func() {
+	var (
+		server     *pivnettest.Server
+		client     pivnet.Client
+		dir        string
+		publicKey  ed25519.PublicKey
+		privateKey ed25519.PrivateKey
+		config     bundle.ExportConfig
+
+		release  pivnet.Release
+		tile     pivnet.ProductFile
+		stemcell pivnet.ProductFile
+	)
+
+	entryNames := func(path string) []string {
+		f, err := os.Open(path)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		var names []string
+		tr := tar.NewReader(f)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+			names = append(names, header.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		server.AddEULA(pivnet.EULA{Slug: "banana-eula", Name: "Banana EULA", Content: "Peel before eating."})
+
+		release = server.AddRelease("banana", pivnet.Release{
+			Version: "1.2.3",
+			EULA:    &pivnet.EULA{Slug: "banana-eula"},
+		})
+		tile = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/banana-1.2.3.pivotal",
+		}, []byte("tile"))
+		stemcell = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/stemcell.tgz",
+		}, []byte("stemcell"))
+		server.AddFileGroup("banana", release.ID, "Stemcells", stemcell.ID)
+		server.AddDependency("banana", release.ID, pivnet.DependentRelease{
+			ID:      100,
+			Version: "2.0.0",
+			Product: pivnet.Product{Slug: "apple"},
+		})
+		server.AddUpgradePath("banana", release.ID, pivnet.UpgradePathRelease{ID: 99, Version: "1.2.2"})
+
+		var err error
+		dir, err = ioutil.TempDir("", "bundle")
+		Expect(err).NotTo(HaveOccurred())
+
+		publicKey, privateKey, err = ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		config = bundle.ExportConfig{
+			ProductSlug: "banana",
+			ReleaseID:   release.ID,
+			Output:      filepath.Join(dir, "banana-1.2.3.tar"),
+			SigningKey:  privateKey,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("writes the release's files, metadata and a signed manifest", func() {
+		manifest, err := bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(entryNames(config.Output)).To(Equal([]string{
+			"files/banana-1.2.3.pivotal",
+			"files/stemcell.tgz",
+			bundle.MetadataPath,
+			bundle.ManifestPath,
+			bundle.SignaturePath,
+		}))
+
+		Expect(manifest.ProductSlug).To(Equal("banana"))
+		Expect(manifest.ReleaseVersion).To(Equal("1.2.3"))
+		Expect(manifest.Entries[0]).To(Equal(bundle.ManifestEntry{
+			Path:   "files/banana-1.2.3.pivotal",
+			Size:   4,
+			SHA256: tile.SHA256,
+		}))
+
+		verified, contents, err := bundle.Verify(config.Output, []ed25519.PublicKey{publicKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(verified.Entries).To(Equal(manifest.Entries))
+
+		Expect(contents.Release.ID).To(Equal(release.ID))
+		Expect(contents.Files).To(HaveLen(2))
+		Expect(contents.Files[1].Name).To(Equal("stemcell.tgz"))
+		Expect(contents.Files[1].FileGroup).To(Equal("Stemcells"))
+		Expect(contents.FileGroups[0].Name).To(Equal("Stemcells"))
+		Expect(contents.Dependencies[0].Release.Product.Slug).To(Equal("apple"))
+		Expect(contents.UpgradePaths[0].Release.Version).To(Equal("1.2.2"))
+		Expect(contents.EULA.Content).To(Equal("Peel before eating."))
+	})
+
+	It("removes its work directory and unfinished bundle", func() {
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		entries, err := ioutil.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Name()).To(Equal("banana-1.2.3.tar"))
+	})
+
+	It("limits the files with globs", func() {
+		config.Globs = []string{"*.pivotal"}
+
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(entryNames(config.Output)).To(ContainElement("files/banana-1.2.3.pivotal"))
+		Expect(entryNames(config.Output)).NotTo(ContainElement("files/stemcell.tgz"))
+	})
+
+	It("resumes downloads after a failure", func() {
+		broken := server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/broken.zip",
+			SHA256:       "not-the-right-sha",
+		}, []byte("broken"))
+
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).To(MatchError(ContainSubstring("1 of 3 downloads failed")))
+
+		_, err = os.Stat(config.Output)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		server.SetContents(broken.ID, []byte("fixed"))
+
+		_, err = bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(server.Downloads(tile.ID)).To(Equal(1))
+		Expect(server.Downloads(broken.ID)).To(Equal(2))
+	})
+
+	It("restarts an unfinished bundle that does not match", func() {
+		Expect(ioutil.WriteFile(config.Output+".partial", []byte("garbage"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(config.Output+".partial.json", []byte(`{"entries":[{"path":"files/other","end":7}]}`), 0644)).To(Succeed())
+
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = bundle.Verify(config.Output, []ed25519.PublicKey{publicKey})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports progress for each file", func() {
+		var finished []string
+		config.Progress = progressReporterFunc(func(name string) download.ProgressListener {
+			return download.ProgressListenerFunc(func(e download.Event) {
+				if e.Type == download.EventFinished {
+					finished = append(finished, name)
+				}
+			})
+		})
+		config.Concurrency = 1
+
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(finished).To(ConsistOf("banana-1.2.3.pivotal", "stemcell.tgz"))
+	})
+
+	It("returns an error for an invalid configuration", func() {
+		config.SigningKey = nil
+		_, err := bundle.Export(context.Background(), client, config)
+		Expect(err).To(MatchError("bundle signing key must be an ed25519 private key"))
+
+		_, err = bundle.Export(context.Background(), client, bundle.ExportConfig{SigningKey: privateKey})
+		Expect(err).To(MatchError("bundle output must be set"))
+	})
+})
+
+type progressReporterFunc func(name string) download.ProgressListener
+
+func (f progressReporterFunc) Listener(name string) download.ProgressListener {
+	return f(name)
+}
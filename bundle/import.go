@@ -0,0 +1,354 @@
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/mirror"
+)
+
+// maxMetadataSize bounds the entries of a bundle that are read into memory.
+const maxMetadataSize = 64 << 20
+
+type ImportConfig struct {
+	// Bundle is the path of the bundle to import.
+	Bundle string
+
+	// TrustedKeys are the keys a bundle's manifest may be signed with.
+	TrustedKeys []ed25519.PublicKey
+
+	// MirrorDirectory, if set, receives the release's files and metadata,
+	// laid out as by the mirror package.
+	MirrorDirectory string
+
+	// CatalogDirectory, if set, receives the release's metadata as
+	// <product slug>/<version>.json, readable with ReadCatalog.
+	CatalogDirectory string
+}
+
+type ImportResult struct {
+	Manifest Manifest
+	Contents Contents
+
+	// MirrorPath and CatalogPath are where the release was imported to.
+	MirrorPath  string
+	CatalogPath string
+}
+
+// Import verifies a bundle and unpacks it. Nothing is written to the
+// mirror or catalog unless the manifest is signed by a trusted key and
+// every entry matches it.
+func Import(config ImportConfig) (ImportResult, error) {
+	if config.MirrorDirectory == "" && config.CatalogDirectory == "" {
+		return ImportResult{}, fmt.Errorf("a mirror or catalog directory must be set")
+	}
+	if len(config.TrustedKeys) == 0 {
+		return ImportResult{}, fmt.Errorf("at least one trusted key must be set")
+	}
+
+	var staging string
+	if config.MirrorDirectory != "" {
+		err := os.MkdirAll(config.MirrorDirectory, 0755)
+		if err != nil {
+			return ImportResult{}, err
+		}
+
+		staging, err = ioutil.TempDir(config.MirrorDirectory, ".bundle-import-")
+		if err != nil {
+			return ImportResult{}, err
+		}
+		defer os.RemoveAll(staging)
+	}
+
+	manifest, contents, err := read(config.Bundle, config.TrustedKeys, staging)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	result := ImportResult{Manifest: manifest, Contents: contents}
+
+	if config.MirrorDirectory != "" {
+		result.MirrorPath, err = importToMirror(config.MirrorDirectory, staging, contents)
+		if err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	if config.CatalogDirectory != "" {
+		result.CatalogPath, err = importToCatalog(config.CatalogDirectory, contents)
+		if err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	return result, nil
+}
+
+// Verify checks a bundle's signature and checksums without unpacking it.
+func Verify(bundle string, trustedKeys []ed25519.PublicKey) (Manifest, Contents, error) {
+	return read(bundle, trustedKeys, "")
+}
+
+// read verifies a bundle, extracting its files to staging unless it is
+// empty.
+func read(bundle string, trustedKeys []ed25519.PublicKey, staging string) (Manifest, Contents, error) {
+	f, err := os.Open(bundle)
+	if err != nil {
+		return Manifest{}, Contents{}, err
+	}
+	defer f.Close()
+
+	var manifestBytes, signature, metadata []byte
+	seen := map[string]ManifestEntry{}
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: %s", err)
+		}
+
+		name := header.Name
+		if header.Typeflag != tar.TypeReg {
+			return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: %s is not a regular file", name)
+		}
+		if _, ok := seen[name]; ok || (name == ManifestPath && manifestBytes != nil) || (name == SignaturePath && signature != nil) {
+			return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: %s appears more than once", name)
+		}
+
+		switch {
+		case name == ManifestPath:
+			manifestBytes, err = readAll(tr, name)
+		case name == SignaturePath:
+			signature, err = readAll(tr, name)
+		case name == MetadataPath:
+			metadata, err = readAll(tr, name)
+			seen[name] = checksum(name, metadata)
+		case isFileEntry(name):
+			seen[name], err = extract(tr, name, staging)
+		default:
+			err = fmt.Errorf("invalid bundle: unexpected entry %s", name)
+		}
+		if err != nil {
+			return Manifest{}, Contents{}, err
+		}
+	}
+
+	if manifestBytes == nil || signature == nil {
+		return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: missing %s or %s", ManifestPath, SignaturePath)
+	}
+
+	manifest, err := verifyManifest(manifestBytes, signature, trustedKeys)
+	if err != nil {
+		return Manifest{}, Contents{}, err
+	}
+
+	for _, expected := range manifest.Entries {
+		actual, ok := seen[expected.Path]
+		if !ok {
+			return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: missing %s", expected.Path)
+		}
+		if actual != expected {
+			return Manifest{}, Contents{}, fmt.Errorf(
+				"invalid bundle: %s has size %d and sha256 %s, expected size %d and sha256 %s",
+				expected.Path,
+				actual.Size,
+				actual.SHA256,
+				expected.Size,
+				expected.SHA256,
+			)
+		}
+		delete(seen, expected.Path)
+	}
+
+	for name := range seen {
+		return Manifest{}, Contents{}, fmt.Errorf("invalid bundle: %s is not in the manifest", name)
+	}
+
+	var contents Contents
+	err = json.Unmarshal(metadata, &contents)
+	if err != nil {
+		return Manifest{}, Contents{}, fmt.Errorf("invalid bundle metadata: %s", err)
+	}
+
+	if !isBaseName(contents.ProductSlug) || contents.ProductSlug != manifest.ProductSlug {
+		return Manifest{}, Contents{}, fmt.Errorf("invalid bundle metadata: bad product slug %q", contents.ProductSlug)
+	}
+
+	return manifest, contents, nil
+}
+
+func isFileEntry(name string) bool {
+	return strings.HasPrefix(name, filesDirectory) && isBaseName(strings.TrimPrefix(name, filesDirectory))
+}
+
+// isBaseName reports whether name can be used as a single path element.
+func isBaseName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func readAll(r io.Reader, name string) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, maxMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle: %s", err)
+	}
+	if len(b) > maxMetadataSize {
+		return nil, fmt.Errorf("invalid bundle: %s is too large", name)
+	}
+
+	return b, nil
+}
+
+func checksum(name string, b []byte) ManifestEntry {
+	sum := sha256.Sum256(b)
+	return ManifestEntry{Path: name, Size: int64(len(b)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// extract hashes an entry while copying it into staging. With no staging
+// directory the entry is only hashed.
+func extract(r io.Reader, name string, staging string) (ManifestEntry, error) {
+	w := ioutil.Discard
+
+	if staging != "" {
+		target := filepath.Join(staging, filepath.FromSlash(name))
+
+		err := os.MkdirAll(filepath.Dir(target), 0755)
+		if err != nil {
+			return ManifestEntry{}, err
+		}
+
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			return ManifestEntry{}, err
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), r)
+	if err != nil {
+		return ManifestEntry{}, fmt.Errorf("failed to extract %s: %s", name, err)
+	}
+
+	return ManifestEntry{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func importToMirror(root string, staging string, contents Contents) (string, error) {
+	dir := mirror.ReleaseDirectory(root, contents.ProductSlug, contents.Release)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	metadata := mirror.Metadata{
+		ProductSlug: contents.ProductSlug,
+		Release:     contents.Release,
+		SyncedAt:    time.Now().UTC(),
+	}
+
+	for _, file := range contents.Files {
+		if !isBaseName(file.Name) {
+			return "", fmt.Errorf("invalid bundle metadata: bad file name %q", file.Name)
+		}
+
+		err = os.Rename(filepath.Join(staging, "files", file.Name), filepath.Join(dir, file.Name))
+		if err != nil {
+			return "", fmt.Errorf("failed to move %s into the mirror: %s", file.Name, err)
+		}
+
+		metadata.Files = append(metadata.Files, mirror.FileMetadata{
+			ID:        file.ProductFile.ID,
+			Name:      file.Name,
+			FileType:  file.ProductFile.FileType,
+			FileGroup: file.FileGroup,
+			Size:      file.ProductFile.Size,
+			SHA256:    file.ProductFile.SHA256,
+			MD5:       file.ProductFile.MD5,
+		})
+	}
+
+	err = mirror.WriteMetadata(dir, metadata)
+	if err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+func importToCatalog(root string, contents Contents) (string, error) {
+	target := mirror.ReleaseDirectory(root, contents.ProductSlug, contents.Release) + ".json"
+
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	b, err := json.MarshalIndent(contents, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	tmp := target + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp, target)
+	if err != nil {
+		return "", err
+	}
+
+	return target, nil
+}
+
+// ReadCatalog returns the releases imported into a catalog directory,
+// ordered by product slug and then by version.
+func ReadCatalog(root string) ([]Contents, error) {
+	paths, err := filepath.Glob(filepath.Join(root, "*", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var catalog []Contents
+	for _, p := range paths {
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+
+		var contents Contents
+		err = json.Unmarshal(b, &contents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid catalog entry %s: %s", p, err)
+		}
+
+		catalog = append(catalog, contents)
+	}
+
+	sort.SliceStable(catalog, func(i, j int) bool {
+		if catalog[i].ProductSlug != catalog[j].ProductSlug {
+			return catalog[i].ProductSlug < catalog[j].ProductSlug
+		}
+		return mirror.CompareVersions(catalog[i].Release.Version, catalog[j].Release.Version) < 0
+	})
+
+	return catalog, nil
+}
@@ -0,0 +1,235 @@
+package bundle_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/bundle"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/mirror"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Import", func() {
+	var (
+		dir        string
+		bundlePath string
+		publicKey  ed25519.PublicKey
+		config     bundle.ImportConfig
+
+		release pivnet.Release
+		tile    pivnet.ProductFile
+	)
+
+	// rewrite copies the bundle, passing each entry's contents through
+	// change, which may return nil to drop the entry.
+	rewrite := func(change func(name string, contents []byte) []byte) {
+		in, err := ioutil.ReadFile(bundlePath)
+		Expect(err).NotTo(HaveOccurred())
+
+		out := &bytes.Buffer{}
+		tw := tar.NewWriter(out)
+
+		tr := tar.NewReader(bytes.NewReader(in))
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents = change(header.Name, contents)
+			if contents == nil {
+				continue
+			}
+
+			header.Size = int64(len(contents))
+			Expect(tw.WriteHeader(header)).To(Succeed())
+			_, err = tw.Write(contents)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		Expect(ioutil.WriteFile(bundlePath, out.Bytes(), 0644)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		server := pivnettest.NewServer()
+		defer server.Close()
+
+		release = server.AddRelease("banana", pivnet.Release{Version: "1.2.3"})
+		tile = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/banana-1.2.3.pivotal",
+			FileType:     pivnet.FileTypeSoftware,
+		}, []byte("tile"))
+
+		var err error
+		dir, err = ioutil.TempDir("", "bundle-import")
+		Expect(err).NotTo(HaveOccurred())
+
+		var privateKey ed25519.PrivateKey
+		publicKey, privateKey, err = ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		bundlePath = filepath.Join(dir, "banana.tar")
+		client := pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+		_, err = bundle.Export(context.Background(), client, bundle.ExportConfig{
+			ProductSlug: "banana",
+			ReleaseID:   release.ID,
+			Output:      bundlePath,
+			SigningKey:  privateKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		config = bundle.ImportConfig{
+			Bundle:           bundlePath,
+			TrustedKeys:      []ed25519.PublicKey{publicKey},
+			MirrorDirectory:  filepath.Join(dir, "mirror"),
+			CatalogDirectory: filepath.Join(dir, "catalog"),
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("populates a mirror directory", func() {
+		result, err := bundle.Import(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.MirrorPath).To(Equal(filepath.Join(dir, "mirror", "banana", "1.2.3")))
+
+		contents, err := ioutil.ReadFile(filepath.Join(result.MirrorPath, "banana-1.2.3.pivotal"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("tile"))
+
+		metadata, err := mirror.ReadMetadata(result.MirrorPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(metadata.Release.ID).To(Equal(release.ID))
+		Expect(metadata.Files).To(Equal([]mirror.FileMetadata{{
+			ID:       tile.ID,
+			Name:     "banana-1.2.3.pivotal",
+			FileType: pivnet.FileTypeSoftware,
+			Size:     4,
+			SHA256:   tile.SHA256,
+			MD5:      tile.MD5,
+		}}))
+
+		entries, err := ioutil.ReadDir(filepath.Join(dir, "mirror"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("populates an offline catalog", func() {
+		result, err := bundle.Import(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.CatalogPath).To(Equal(filepath.Join(dir, "catalog", "banana", "1.2.3.json")))
+
+		catalog, err := bundle.ReadCatalog(config.CatalogDirectory)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(catalog).To(HaveLen(1))
+		Expect(catalog[0].ProductSlug).To(Equal("banana"))
+		Expect(catalog[0].Files[0].ProductFile.ID).To(Equal(tile.ID))
+	})
+
+	It("rejects bundles signed by an untrusted key", func() {
+		otherKey, _, err := ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		config.TrustedKeys = []ed25519.PublicKey{otherKey}
+		_, err = bundle.Import(config)
+		Expect(err).To(Equal(bundle.ErrInvalidSignature{}))
+
+		_, err = os.Stat(filepath.Join(dir, "mirror", "banana"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("rejects bundles with a modified manifest", func() {
+		rewrite(func(name string, contents []byte) []byte {
+			if name == bundle.ManifestPath {
+				return bytes.Replace(contents, []byte("1.2.3"), []byte("1.2.4"), 1)
+			}
+			return contents
+		})
+
+		_, err := bundle.Import(config)
+		Expect(err).To(Equal(bundle.ErrInvalidSignature{}))
+	})
+
+	It("rejects bundles with modified files", func() {
+		rewrite(func(name string, contents []byte) []byte {
+			if name == "files/banana-1.2.3.pivotal" {
+				return []byte("evil")
+			}
+			return contents
+		})
+
+		_, err := bundle.Import(config)
+		Expect(err).To(MatchError(ContainSubstring("invalid bundle: files/banana-1.2.3.pivotal has size 4 and sha256")))
+
+		_, err = os.Stat(filepath.Join(dir, "mirror", "banana"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("rejects bundles with missing or extra entries", func() {
+		rewrite(func(name string, contents []byte) []byte {
+			if name == "files/banana-1.2.3.pivotal" {
+				return nil
+			}
+			return contents
+		})
+
+		_, err := bundle.Import(config)
+		Expect(err).To(MatchError("invalid bundle: missing files/banana-1.2.3.pivotal"))
+	})
+
+	It("rejects entries outside the bundle layout", func() {
+		f, err := os.OpenFile(bundlePath, os.O_RDWR, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		// Replace the end-of-archive marker with another entry.
+		info, err := f.Stat()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.Seek(info.Size()-1024, io.SeekStart)
+		Expect(err).NotTo(HaveOccurred())
+
+		tw := tar.NewWriter(f)
+		Expect(tw.WriteHeader(&tar.Header{Name: "files/../../escape", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})).To(Succeed())
+		_, err = tw.Write([]byte("x"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tw.Close()).To(Succeed())
+
+		_, err = bundle.Import(config)
+		Expect(err).To(MatchError("invalid bundle: unexpected entry files/../../escape"))
+	})
+
+	It("verifies a bundle without unpacking it", func() {
+		manifest, contents, err := bundle.Verify(bundlePath, []ed25519.PublicKey{publicKey})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(manifest.ReleaseVersion).To(Equal("1.2.3"))
+		Expect(contents.Files).To(HaveLen(1))
+	})
+
+	It("requires a destination and trusted keys", func() {
+		_, err := bundle.Import(bundle.ImportConfig{Bundle: bundlePath, TrustedKeys: config.TrustedKeys})
+		Expect(err).To(MatchError("a mirror or catalog directory must be set"))
+
+		config.TrustedKeys = nil
+		_, err = bundle.Import(config)
+		Expect(err).To(MatchError("at least one trusted key must be set"))
+	})
+})
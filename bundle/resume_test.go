@@ -0,0 +1,72 @@
+package bundle
+
+import (
+	"context"
+	"crypto/ed25519"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("writeBundle", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "bundle-resume")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("keeps the entries written before an interruption", func() {
+		publicKey, privateKey, err := ed25519.GenerateKey(nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		first := filepath.Join(dir, "first")
+		second := filepath.Join(dir, "second")
+		Expect(ioutil.WriteFile(first, []byte("first"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(second, []byte("second"), 0644)).To(Succeed())
+
+		var entries []entry
+		for _, path := range []string{first, second} {
+			e, err := newFileEntry(filesDirectory+filepath.Base(path), path, "")
+			Expect(err).NotTo(HaveOccurred())
+			entries = append(entries, e)
+		}
+		entries = append(entries, newDataEntry(MetadataPath, []byte(`{"product_slug":"banana"}`)))
+
+		manifest := Manifest{Version: manifestVersion, ProductSlug: "banana"}
+		for _, e := range entries {
+			manifest.Entries = append(manifest.Entries, e.ManifestEntry)
+		}
+
+		output := filepath.Join(dir, "bundle.tar")
+
+		// The second file changes while the bundle is written, after the
+		// first has been journaled.
+		Expect(ioutil.WriteFile(second, []byte("SECOND"), 0644)).To(Succeed())
+		err = writeBundle(context.Background(), output, entries, manifest, privateKey)
+		Expect(err).To(MatchError(ContainSubstring("files/second changed while writing bundle")))
+
+		Expect(readJournal(output + ".partial.json").Entries).To(HaveLen(1))
+
+		// Resuming must not read the first file again.
+		Expect(ioutil.WriteFile(second, []byte("second"), 0644)).To(Succeed())
+		Expect(os.Remove(first)).To(Succeed())
+
+		err = writeBundle(context.Background(), output, entries, manifest, privateKey)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, _, err = Verify(output, []ed25519.PublicKey{publicKey})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = os.Stat(output + ".partial.json")
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,498 @@
+// Package cache stores downloaded product files in a local directory keyed
+// by their SHA256, so a file shared by several releases is only downloaded
+// once.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staleTempAge is how old a temporary file must be before Verify treats it
+// as left over from an interrupted write.
+const staleTempAge = time.Hour
+
+// Cache is a directory of blobs named by their SHA256. Blobs are copied to
+// and from their destinations, so changing a destination never changes the
+// cache. Every hit checks the blob against its SHA256; a blob that no longer
+// matches is removed and reported as a miss.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu        sync.Mutex
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+type Stats struct {
+	Entries int
+	Size    int64
+	MaxSize int64
+
+	// Hits, Misses and Evictions count the operations of this Cache value
+	// since it was created.
+	Hits      int64
+	Misses    int64
+	Evictions int64
+}
+
+type VerifyResult struct {
+	Checked int
+
+	// Corrupt holds the SHA256 of every blob whose contents do not match
+	// its name.
+	Corrupt []string
+
+	// Removed holds the corrupt blobs deleted by a repair.
+	Removed []string
+
+	// TempFilesRemoved counts stale temporary files deleted by a repair.
+	TempFilesRemoved int
+}
+
+type entry struct {
+	sha256  string
+	path    string
+	size    int64
+	lastUse time.Time
+}
+
+// New opens or creates a cache in dir. When maxSize is greater than zero
+// the least recently used blobs are evicted to keep the cache below it.
+func New(dir string, maxSize int64) (*Cache, error) {
+	for _, d := range []string{blobsDir(dir), tmpDir(dir)} {
+		err := os.MkdirAll(d, 0755)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %s", err)
+		}
+	}
+
+	return &Cache{dir: dir, maxSize: maxSize}, nil
+}
+
+func blobsDir(dir string) string {
+	return filepath.Join(dir, "sha256")
+}
+
+func tmpDir(dir string) string {
+	return filepath.Join(dir, "tmp")
+}
+
+func (c *Cache) blobPath(sum string) string {
+	return filepath.Join(blobsDir(c.dir), sum[:2], sum)
+}
+
+func normalize(sum string) (string, error) {
+	sum = strings.ToLower(sum)
+
+	decoded, err := hex.DecodeString(sum)
+	if err != nil || len(decoded) != sha256.Size {
+		return "", fmt.Errorf("invalid sha256 %q", sum)
+	}
+
+	return sum, nil
+}
+
+// Contains reports whether a blob with the given SHA256 and size is cached.
+// A size below one is not checked. Only the size is checked, not the
+// contents; Get and Open check those.
+func (c *Cache) Contains(sum string, size int64) bool {
+	sum, err := normalize(sum)
+	if err != nil {
+		return false
+	}
+
+	info, err := os.Stat(c.blobPath(sum))
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+
+	return size <= 0 || info.Size() == size
+}
+
+// Get copies the cached blob to dst, replacing any existing file, and
+// reports whether it was found. dst is only replaced once the copy has been
+// checked against sum.
+func (c *Cache) Get(sum string, size int64, dst string) (bool, error) {
+	sum, err := normalize(sum)
+	if err != nil {
+		return false, err
+	}
+
+	if !c.Contains(sum, size) {
+		c.count(&c.misses, 1)
+		return false, nil
+	}
+
+	blob := c.blobPath(sum)
+	tmpPath, actual, err := copyToTemp(blob, filepath.Dir(dst), true)
+	if err != nil {
+		return false, err
+	}
+
+	if actual != sum {
+		os.Remove(tmpPath)
+		c.discard(blob)
+		return false, nil
+	}
+
+	err = os.Rename(tmpPath, dst)
+	if err != nil {
+		os.Remove(tmpPath)
+		return false, fmt.Errorf("failed to move file into place: %s", err)
+	}
+	touch(blob)
+
+	c.count(&c.hits, 1)
+	return true, nil
+}
+
+// Open opens the cached blob for reading and reports whether it was found.
+// The blob is read once to check it against sum before it is returned. The
+// caller must close the returned file.
+func (c *Cache) Open(sum string, size int64) (*os.File, bool, error) {
+	sum, err := normalize(sum)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if !c.Contains(sum, size) {
+		c.count(&c.misses, 1)
+		return nil, false, nil
+	}
+
+	blob := c.blobPath(sum)
+	f, err := os.Open(blob)
+	if err != nil {
+		return nil, false, err
+	}
+
+	actual, err := hashReader(f, blob)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+
+	if actual != sum {
+		f.Close()
+		c.discard(blob)
+		return nil, false, nil
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	touch(blob)
+
+	c.count(&c.hits, 1)
+	return f, true, nil
+}
+
+// discard removes a blob whose contents no longer match its name, so that
+// it is replaced the next time the file is downloaded, and counts a miss.
+func (c *Cache) discard(blob string) {
+	os.Remove(blob)
+	c.count(&c.misses, 1)
+}
+
+// CopyTo writes the cached blob to w and reports whether it was found.
+func (c *Cache) CopyTo(sum string, size int64, w io.Writer) (bool, error) {
+	f, found, err := c.Open(sum, size)
+	if err != nil || !found {
+		return false, err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	if err != nil {
+		return false, fmt.Errorf("failed to copy from cache: %s", err)
+	}
+
+	return true, nil
+}
+
+// Put copies the file at src into the cache, checking that its contents
+// match sum, then evicts blobs if the cache is over its maximum size.
+func (c *Cache) Put(sum string, src string) error {
+	return c.put(sum, src, true)
+}
+
+// PutVerified is like Put for a file the caller has already checked
+// against sum, and does not hash it again. A file that does not match sum
+// is stored, but is discarded by the first Get or Open that finds it.
+func (c *Cache) PutVerified(sum string, src string) error {
+	return c.put(sum, src, false)
+}
+
+func (c *Cache) put(sum string, src string, check bool) error {
+	sum, err := normalize(sum)
+	if err != nil {
+		return err
+	}
+
+	blob := c.blobPath(sum)
+	if _, err := os.Stat(blob); err == nil {
+		touch(blob)
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(blob), 0755)
+	if err != nil {
+		return err
+	}
+
+	tmpPath, actual, err := copyToTemp(src, tmpDir(c.dir), check)
+	if err != nil {
+		return err
+	}
+
+	if check && actual != sum {
+		os.Remove(tmpPath)
+		return fmt.Errorf("refusing to cache %s: sha256 is %s, expected %s", src, actual, sum)
+	}
+
+	err = os.Rename(tmpPath, blob)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move file into place: %s", err)
+	}
+	touch(blob)
+
+	return c.evict(sum)
+}
+
+// Stats returns the size of the cache and its hit and miss counts.
+func (c *Cache) Stats() (Stats, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := Stats{
+		Entries:   len(entries),
+		MaxSize:   c.maxSize,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+	for _, e := range entries {
+		stats.Size += e.size
+	}
+
+	return stats, nil
+}
+
+// Verify hashes every blob. With repair set, corrupt blobs and stale
+// temporary files are removed.
+func (c *Cache) Verify(repair bool) (VerifyResult, error) {
+	var result VerifyResult
+
+	entries, err := c.entries()
+	if err != nil {
+		return result, err
+	}
+
+	for _, e := range entries {
+		result.Checked++
+
+		actual, err := hashFile(e.path)
+		if err == nil && actual == e.sha256 {
+			continue
+		}
+
+		result.Corrupt = append(result.Corrupt, e.sha256)
+
+		if repair {
+			err = os.Remove(e.path)
+			if err != nil {
+				return result, fmt.Errorf("failed to remove corrupt blob: %s", err)
+			}
+			result.Removed = append(result.Removed, e.sha256)
+		}
+	}
+
+	if repair {
+		temps, err := ioutil.ReadDir(tmpDir(c.dir))
+		if err != nil {
+			return result, err
+		}
+
+		for _, t := range temps {
+			if time.Since(t.ModTime()) < staleTempAge {
+				continue
+			}
+
+			err = os.Remove(filepath.Join(tmpDir(c.dir), t.Name()))
+			if err == nil {
+				result.TempFilesRemoved++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// evict removes the least recently used blobs, other than keep, until the
+// cache fits within its maximum size.
+func (c *Cache) evict(keep string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUse.Before(entries[j].lastUse)
+	})
+
+	for _, e := range entries {
+		if size <= c.maxSize {
+			break
+		}
+		if e.sha256 == keep {
+			continue
+		}
+
+		err = os.Remove(e.path)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to evict %s: %s", e.sha256, err)
+		}
+
+		size -= e.size
+		c.count(&c.evictions, 1)
+	}
+
+	return nil
+}
+
+func (c *Cache) entries() ([]entry, error) {
+	var entries []entry
+
+	err := filepath.Walk(blobsDir(c.dir), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		sum, err := normalize(info.Name())
+		if err != nil {
+			return nil
+		}
+
+		entries = append(entries, entry{
+			sha256:  sum,
+			path:    path,
+			size:    info.Size(),
+			lastUse: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache: %s", err)
+	}
+
+	return entries, nil
+}
+
+func (c *Cache) count(counter *int64, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*counter += n
+}
+
+// touch records a use of path for eviction.
+func touch(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// copyToTemp copies src to a new temporary file in dir, readable by
+// everyone, and returns its path. With hash set, it also returns the SHA256
+// of the copied contents.
+func copyToTemp(src string, dir string, hash bool) (string, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", "", err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile(dir, ".cache-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create temporary file: %s", err)
+	}
+
+	h := sha256.New()
+	var w io.Writer = out
+	if hash {
+		w = io.MultiWriter(out, h)
+	}
+
+	_, err = io.Copy(w, in)
+	if err == nil {
+		err = out.Chmod(0644)
+	}
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", "", fmt.Errorf("failed to copy file: %s", err)
+	}
+
+	if !hash {
+		return out.Name(), "", nil
+	}
+
+	return out.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	return hashReader(f, path)
+}
+
+func hashReader(r io.Reader, path string) (string, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %s", path, err)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
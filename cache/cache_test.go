@@ -0,0 +1,313 @@
+package cache_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/cache"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cache", func() {
+	var (
+		dir string
+		c   *cache.Cache
+	)
+
+	sum := func(contents []byte) string {
+		s := sha256.Sum256(contents)
+		return hex.EncodeToString(s[:])
+	}
+
+	writeFile := func(name string, contents []byte) string {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, contents, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		return path
+	}
+
+	blobPath := func(s string) string {
+		return filepath.Join(dir, "cache", "sha256", s[:2], s)
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "cache")
+		Expect(err).NotTo(HaveOccurred())
+
+		c, err = cache.New(filepath.Join(dir, "cache"), 0)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	Describe("Put and Get", func() {
+		It("stores a file and places it at a destination", func() {
+			contents := []byte("some-stemcell")
+			err := c.Put(sum(contents), writeFile("src", contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			dst := filepath.Join(dir, "dst")
+			found, err := c.Get(sum(contents), int64(len(contents)), dst)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			Expect(ioutil.ReadFile(dst)).To(Equal(contents))
+		})
+
+		It("accepts upper case checksums", func() {
+			contents := []byte("some-stemcell")
+			err := c.Put(strings.ToUpper(sum(contents)), writeFile("src", contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Contains(sum(contents), 0)).To(BeTrue())
+		})
+
+		It("reports a miss for unknown checksums and sizes", func() {
+			contents := []byte("some-stemcell")
+			err := c.Put(sum(contents), writeFile("src", contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			found, err := c.Get(sum([]byte("other")), 0, filepath.Join(dir, "dst"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			found, err = c.Get(sum(contents), 1, filepath.Join(dir, "dst"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			_, err = os.Stat(filepath.Join(dir, "dst"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("copies a blob to a writer", func() {
+			contents := []byte("some-buildpack")
+			err := c.Put(sum(contents), writeFile("src", contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			buf := &bytes.Buffer{}
+			found, err := c.CopyTo(sum(contents), 0, buf)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(buf.Bytes()).To(Equal(contents))
+		})
+
+		It("opens a blob for reading", func() {
+			contents := []byte("some-buildpack")
+			err := c.Put(sum(contents), writeFile("src", contents))
+			Expect(err).NotTo(HaveOccurred())
+
+			f, found, err := c.Open(sum(contents), int64(len(contents)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			defer f.Close()
+
+			Expect(ioutil.ReadAll(f)).To(Equal(contents))
+
+			_, found, err = c.Open(sum([]byte("other")), 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+		})
+
+		It("trusts the checksum of files put with PutVerified", func() {
+			err := c.PutVerified(sum([]byte("expected")), writeFile("src", []byte("actual")))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(c.Contains(sum([]byte("expected")), 0)).To(BeTrue())
+
+			result, err := c.Verify(false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Corrupt).To(Equal([]string{sum([]byte("expected"))}))
+		})
+
+		It("shares no contents with the files put or got", func() {
+			contents := []byte("some-stemcell")
+			src := writeFile("src", contents)
+			Expect(c.Put(sum(contents), src)).To(Succeed())
+
+			dst := filepath.Join(dir, "dst")
+			found, err := c.Get(sum(contents), int64(len(contents)), dst)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			for _, path := range []string{src, dst} {
+				f, err := os.OpenFile(path, os.O_WRONLY, 0)
+				Expect(err).NotTo(HaveOccurred())
+				_, err = f.WriteAt([]byte("edited"), 0)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(f.Close()).To(Succeed())
+			}
+
+			found, err = c.Get(sum(contents), int64(len(contents)), filepath.Join(dir, "other"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(ioutil.ReadFile(filepath.Join(dir, "other"))).To(Equal(contents))
+		})
+
+		It("discards a blob that no longer matches its checksum and reports a miss", func() {
+			contents := []byte("some-stemcell")
+			Expect(c.Put(sum(contents), writeFile("src", contents))).To(Succeed())
+			Expect(ioutil.WriteFile(blobPath(sum(contents)), []byte("some-corrupt!"), 0644)).To(Succeed())
+
+			dst := writeFile("dst", []byte("previous"))
+			found, err := c.Get(sum(contents), int64(len(contents)), dst)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(ioutil.ReadFile(dst)).To(Equal([]byte("previous")))
+			Expect(c.Contains(sum(contents), 0)).To(BeFalse())
+
+			Expect(c.Put(sum(contents), writeFile("src", contents))).To(Succeed())
+			Expect(ioutil.WriteFile(blobPath(sum(contents)), []byte("some-corrupt!"), 0644)).To(Succeed())
+
+			_, found, err = c.Open(sum(contents), int64(len(contents)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeFalse())
+			Expect(c.Contains(sum(contents), 0)).To(BeFalse())
+
+			stats, err := c.Stats()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Hits).To(BeZero())
+			Expect(stats.Misses).To(Equal(int64(2)))
+		})
+
+		It("refuses files that do not match their checksum", func() {
+			err := c.Put(sum([]byte("expected")), writeFile("src", []byte("actual")))
+			Expect(err).To(MatchError(ContainSubstring("refusing to cache")))
+
+			Expect(c.Contains(sum([]byte("expected")), 0)).To(BeFalse())
+		})
+
+		It("rejects invalid checksums", func() {
+			err := c.Put("not-a-sha", writeFile("src", []byte("contents")))
+			Expect(err).To(MatchError(`invalid sha256 "not-a-sha"`))
+
+			_, err = c.Get("../../etc/passwd", 0, filepath.Join(dir, "dst"))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Describe("eviction", func() {
+		It("evicts the least recently used blobs once over the maximum size", func() {
+			var err error
+			c, err = cache.New(filepath.Join(dir, "cache"), 25)
+			Expect(err).NotTo(HaveOccurred())
+
+			first := bytes.Repeat([]byte("a"), 10)
+			second := bytes.Repeat([]byte("b"), 10)
+			third := bytes.Repeat([]byte("c"), 10)
+
+			Expect(c.Put(sum(first), writeFile("first", first))).To(Succeed())
+			Expect(c.Put(sum(second), writeFile("second", second))).To(Succeed())
+
+			old := time.Now().Add(-2 * time.Hour)
+			Expect(os.Chtimes(blobPath(sum(first)), old, old)).To(Succeed())
+			Expect(os.Chtimes(blobPath(sum(second)), old.Add(-time.Hour), old.Add(-time.Hour))).To(Succeed())
+
+			found, err := c.Get(sum(second), 0, filepath.Join(dir, "dst"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(found).To(BeTrue())
+
+			Expect(c.Put(sum(third), writeFile("third", third))).To(Succeed())
+
+			Expect(c.Contains(sum(first), 0)).To(BeFalse())
+			Expect(c.Contains(sum(second), 0)).To(BeTrue())
+			Expect(c.Contains(sum(third), 0)).To(BeTrue())
+
+			stats, err := c.Stats()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats).To(Equal(cache.Stats{
+				Entries:   2,
+				Size:      20,
+				MaxSize:   25,
+				Hits:      1,
+				Evictions: 1,
+			}))
+		})
+
+		It("keeps a blob larger than the maximum size", func() {
+			var err error
+			c, err = cache.New(filepath.Join(dir, "cache"), 5)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents := bytes.Repeat([]byte("a"), 10)
+			Expect(c.Put(sum(contents), writeFile("src", contents))).To(Succeed())
+			Expect(c.Contains(sum(contents), 10)).To(BeTrue())
+		})
+	})
+
+	Describe("Stats", func() {
+		It("counts hits and misses", func() {
+			contents := []byte("some-tile")
+			Expect(c.Put(sum(contents), writeFile("src", contents))).To(Succeed())
+
+			c.Get(sum(contents), 0, filepath.Join(dir, "dst"))
+			c.Get(sum([]byte("other")), 0, filepath.Join(dir, "dst"))
+			c.CopyTo(sum([]byte("other")), 0, &bytes.Buffer{})
+
+			stats, err := c.Stats()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Entries).To(Equal(1))
+			Expect(stats.Size).To(Equal(int64(len(contents))))
+			Expect(stats.Hits).To(Equal(int64(1)))
+			Expect(stats.Misses).To(Equal(int64(2)))
+		})
+	})
+
+	Describe("Verify", func() {
+		var good, bad []byte
+
+		BeforeEach(func() {
+			good = []byte("good")
+			bad = []byte("bad")
+
+			Expect(c.Put(sum(good), writeFile("good", good))).To(Succeed())
+			Expect(c.Put(sum(bad), writeFile("bad", bad))).To(Succeed())
+
+			// Destinations may share the blob's inode, so writing to one in
+			// place changes the blob.
+			err := ioutil.WriteFile(blobPath(sum(bad)), []byte("corrupted"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("reports corrupt blobs without removing them", func() {
+			result, err := c.Verify(false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Checked).To(Equal(2))
+			Expect(result.Corrupt).To(Equal([]string{sum(bad)}))
+			Expect(result.Removed).To(BeEmpty())
+
+			Expect(c.Contains(sum(bad), 0)).To(BeTrue())
+		})
+
+		It("removes corrupt blobs and stale temporary files when repairing", func() {
+			stale := filepath.Join(dir, "cache", "tmp", ".cache-stale")
+			Expect(ioutil.WriteFile(stale, []byte("partial"), 0644)).To(Succeed())
+			old := time.Now().Add(-2 * time.Hour)
+			Expect(os.Chtimes(stale, old, old)).To(Succeed())
+
+			fresh := filepath.Join(dir, "cache", "tmp", ".cache-fresh")
+			Expect(ioutil.WriteFile(fresh, []byte("partial"), 0644)).To(Succeed())
+
+			result, err := c.Verify(true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Removed).To(Equal([]string{sum(bad)}))
+			Expect(result.TempFilesRemoved).To(Equal(1))
+
+			Expect(c.Contains(sum(bad), 0)).To(BeFalse())
+			Expect(c.Contains(sum(good), 0)).To(BeTrue())
+
+			_, err = os.Stat(fresh)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -1,18 +1,31 @@
 package download
 
 import (
+	"context"
 	"fmt"
-	"github.com/pivotal-cf/go-pivnet/logger"
-	"golang.org/x/sync/errgroup"
 	"io"
-	"net"
 	"net/http"
 	"os"
-	"strings"
-	"syscall"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
 	"github.com/shirou/gopsutil/disk"
 )
 
+const (
+	DefaultWorkers = 10
+	copyBufferSize = 256 * 1024
+)
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, copyBufferSize)
+		return &b
+	},
+}
+
 //go:generate counterfeiter -o ./fakes/ranger.go --fake-name Ranger . ranger
 type ranger interface {
 	BuildRange(contentLength int64) ([]Range, error)
@@ -42,145 +55,383 @@ type Client struct {
 	Ranger     ranger
 	Bar        bar
 	Logger     logger.Logger
+
+	// Workers is the number of ranges downloaded concurrently.
+	// Defaults to DefaultWorkers.
+	Workers int
+
+	// MinSplitSize is the smallest piece an in-flight range is split into
+	// when an idle worker steals part of it. Defaults to DefaultMinChunkSize.
+	MinSplitSize int64
+
+	// Preallocate reserves the full size of the download on disk before
+	// any range is written.
+	Preallocate bool
+
+	// RetryPolicy bounds the retries of failed range requests.
+	RetryPolicy RetryPolicy
+
+	// Progress receives the events of each download. Bar, when set, is
+	// still updated alongside it.
+	Progress ProgressListener
+
+	// Limiter, if set, caps the combined rate at which ranges are read.
+	// It may be shared with other Clients.
+	Limiter *Limiter
+}
+
+// Expected describes what a completed download must match. Zero fields are
+// not checked.
+type Expected struct {
+	Size   int64
+	SHA256 string
+	MD5    string
 }
 
 func (c Client) Get(
 	location *os.File,
 	downloadLinkFetcher downloadLinkFetcher,
 	progressWriter io.Writer,
+) error {
+	return c.GetWithContext(context.Background(), location, downloadLinkFetcher, progressWriter)
+}
+
+// GetWithContext is like Get but stops downloading and returns the context's
+// error once ctx is done.
+func (c Client) GetWithContext(
+	ctx context.Context,
+	location *os.File,
+	downloadLinkFetcher downloadLinkFetcher,
+	progressWriter io.Writer,
+) error {
+	p := c.newProgress()
+
+	err := c.get(ctx, location, downloadLinkFetcher, progressWriter, p)
+	p.finish(err)
+
+	return err
+}
+
+// GetVerified is like GetWithContext but also checks the downloaded file
+// against expected before reporting the download as finished.
+func (c Client) GetVerified(
+	ctx context.Context,
+	location *os.File,
+	downloadLinkFetcher downloadLinkFetcher,
+	progressWriter io.Writer,
+	expected Expected,
+) error {
+	p := c.newProgress()
+
+	err := c.get(ctx, location, downloadLinkFetcher, progressWriter, p)
+	if err == nil {
+		err = VerifyFile(location.Name(), expected.Size, expected.SHA256, expected.MD5)
+		if err == nil {
+			p.verified()
+		}
+	}
+	p.finish(err)
+
+	return err
+}
+
+func (c Client) get(
+	ctx context.Context,
+	location *os.File,
+	downloadLinkFetcher downloadLinkFetcher,
+	progressWriter io.Writer,
+	p *progress,
 ) error {
 	contentURL, err := downloadLinkFetcher.NewDownloadLink()
 	if err != nil {
 		return err
 	}
 
-	req, err := http.NewRequest("HEAD", contentURL, nil)
+	info, err := c.inspect(ctx, contentURL)
 	if err != nil {
-		return fmt.Errorf("failed to construct HEAD request: %s", err)
+		return err
 	}
 
-	req.Header.Add("Referer","https://go-pivnet.network.pivotal.io")
+	policy := c.RetryPolicy.withDefaults()
+	budget := &retryBudget{remaining: policy.MaxRetries}
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make HEAD request: %s", err)
+	if !info.acceptsRanges {
+		return c.getStream(ctx, location, info, downloadLinkFetcher, progressWriter, policy, budget, p)
 	}
 
-	contentURL = resp.Request.URL.String()
+	contentURL = info.url
 
-	ranges, err := c.Ranger.BuildRange(resp.ContentLength)
+	ranges, err := c.Ranger.BuildRange(info.contentLength)
 	if err != nil {
 		return fmt.Errorf("failed to construct range: %s", err)
 	}
 
-	diskStats, err := disk.Usage(location.Name())
+	err = checkDiskSpace(location, info.contentLength)
 	if err != nil {
-		return fmt.Errorf("failed to get disk free space: %s", err)
-	}
-
-	if diskStats.Free < uint64(resp.ContentLength) {
-		return fmt.Errorf("file is too big to fit on this drive")
+		return err
 	}
 
-	c.Bar.SetOutput(progressWriter)
-	c.Bar.SetTotal(resp.ContentLength)
-	c.Bar.Kickoff()
+	p.start(progressWriter, info.contentLength)
 
-	defer c.Bar.Finish()
 	fileInfo, err := location.Stat()
 	if err != nil {
+		p.finishBar()
 		return fmt.Errorf("failed to read information from output file: %s", err)
 	}
 
-	var g errgroup.Group
-	for _, r := range ranges {
-		byteRange := r
-
-		fileWriter, err := os.OpenFile(location.Name(), os.O_RDWR, fileInfo.Mode())
+	if c.Preallocate && fileInfo.Size() < info.contentLength {
+		err = preallocate(location, info.contentLength)
 		if err != nil {
-			return fmt.Errorf("failed to open file for writing: %s", err)
+			p.finishBar()
+			return fmt.Errorf("failed to preallocate output file: %s", err)
 		}
+	}
 
-		g.Go(func() error {
-			err := c.retryableRequest(contentURL, byteRange.HTTPHeader, fileWriter, byteRange.Lower, downloadLinkFetcher)
-			if err != nil {
-				return fmt.Errorf("failed during retryable request: %s", err)
+	minSplitSize := c.MinSplitSize
+	if minSplitSize <= 0 {
+		minSplitSize = DefaultMinChunkSize
+	}
+
+	workers := c.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	s := newScheduler(ranges, minSplitSize)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures []RangeFailure
+		written  = &byteCounter{}
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for w := s.next(); w != nil; w = s.next() {
+				attempts, err := c.downloadRange(ctx, contentURL, s, w, location, downloadLinkFetcher, policy, budget, written, p)
+				_, upper := s.bounds(w)
+				s.done(w)
+
+				if err != nil {
+					s.abort()
+
+					mu.Lock()
+					failures = append(failures, RangeFailure{
+						Lower:    w.lower,
+						Upper:    upper,
+						Attempts: attempts,
+						Err:      err,
+					})
+					mu.Unlock()
+				}
 			}
+		}()
+	}
 
-			return nil
-		})
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		p.finishBar()
+		return ctx.Err()
 	}
 
-	if err := g.Wait(); err != nil {
-		return err
+	for _, f := range failures {
+		if f.Err == errRangesUnsupported {
+			p.discard(0, written.get())
+			p.finishBar()
+
+			c.debug("server ignored range request, falling back to a single stream")
+			info.acceptsRanges = false
+			info.url = contentURL
+			return c.getStream(ctx, location, info, downloadLinkFetcher, progressWriter, policy, budget, p)
+		}
+	}
+
+	p.finishBar()
+
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool {
+			return failures[i].Lower < failures[j].Lower
+		})
+		return ErrRangesFailed{Failures: failures}
 	}
 
 	return nil
 }
 
-func (c Client) retryableRequest(contentURL string, rangeHeader http.Header, fileWriter *os.File, startingByte int64, downloadLinkFetcher downloadLinkFetcher) error {
+// downloadRange downloads w, retrying failed attempts according to policy.
+// It returns the number of attempts made.
+func (c Client) downloadRange(
+	ctx context.Context,
+	contentURL string,
+	s *scheduler,
+	w *work,
+	location io.WriterAt,
+	downloadLinkFetcher downloadLinkFetcher,
+	policy RetryPolicy,
+	budget *retryBudget,
+	written *byteCounter,
+	p *progress,
+) (int, error) {
 	currentURL := contentURL
-	defer fileWriter.Close()
 
-	var err error
-Retry:
-	_, err = fileWriter.Seek(startingByte, 0)
-	if err != nil {
-		return fmt.Errorf("failed to seek to correct byte of output file: %s", err)
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
+
+	for attempt := 1; ; attempt++ {
+		bytesWritten, err := c.requestRange(ctx, currentURL, s, w, location, *buf, p)
+		if err == nil {
+			written.add(bytesWritten)
+			return attempt, nil
+		}
+
+		p.discard(w.lower, bytesWritten)
+		s.reset(w)
+
+		if ctx.Err() != nil {
+			return attempt, ctx.Err()
+		}
+
+		if !isRetryable(err) || attempt >= policy.MaxAttempts || !budget.take() {
+			return attempt, err
+		}
+
+		_, upper := s.bounds(w)
+		p.retried(w.lower, upper, attempt, err)
+
+		if sc, ok := err.(statusCodeError); ok && sc.statusCode == http.StatusForbidden {
+			c.debug("received unsuccessful status code", logger.Data{"statusCode": sc.statusCode})
+			currentURL, err = downloadLinkFetcher.NewDownloadLink()
+			if err != nil {
+				return attempt, err
+			}
+			c.debug("fetched new download url", logger.Data{"url": currentURL})
+			p.linkRefreshed()
+
+			continue
+		}
+
+		backoff := policy.Backoff(attempt)
+		c.debug("retrying range request", logger.Data{
+			"attempt": attempt,
+			"backoff": backoff.String(),
+			"error":   err.Error(),
+		})
+		err = sleep(ctx, backoff)
+		if err != nil {
+			return attempt, err
+		}
 	}
+}
 
+// requestRange makes a single request for the bytes of w that have not been
+// written yet. It returns the number of bytes written.
+func (c Client) requestRange(ctx context.Context, currentURL string, s *scheduler, w *work, location io.WriterAt, buf []byte, p *progress) (int64, error) {
 	req, err := http.NewRequest("GET", currentURL, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
+	req = req.WithContext(ctx)
 
-	rangeHeader.Add("Referer", "https://go-pivnet.network.pivotal.io")
-	req.Header = rangeHeader
+	lower, upper := s.bounds(w)
+	req.Header.Add("Range", formatRange(lower, upper))
+	req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
 
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		if netErr, ok := err.(net.Error); ok {
-			if netErr.Temporary() {
-				goto Retry
-			}
-		}
-
-		return fmt.Errorf("download request failed: %s", err)
+		return 0, wrappedError{message: "download request failed", err: err}
 	}
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusForbidden {
-		c.Logger.Debug("received unsuccessful status code: %d", logger.Data{"statusCode": resp.StatusCode})
-		currentURL, err = downloadLinkFetcher.NewDownloadLink()
-		if err != nil {
-			return err
-		}
-		c.Logger.Debug("fetched new download url: %d", logger.Data{"url": currentURL})
-
-		goto Retry
+	if resp.StatusCode == http.StatusOK {
+		return 0, errRangesUnsupported
 	}
 
 	if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("during GET unexpected status code was returned: %d", resp.StatusCode)
+		return 0, statusCodeError{statusCode: resp.StatusCode}
 	}
 
-	var proxyReader io.Reader
-	proxyReader = c.Bar.NewProxyReader(resp.Body)
+	fileWriter := &offsetWriter{writerAt: location, offset: lower}
+
+	proxyReader := p.reader(workReader{scheduler: s, work: w, reader: c.Limiter.Reader(ctx, resp.Body)}, lower)
 
-	bytesWritten, err := io.Copy(fileWriter, proxyReader)
+	bytesWritten, err := io.CopyBuffer(fileWriter, proxyReader, buf)
 	if err != nil {
-		if err == io.ErrUnexpectedEOF {
-			c.Bar.Add(int(-1 * bytesWritten))
-			goto Retry
-		}
-		oe, _ := err.(*net.OpError)
-		if strings.Contains(oe.Err.Error(), syscall.ECONNRESET.Error()) {
-			c.Bar.Add(int(-1 * bytesWritten))
-			goto Retry
-		}
-		return fmt.Errorf("failed to write file during io.Copy: %s", err)
+		return bytesWritten, wrappedError{message: "failed to write file during io.Copy", err: err}
+	}
+
+	next, upper := s.bounds(w)
+	if next <= upper {
+		return bytesWritten, io.ErrUnexpectedEOF
+	}
+
+	return bytesWritten, nil
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func checkDiskSpace(location *os.File, contentLength int64) error {
+	diskStats, err := disk.Usage(location.Name())
+	if err != nil {
+		return fmt.Errorf("failed to get disk free space: %s", err)
+	}
+
+	if diskStats.Free < uint64(contentLength) {
+		return fmt.Errorf("file is too big to fit on this drive")
 	}
 
 	return nil
 }
+
+type byteCounter struct {
+	mu    sync.Mutex
+	count int64
+}
+
+func (b *byteCounter) add(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.count += n
+}
+
+func (b *byteCounter) get() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.count
+}
+
+func (c Client) debug(action string, data ...logger.Data) {
+	if c.Logger != nil {
+		c.Logger.Debug(action, data...)
+	}
+}
+
+// offsetWriter writes sequentially into an io.WriterAt starting at offset,
+// allowing all workers to share a single file handle.
+type offsetWriter struct {
+	writerAt io.WriterAt
+	offset   int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.writerAt.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -0,0 +1,88 @@
+package download_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+)
+
+type discardBar struct{}
+
+func (discardBar) SetTotal(contentLength int64)              {}
+func (discardBar) SetOutput(output io.Writer)                {}
+func (discardBar) Add(totalWritten int) int                  { return 0 }
+func (discardBar) Kickoff()                                  {}
+func (discardBar) Finish()                                   {}
+func (discardBar) NewProxyReader(reader io.Reader) io.Reader { return reader }
+
+func BenchmarkGet(b *testing.B) {
+	for _, size := range []int64{1 << 20, 32 << 20} {
+		for _, workers := range []int{1, 4, 10} {
+			for _, preallocate := range []bool{false, true} {
+				name := fmt.Sprintf("%dMiB/%dWorkers/Preallocate=%t", size>>20, workers, preallocate)
+				b.Run(name, func(b *testing.B) {
+					benchmarkGet(b, size, workers, preallocate)
+				})
+			}
+		}
+	}
+}
+
+func benchmarkGet(b *testing.B, size int64, workers int, preallocate bool) {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	downloadLinkFetcher := &fakes.DownloadLinkFetcher{}
+	downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+
+	downloader := download.Client{
+		HTTPClient: &http.Client{},
+		Ranger: download.NewRangerWithConfig(download.RangerConfig{
+			NumHunks:     workers,
+			MinChunkSize: 256 * 1024,
+		}),
+		Bar:         discardBar{},
+		Workers:     workers,
+		Preallocate: preallocate,
+	}
+
+	dir, err := ioutil.TempDir("", "download-benchmark")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		f, err := ioutil.TempFile(dir, "")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		err = downloader.Get(f, downloadLinkFetcher, ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		f.Close()
+		os.Remove(f.Name())
+	}
+}
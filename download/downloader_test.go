@@ -1,18 +1,20 @@
 package download_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/pivotal-cf/go-pivnet/download"
 	"github.com/pivotal-cf/go-pivnet/download/fakes"
 
-	"fmt"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"net"
@@ -29,7 +31,30 @@ func (e EOFReader) Read(p []byte) (int, error) {
 type ConnectionResetReader struct{}
 
 func (e ConnectionResetReader) Read(p []byte) (int, error) {
-	return 0, &net.OpError{Err: fmt.Errorf(syscall.ECONNRESET.Error())}
+	return 0, &net.OpError{Err: errors.New(syscall.ECONNRESET.Error())}
+}
+
+type errReader struct{}
+
+func (e errReader) Read(p []byte) (int, error) {
+	return 0, errors.New("boom")
+}
+
+// gatedReader returns a single byte, then blocks until its gate is opened.
+type gatedReader struct {
+	reader io.Reader
+	gate   chan struct{}
+	read   bool
+}
+
+func (g *gatedReader) Read(p []byte) (int, error) {
+	if g.read {
+		<-g.gate
+		return g.reader.Read(p)
+	}
+
+	g.read = true
+	return g.reader.Read(p[:1])
 }
 
 type NetError struct {
@@ -171,6 +196,119 @@ var _ = Describe("Downloader", func() {
 		})
 	})
 
+	Context("when preallocation is enabled", func() {
+		It("extends the file to the content length before writing", func() {
+			ranger.BuildRangeReturns([]download.Range{
+				download.NewRange(0, 9, http.Header{}),
+			}, nil)
+
+			httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+				if req.Method == "HEAD" {
+					return &http.Response{
+						StatusCode:    http.StatusOK,
+						ContentLength: 20,
+						Request:       req,
+					}, nil
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusPartialContent,
+					Body:       ioutil.NopCloser(strings.NewReader("fake produ")),
+				}, nil
+			}
+
+			downloader := download.Client{
+				HTTPClient:  httpClient,
+				Ranger:      ranger,
+				Bar:         bar,
+				Preallocate: true,
+			}
+
+			tmpFile, err := ioutil.TempFile("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			stats, err := tmpFile.Stat()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stats.Size()).To(Equal(int64(20)))
+
+			content, err := ioutil.ReadAll(tmpFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content[:10])).To(Equal("fake produ"))
+		})
+	})
+
+	Context("when a worker is idle while another range is still downloading", func() {
+		It("splits the remaining portion of the slow range onto the idle worker", func() {
+			content := strings.Repeat("abcdefghij", 10)
+
+			ranger.BuildRangeReturns([]download.Range{
+				download.NewRange(0, 99, http.Header{}),
+			}, nil)
+
+			var rangeHeaders []string
+			var m = &sync.Mutex{}
+			var stolen sync.Once
+			gate := make(chan struct{})
+			httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+				if req.Method == "HEAD" {
+					return &http.Response{
+						StatusCode:    http.StatusOK,
+						ContentLength: int64(len(content)),
+						Request:       req,
+					}, nil
+				}
+
+				rangeHeader := req.Header.Get("Range")
+				m.Lock()
+				rangeHeaders = append(rangeHeaders, rangeHeader)
+				m.Unlock()
+
+				var lower, upper int
+				_, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &lower, &upper)
+				Expect(err).NotTo(HaveOccurred())
+
+				// The first range stalls after its first byte until a
+				// worker has stolen its tail.
+				var body io.Reader = strings.NewReader(content[lower : upper+1])
+				if lower == 0 {
+					body = &gatedReader{reader: body, gate: gate}
+				} else {
+					stolen.Do(func() { close(gate) })
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusPartialContent,
+					Body:       ioutil.NopCloser(body),
+				}, nil
+			}
+
+			downloader := download.Client{
+				HTTPClient:   httpClient,
+				Ranger:       ranger,
+				Bar:          bar,
+				Workers:      2,
+				MinSplitSize: 10,
+			}
+
+			tmpFile, err := ioutil.TempFile("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+			Expect(err).NotTo(HaveOccurred())
+
+			contents, err := ioutil.ReadAll(tmpFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(contents)).To(Equal(content))
+
+			Expect(len(rangeHeaders)).To(BeNumerically(">", 1))
+			Expect(rangeHeaders).To(ContainElement("bytes=0-99"))
+			Expect(rangeHeaders).To(ContainElement(MatchRegexp(`bytes=[1-9]\d*-99`)))
+		})
+	})
+
 	Context("when a retryable error occurs", func() {
 		Context("when there is an unexpected EOF", func() {
 			It("successfully retries the download", func() {
@@ -200,7 +338,7 @@ var _ = Describe("Downloader", func() {
 					return responses[count], errors[count]
 				}
 
-				ranger.BuildRangeReturns([]download.Range{download.NewRange(0,15, http.Header{})}, nil)
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 8, http.Header{})}, nil)
 
 				downloader := download.Client{
 					HTTPClient: httpClient,
@@ -254,7 +392,7 @@ var _ = Describe("Downloader", func() {
 					return responses[count], errors[count]
 				}
 
-				ranger.BuildRangeReturns([]download.Range{download.NewRange(0,15, http.Header{})}, nil)
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 8, http.Header{})}, nil)
 
 				downloader := download.Client{
 					HTTPClient: httpClient,
@@ -304,7 +442,7 @@ var _ = Describe("Downloader", func() {
 					return responses[count], errors[count]
 				}
 
-				ranger.BuildRangeReturns([]download.Range{download.NewRange(0,15, http.Header{})}, nil)
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 8, http.Header{})}, nil)
 
 				downloader := download.Client{
 					HTTPClient: httpClient,
@@ -330,6 +468,90 @@ var _ = Describe("Downloader", func() {
 				Expect(string(content)).To(Equal("something"))
 			})
 		})
+
+		Context("when a range response ends early", func() {
+			It("retries the range until it is complete", func() {
+				responses := []*http.Response{
+					{
+						Request: &http.Request{
+							URL: &url.URL{
+								Scheme: "https",
+								Host:   "example.com",
+								Path:   "some-file",
+							},
+						},
+					},
+					{
+						StatusCode: http.StatusPartialContent,
+						Body:       ioutil.NopCloser(strings.NewReader("some")),
+					},
+					{
+						StatusCode: http.StatusPartialContent,
+						Body:       ioutil.NopCloser(strings.NewReader("something")),
+					},
+				}
+
+				httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+					count := httpClient.DoCallCount() - 1
+					return responses[count], nil
+				}
+
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 8, http.Header{})}, nil)
+
+				downloader := download.Client{
+					HTTPClient:  httpClient,
+					Ranger:      ranger,
+					Bar:         bar,
+					RetryPolicy: download.RetryPolicy{InitialBackoff: time.Millisecond},
+				}
+
+				tmpFile, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(httpClient.DoCallCount()).To(Equal(3))
+
+				content, err := ioutil.ReadAll(tmpFile)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(string(content)).To(Equal("something"))
+			})
+		})
+	})
+
+	Context("when the context is canceled", func() {
+		It("stops retrying and returns the context error", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+				if req.Method == "HEAD" {
+					return &http.Response{Request: req, ContentLength: 9}, nil
+				}
+
+				cancel()
+				return &http.Response{
+					StatusCode: http.StatusServiceUnavailable,
+					Body:       ioutil.NopCloser(strings.NewReader("")),
+				}, nil
+			}
+
+			ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 8, http.Header{})}, nil)
+
+			downloader := download.Client{
+				HTTPClient: httpClient,
+				Ranger:     ranger,
+				Bar:        bar,
+			}
+
+			tmpFile, err := ioutil.TempFile("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = downloader.GetWithContext(ctx, tmpFile, downloadLinkFetcher, GinkgoWriter)
+			Expect(err).To(Equal(context.Canceled))
+			Expect(httpClient.DoCallCount()).To(Equal(2))
+		})
 	})
 
 	Context("when an error occurs", func() {
@@ -458,7 +680,14 @@ var _ = Describe("Downloader", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				err = downloader.Get(file, downloadLinkFetcher, GinkgoWriter)
-				Expect(err).To(MatchError("failed during retryable request: download request failed: failed GET"))
+				Expect(err).To(MatchError("failed to download 1 range(s): bytes=0-0 after 1 attempt(s): download request failed: failed GET"))
+
+				rangesErr, ok := err.(download.ErrRangesFailed)
+				Expect(ok).To(BeTrue())
+				Expect(rangesErr.Failures).To(HaveLen(1))
+				Expect(rangesErr.Failures[0].Lower).To(Equal(int64(0)))
+				Expect(rangesErr.Failures[0].Upper).To(Equal(int64(0)))
+				Expect(rangesErr.Failures[0].Attempts).To(Equal(1))
 			})
 		})
 
@@ -475,7 +704,7 @@ var _ = Describe("Downloader", func() {
 						},
 					},
 					{
-						StatusCode: http.StatusInternalServerError,
+						StatusCode: http.StatusNotFound,
 						Body:       ioutil.NopCloser(strings.NewReader("")),
 					},
 				}
@@ -498,7 +727,103 @@ var _ = Describe("Downloader", func() {
 				Expect(err).NotTo(HaveOccurred())
 
 				err = downloader.Get(file, downloadLinkFetcher, GinkgoWriter)
-				Expect(err).To(MatchError("failed during retryable request: during GET unexpected status code was returned: 500"))
+				Expect(err).To(MatchError("failed to download 1 range(s): bytes=0-0 after 1 attempt(s): during GET unexpected status code was returned: 404"))
+			})
+		})
+
+		Context("when the GET keeps returning a server error", func() {
+			It("retries up to the maximum number of attempts", func() {
+				httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+					if req.Method == "HEAD" {
+						return &http.Response{Request: req}, nil
+					}
+
+					return &http.Response{
+						StatusCode: http.StatusServiceUnavailable,
+						Body:       ioutil.NopCloser(strings.NewReader("")),
+					}, nil
+				}
+
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 0, http.Header{})}, nil)
+
+				downloader := download.Client{
+					HTTPClient: httpClient,
+					Ranger:     ranger,
+					Bar:        bar,
+					RetryPolicy: download.RetryPolicy{
+						MaxAttempts:    3,
+						InitialBackoff: time.Millisecond,
+					},
+				}
+
+				file, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				err = downloader.Get(file, downloadLinkFetcher, GinkgoWriter)
+				Expect(err).To(MatchError("failed to download 1 range(s): bytes=0-0 after 3 attempt(s): during GET unexpected status code was returned: 503"))
+
+				Expect(httpClient.DoCallCount()).To(Equal(4))
+			})
+		})
+
+		Context("when the retry budget is exhausted", func() {
+			It("stops retrying", func() {
+				httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+					if req.Method == "HEAD" {
+						return &http.Response{Request: req}, nil
+					}
+
+					return nil, NetError{errors.New("whoops")}
+				}
+
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 0, http.Header{})}, nil)
+
+				downloader := download.Client{
+					HTTPClient: httpClient,
+					Ranger:     ranger,
+					Bar:        bar,
+					RetryPolicy: download.RetryPolicy{
+						MaxAttempts:    10,
+						MaxRetries:     2,
+						InitialBackoff: time.Millisecond,
+					},
+				}
+
+				file, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				err = downloader.Get(file, downloadLinkFetcher, GinkgoWriter)
+				Expect(err).To(MatchError(ContainSubstring("after 3 attempt(s): download request failed: whoops")))
+			})
+		})
+
+		Context("when copying the response fails with a non-network error", func() {
+			It("returns an error without retrying", func() {
+				httpClient.DoStub = func(req *http.Request) (*http.Response, error) {
+					if req.Method == "HEAD" {
+						return &http.Response{Request: req}, nil
+					}
+
+					return &http.Response{
+						StatusCode: http.StatusPartialContent,
+						Body:       ioutil.NopCloser(io.MultiReader(strings.NewReader("some"), errReader{})),
+					}, nil
+				}
+
+				ranger.BuildRangeReturns([]download.Range{download.NewRange(0, 15, http.Header{})}, nil)
+
+				downloader := download.Client{
+					HTTPClient: httpClient,
+					Ranger:     ranger,
+					Bar:        bar,
+				}
+
+				file, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+
+				err = downloader.Get(file, downloadLinkFetcher, GinkgoWriter)
+				Expect(err).To(MatchError(ContainSubstring("failed to write file during io.Copy: boom")))
+				Expect(httpClient.DoCallCount()).To(Equal(2))
 			})
 		})
 
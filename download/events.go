@@ -0,0 +1,353 @@
+package download
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+type EventType int
+
+const (
+	// EventStarted is emitted once the size of the download is known.
+	EventStarted EventType = iota
+
+	// EventBytesWritten is emitted as bytes of a range are received. Delta
+	// is negative when bytes already reported are discarded so that a
+	// range can be fetched again.
+	EventBytesWritten
+
+	// EventRangeRetried is emitted before a failed range is requested again.
+	EventRangeRetried
+
+	// EventLinkRefreshed is emitted after an expired download link has been
+	// replaced.
+	EventLinkRefreshed
+
+	// EventVerified is emitted after the downloaded file matched its
+	// expected size and checksums.
+	EventVerified
+
+	// EventFinished is emitted last, with Err set if the download failed.
+	EventFinished
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventBytesWritten:
+		return "bytes-written"
+	case EventRangeRetried:
+		return "range-retried"
+	case EventLinkRefreshed:
+		return "link-refreshed"
+	case EventVerified:
+		return "verified"
+	case EventFinished:
+		return "finished"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes the progress of a single download.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// TotalBytes is the size of the download, or -1 when the server did not
+	// report it.
+	TotalBytes int64
+
+	// BytesWritten is the number of bytes received so far.
+	BytesWritten int64
+
+	// Lower and Upper are the byte range the event refers to, for
+	// EventBytesWritten and EventRangeRetried. Upper is UnknownUpper for
+	// a retried stream of unknown length.
+	Lower int64
+	Upper int64
+
+	Delta   int64
+	Attempt int
+	Err     error
+
+	// Throughput is the average number of bytes received per second since
+	// the download started.
+	Throughput float64
+
+	// ETA is the estimated time until the download completes, or zero when
+	// it cannot be estimated.
+	ETA time.Duration
+}
+
+// ProgressListener receives the events of a download. Events of a single
+// download are delivered one at a time and in order, from the goroutines
+// doing the download but outside of their locks. A listener that blocks
+// holds up the goroutine delivering to it while the others carry on, and
+// their events queue up until it returns.
+type ProgressListener interface {
+	OnEvent(Event)
+}
+
+// ProgressListenerFunc adapts a function to a ProgressListener.
+type ProgressListenerFunc func(Event)
+
+func (f ProgressListenerFunc) OnEvent(e Event) {
+	f(e)
+}
+
+// ChannelListener returns a ProgressListener that sends events to ch.
+// EventBytesWritten events are dropped while ch is full so that a slow
+// consumer does not stall the download; all other events are always sent.
+func ChannelListener(ch chan<- Event) ProgressListener {
+	return ProgressListenerFunc(func(e Event) {
+		if e.Type != EventBytesWritten {
+			ch <- e
+			return
+		}
+
+		select {
+		case ch <- e:
+		default:
+		}
+	})
+}
+
+// BarListener renders progress events with a terminal progress bar.
+type BarListener struct {
+	bar    Bar
+	output io.Writer
+}
+
+func NewBarListener(output io.Writer) *BarListener {
+	return &BarListener{
+		bar:    NewBar(),
+		output: output,
+	}
+}
+
+func (l *BarListener) OnEvent(e Event) {
+	switch e.Type {
+	case EventStarted:
+		l.bar.SetOutput(l.output)
+		if e.TotalBytes > 0 {
+			l.bar.SetTotal(e.TotalBytes)
+		}
+		l.bar.Kickoff()
+	case EventBytesWritten:
+		l.bar.Set64(e.BytesWritten)
+	case EventFinished:
+		l.bar.Finish()
+	}
+}
+
+// progress reports the progress of one download to the client's Bar and
+// Progress listener, either of which may be nil.
+type progress struct {
+	bar      bar
+	listener ProgressListener
+
+	mu      sync.Mutex
+	started time.Time
+	total   int64
+	written int64
+
+	// queue holds events waiting to be delivered, and delivering is set
+	// while a goroutine is delivering them.
+	queue      []Event
+	delivering bool
+}
+
+func (c Client) newProgress() *progress {
+	return &progress{
+		bar:      c.Bar,
+		listener: c.Progress,
+		total:    -1,
+	}
+}
+
+// start is called each time a transfer begins. EventStarted is only emitted
+// the first time, as a download may fall back to a single stream.
+func (p *progress) start(output io.Writer, total int64) {
+	if p.bar != nil {
+		p.bar.SetOutput(output)
+		p.bar.SetTotal(total)
+		p.bar.Kickoff()
+	}
+
+	if p.listener == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.total = total
+	if !p.started.IsZero() {
+		p.mu.Unlock()
+		return
+	}
+	p.started = time.Now()
+	p.enqueue(Event{Type: EventStarted})
+	p.mu.Unlock()
+
+	p.deliver()
+}
+
+// reader wraps r, which holds the bytes of the file starting at offset.
+func (p *progress) reader(r io.Reader, offset int64) io.Reader {
+	if p.bar != nil {
+		r = p.bar.NewProxyReader(r)
+	}
+
+	if p.listener == nil {
+		return r
+	}
+
+	return &progressReader{reader: r, progress: p, offset: offset}
+}
+
+func (p *progress) wrote(lower int64, n int64) {
+	if p.listener == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.written += n
+	p.enqueue(Event{
+		Type:  EventBytesWritten,
+		Lower: lower,
+		Upper: lower + n - 1,
+		Delta: n,
+	})
+	p.mu.Unlock()
+
+	p.deliver()
+}
+
+// discard takes back n bytes of the range starting at lower that were
+// reported but will be fetched again.
+func (p *progress) discard(lower int64, n int64) {
+	if n <= 0 {
+		return
+	}
+
+	if p.bar != nil {
+		p.bar.Add(int(-1 * n))
+	}
+
+	if p.listener == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.written -= n
+	p.enqueue(Event{
+		Type:  EventBytesWritten,
+		Lower: lower,
+		Upper: lower + n - 1,
+		Delta: -1 * n,
+	})
+	p.mu.Unlock()
+
+	p.deliver()
+}
+
+func (p *progress) retried(lower int64, upper int64, attempt int, err error) {
+	p.event(Event{
+		Type:    EventRangeRetried,
+		Lower:   lower,
+		Upper:   upper,
+		Attempt: attempt,
+		Err:     err,
+	})
+}
+
+func (p *progress) linkRefreshed() {
+	p.event(Event{Type: EventLinkRefreshed})
+}
+
+func (p *progress) verified() {
+	p.event(Event{Type: EventVerified})
+}
+
+func (p *progress) finishBar() {
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+}
+
+func (p *progress) finish(err error) {
+	p.event(Event{Type: EventFinished, Err: err})
+}
+
+func (p *progress) event(e Event) {
+	if p.listener == nil {
+		return
+	}
+
+	p.mu.Lock()
+	p.enqueue(e)
+	p.mu.Unlock()
+
+	p.deliver()
+}
+
+// enqueue fills in the totals of e and queues it for delivery. p.mu must be
+// held.
+func (p *progress) enqueue(e Event) {
+	e.Time = time.Now()
+	e.TotalBytes = p.total
+	e.BytesWritten = p.written
+
+	elapsed := e.Time.Sub(p.started).Seconds()
+	if elapsed > 0 && p.written > 0 {
+		e.Throughput = float64(p.written) / elapsed
+
+		if p.total > p.written {
+			e.ETA = time.Duration(float64(p.total-p.written) / e.Throughput * float64(time.Second))
+		}
+	}
+
+	p.queue = append(p.queue, e)
+}
+
+// deliver passes queued events to the listener without holding p.mu. If
+// another goroutine is already delivering, it leaves the events to it.
+func (p *progress) deliver() {
+	p.mu.Lock()
+	if p.delivering {
+		p.mu.Unlock()
+		return
+	}
+	p.delivering = true
+
+	for len(p.queue) > 0 {
+		e := p.queue[0]
+		p.queue = p.queue[1:]
+		p.mu.Unlock()
+
+		p.listener.OnEvent(e)
+
+		p.mu.Lock()
+	}
+
+	p.delivering = false
+	p.mu.Unlock()
+}
+
+type progressReader struct {
+	reader   io.Reader
+	progress *progress
+	offset   int64
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if n > 0 {
+		r.progress.wrote(r.offset, int64(n))
+		r.offset += int64(n)
+	}
+
+	return n, err
+}
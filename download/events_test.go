@@ -0,0 +1,242 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Progress events", func() {
+	var (
+		content             []byte
+		server              *httptest.Server
+		failures            int
+		m                   sync.Mutex
+		events              []download.Event
+		downloadLinkFetcher *fakes.DownloadLinkFetcher
+		downloader          download.Client
+		tmpFile             *os.File
+	)
+
+	BeforeEach(func() {
+		content = bytes.Repeat([]byte("progress "), 1000)
+		failures = 0
+		events = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			m.Lock()
+			fail := req.Method == "GET" && failures > 0
+			if fail {
+				failures--
+			}
+			m.Unlock()
+
+			if fail {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+		}))
+
+		downloadLinkFetcher = &fakes.DownloadLinkFetcher{}
+		downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+
+		downloader = download.Client{
+			HTTPClient: &http.Client{},
+			Ranger: download.NewRangerWithConfig(download.RangerConfig{
+				NumHunks:     1,
+				MinChunkSize: 1,
+			}),
+			Workers:     1,
+			RetryPolicy: download.RetryPolicy{InitialBackoff: time.Millisecond},
+			Progress: download.ProgressListenerFunc(func(e download.Event) {
+				events = append(events, e)
+			}),
+		}
+
+		var err error
+		tmpFile, err = ioutil.TempFile("", "")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	})
+
+	eventTypes := func() []download.EventType {
+		var types []download.EventType
+		for _, e := range events {
+			if len(types) == 0 || types[len(types)-1] != e.Type {
+				types = append(types, e.Type)
+			}
+		}
+		return types
+	}
+
+	It("reports the download without a bar", func() {
+		err := downloader.Get(tmpFile, downloadLinkFetcher, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(eventTypes()).To(Equal([]download.EventType{
+			download.EventStarted,
+			download.EventBytesWritten,
+			download.EventFinished,
+		}))
+
+		first := events[0]
+		Expect(first.TotalBytes).To(Equal(int64(len(content))))
+		Expect(first.BytesWritten).To(BeZero())
+
+		last := events[len(events)-1]
+		Expect(last.BytesWritten).To(Equal(int64(len(content))))
+		Expect(last.Err).NotTo(HaveOccurred())
+		Expect(last.Throughput).To(BeNumerically(">", 0))
+		Expect(last.ETA).To(BeZero())
+	})
+
+	Context("when a range fails", func() {
+		BeforeEach(func() {
+			failures = 1
+		})
+
+		It("reports the retry", func() {
+			err := downloader.Get(tmpFile, downloadLinkFetcher, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(eventTypes()).To(Equal([]download.EventType{
+				download.EventStarted,
+				download.EventRangeRetried,
+				download.EventBytesWritten,
+				download.EventFinished,
+			}))
+
+			retried := events[1]
+			Expect(retried.Attempt).To(Equal(1))
+			Expect(retried.Lower).To(Equal(int64(0)))
+			Expect(retried.Upper).To(Equal(int64(len(content) - 1)))
+			Expect(retried.Err).To(MatchError(ContainSubstring("503")))
+		})
+	})
+
+	Describe("GetVerified", func() {
+		It("reports verification before finishing", func() {
+			sum := sha256.Sum256(content)
+
+			err := downloader.GetVerified(context.Background(), tmpFile, downloadLinkFetcher, nil, download.Expected{
+				Size:   int64(len(content)),
+				SHA256: hex.EncodeToString(sum[:]),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			types := eventTypes()
+			Expect(types[len(types)-2:]).To(Equal([]download.EventType{
+				download.EventVerified,
+				download.EventFinished,
+			}))
+		})
+
+		It("finishes with the verification error", func() {
+			err := downloader.GetVerified(context.Background(), tmpFile, downloadLinkFetcher, nil, download.Expected{
+				SHA256: "wrong",
+			})
+			Expect(err).To(BeAssignableToTypeOf(download.ErrChecksumMismatch{}))
+
+			last := events[len(events)-1]
+			Expect(last.Type).To(Equal(download.EventFinished))
+			Expect(last.Err).To(Equal(err))
+		})
+	})
+
+	Context("when the listener blocks", func() {
+		var (
+			release chan struct{}
+		)
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			var once sync.Once
+
+			downloader.Ranger = download.NewRangerWithConfig(download.RangerConfig{
+				NumHunks:     4,
+				MinChunkSize: 1000,
+			})
+			downloader.Workers = 4
+			downloader.Progress = download.ProgressListenerFunc(func(e download.Event) {
+				if e.Type == download.EventBytesWritten {
+					once.Do(func() { <-release })
+				}
+
+				m.Lock()
+				events = append(events, e)
+				m.Unlock()
+			})
+		})
+
+		It("carries on with the other ranges", func() {
+			done := make(chan error, 1)
+			go func() {
+				done <- downloader.Get(tmpFile, downloadLinkFetcher, nil)
+			}()
+
+			written := func() int {
+				contents, err := ioutil.ReadFile(tmpFile.Name())
+				Expect(err).NotTo(HaveOccurred())
+				return len(contents) - bytes.Count(contents, []byte{0})
+			}
+			Eventually(written).Should(BeNumerically(">=", len(content)*3/4))
+			Consistently(done).ShouldNot(Receive())
+
+			close(release)
+			Eventually(done).Should(Receive(BeNil()))
+
+			contents, err := ioutil.ReadFile(tmpFile.Name())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(Equal(content))
+
+			m.Lock()
+			defer m.Unlock()
+			Expect(events[len(events)-1].Type).To(Equal(download.EventFinished))
+			Expect(events[len(events)-1].BytesWritten).To(Equal(int64(len(content))))
+		})
+	})
+
+	Describe("ChannelListener", func() {
+		It("drops byte counts rather than blocking", func() {
+			ch := make(chan download.Event, 1)
+			listener := download.ChannelListener(ch)
+
+			listener.OnEvent(download.Event{Type: download.EventBytesWritten, Delta: 1})
+			listener.OnEvent(download.Event{Type: download.EventBytesWritten, Delta: 2})
+
+			Expect(<-ch).To(Equal(download.Event{Type: download.EventBytesWritten, Delta: 1}))
+
+			go listener.OnEvent(download.Event{Type: download.EventFinished})
+			Eventually(ch).Should(Receive(Equal(download.Event{Type: download.EventFinished})))
+		})
+	})
+
+	Describe("BarListener", func() {
+		It("renders the download", func() {
+			downloader.Progress = download.NewBarListener(GinkgoWriter)
+
+			err := downloader.Get(tmpFile, downloadLinkFetcher, nil)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,205 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// minLimitedRead is the smallest read a limited reader makes, so low rates
+// do not degrade into tiny reads.
+const minLimitedRead = 1024
+
+// Limiter caps the combined throughput of every reader it wraps. A single
+// Limiter may be shared by several Clients to cap all of their downloads
+// together. The zero rate means unlimited.
+type Limiter struct {
+	mu       sync.Mutex
+	rate     int64
+	schedule []RateWindow
+	tokens   float64
+	last     time.Time
+}
+
+// RateWindow overrides a Limiter's rate during a time of day. Start and End
+// are offsets from local midnight; a window with End before Start wraps
+// past midnight.
+type RateWindow struct {
+	Start          time.Duration
+	End            time.Duration
+	BytesPerSecond int64
+}
+
+// ParseRateWindow parses a window such as "09:00-17:30". An end of "24:00"
+// means midnight at the end of the day.
+func ParseRateWindow(window string, bytesPerSecond int64) (RateWindow, error) {
+	var startHour, startMinute, endHour, endMinute int
+
+	_, err := fmt.Sscanf(window, "%d:%d-%d:%d", &startHour, &startMinute, &endHour, &endMinute)
+	if err != nil {
+		return RateWindow{}, fmt.Errorf("invalid rate window %q: expected HH:MM-HH:MM", window)
+	}
+
+	for _, v := range []struct{ value, max int }{
+		{startHour, 23}, {endHour, 24}, {startMinute, 59}, {endMinute, 59},
+	} {
+		if v.value < 0 || v.value > v.max {
+			return RateWindow{}, fmt.Errorf("invalid rate window %q: time out of range", window)
+		}
+	}
+	if endHour == 24 && endMinute != 0 {
+		return RateWindow{}, fmt.Errorf("invalid rate window %q: time out of range", window)
+	}
+
+	return RateWindow{
+		Start:          time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute,
+		End:            time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute,
+		BytesPerSecond: bytesPerSecond,
+	}, nil
+}
+
+func (w RateWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+
+	return offset >= w.Start || offset < w.End
+}
+
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	return &Limiter{rate: bytesPerSecond}
+}
+
+// SetRate changes the rate used outside of any scheduled window. It takes
+// effect for downloads already in progress.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = bytesPerSecond
+	l.clampTokens(l.rateAt(time.Now()))
+}
+
+// SetSchedule replaces the time-of-day windows. The first window containing
+// the current time wins.
+func (l *Limiter) SetSchedule(windows []RateWindow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.schedule = append([]RateWindow(nil), windows...)
+	l.clampTokens(l.rateAt(time.Now()))
+}
+
+// Rate returns the rate in effect at t.
+func (l *Limiter) Rate(t time.Time) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rateAt(t)
+}
+
+func (l *Limiter) rateAt(t time.Time) int64 {
+	for _, w := range l.schedule {
+		if w.contains(t) {
+			return w.BytesPerSecond
+		}
+	}
+
+	return l.rate
+}
+
+func (l *Limiter) clampTokens(rate int64) {
+	if rate > 0 && l.tokens > float64(rate) {
+		l.tokens = float64(rate)
+	}
+}
+
+// WaitN accounts for n bytes and blocks until they fit within the rate or
+// ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	rate := l.rateAt(now)
+
+	if rate <= 0 {
+		l.tokens = 0
+		l.last = now
+		l.mu.Unlock()
+		return nil
+	}
+
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * float64(rate)
+	}
+	l.last = now
+	l.clampTokens(rate)
+
+	l.tokens -= float64(n)
+
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(rate) * float64(time.Second))
+	}
+
+	l.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+
+	return sleep(ctx, delay)
+}
+
+// readSize bounds a single read so that one worker cannot take several
+// seconds' worth of the rate at once.
+func (l *Limiter) readSize(n int) int {
+	rate := l.Rate(time.Now())
+	if rate <= 0 {
+		return n
+	}
+
+	size := int(rate / 10)
+	if size < minLimitedRead {
+		size = minLimitedRead
+	}
+	if size < n {
+		return size
+	}
+
+	return n
+}
+
+// Reader returns a reader whose reads count against the limiter.
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return limitedReader{ctx: ctx, limiter: l, reader: r}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	limiter *Limiter
+	reader  io.Reader
+}
+
+func (r limitedReader) Read(p []byte) (int, error) {
+	p = p[:r.limiter.readSize(len(p))]
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		waitErr := r.limiter.WaitN(r.ctx, n)
+		if waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
@@ -0,0 +1,152 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Limiter", func() {
+	Describe("ParseRateWindow", func() {
+		It("parses a time-of-day window", func() {
+			w, err := download.ParseRateWindow("09:00-17:30", 1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w).To(Equal(download.RateWindow{
+				Start:          9 * time.Hour,
+				End:            17*time.Hour + 30*time.Minute,
+				BytesPerSecond: 1024,
+			}))
+		})
+
+		It("rejects malformed windows", func() {
+			_, err := download.ParseRateWindow("9am-5pm", 1024)
+			Expect(err).To(MatchError(ContainSubstring("expected HH:MM-HH:MM")))
+
+			_, err = download.ParseRateWindow("09:00-25:00", 1024)
+			Expect(err).To(MatchError(ContainSubstring("out of range")))
+		})
+
+		It("allows 24:00 only as the end of a window", func() {
+			w, err := download.ParseRateWindow("18:00-24:00", 1024)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.End).To(Equal(24 * time.Hour))
+
+			_, err = download.ParseRateWindow("18:00-24:59", 1024)
+			Expect(err).To(MatchError(ContainSubstring("out of range")))
+
+			_, err = download.ParseRateWindow("24:00-06:00", 1024)
+			Expect(err).To(MatchError(ContainSubstring("out of range")))
+		})
+	})
+
+	Describe("Rate", func() {
+		It("uses the first matching window and falls back to the base rate", func() {
+			l := download.NewLimiter(100)
+
+			day, err := download.ParseRateWindow("09:00-17:00", 10)
+			Expect(err).NotTo(HaveOccurred())
+			night, err := download.ParseRateWindow("22:00-06:00", 0)
+			Expect(err).NotTo(HaveOccurred())
+			l.SetSchedule([]download.RateWindow{day, night})
+
+			at := func(hour int) time.Time {
+				return time.Date(2018, 1, 1, hour, 0, 0, 0, time.Local)
+			}
+
+			Expect(l.Rate(at(12))).To(Equal(int64(10)))
+			Expect(l.Rate(at(23))).To(Equal(int64(0)))
+			Expect(l.Rate(at(3))).To(Equal(int64(0)))
+			Expect(l.Rate(at(19))).To(Equal(int64(100)))
+
+			l.SetRate(50)
+			Expect(l.Rate(at(19))).To(Equal(int64(50)))
+		})
+	})
+
+	It("limits the throughput of wrapped readers", func() {
+		l := download.NewLimiter(100 * 1024)
+
+		start := time.Now()
+		n, err := io.Copy(ioutil.Discard, l.Reader(context.Background(), bytes.NewReader(make([]byte, 30*1024))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(int64(30 * 1024)))
+
+		Expect(time.Since(start)).To(BeNumerically(">=", 250*time.Millisecond))
+	})
+
+	It("stops limiting when the rate is set to zero", func() {
+		l := download.NewLimiter(1024)
+		l.SetRate(0)
+
+		start := time.Now()
+		_, err := io.Copy(ioutil.Discard, l.Reader(context.Background(), bytes.NewReader(make([]byte, 1024*1024))))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+	})
+
+	It("returns the context error while waiting", func() {
+		l := download.NewLimiter(1)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		err := l.WaitN(ctx, 1024)
+		Expect(err).To(Equal(context.DeadlineExceeded))
+	})
+
+	It("is shared by the range workers of several clients", func() {
+		content := bytes.Repeat([]byte("limit "), 5000)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+		}))
+		defer server.Close()
+
+		l := download.NewLimiter(200 * 1024)
+
+		start := time.Now()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				downloadLinkFetcher := &fakes.DownloadLinkFetcher{}
+				downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+
+				downloader := download.Client{
+					HTTPClient: &http.Client{},
+					Ranger:     download.NewRangerWithConfig(download.RangerConfig{NumHunks: 4, MinChunkSize: 1}),
+					Limiter:    l,
+				}
+
+				tmpFile, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.Remove(tmpFile.Name())
+
+				Expect(downloader.Get(tmpFile, downloadLinkFetcher, nil)).To(Succeed())
+
+				contents, err := ioutil.ReadFile(tmpFile.Name())
+				Expect(err).NotTo(HaveOccurred())
+				Expect(contents).To(Equal(content))
+			}()
+		}
+		wg.Wait()
+
+		// 60000 bytes at 200 KiB/s with an empty bucket
+		Expect(time.Since(start)).To(BeNumerically(">=", 250*time.Millisecond))
+	})
+})
@@ -0,0 +1,230 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultRefreshRate = 500 * time.Millisecond
+
+// MultiProgress renders the progress of several concurrent downloads as one
+// line per active file followed by a line for the combined total. Files that
+// finish are printed once above the active lines.
+type MultiProgress struct {
+	// RefreshRate is how often the display is redrawn after Start.
+	// Defaults to DefaultRefreshRate.
+	RefreshRate time.Duration
+
+	output io.Writer
+
+	mu       sync.Mutex
+	started  time.Time
+	active   []*fileProgress
+	finished []*fileProgress
+	drawn    int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type fileProgress struct {
+	name     string
+	total    int64
+	written  int64
+	rate     float64
+	eta      time.Duration
+	finished bool
+	err      error
+	printed  bool
+}
+
+func NewMultiProgress(output io.Writer) *MultiProgress {
+	return &MultiProgress{
+		output:  output,
+		started: time.Now(),
+	}
+}
+
+// Listener returns a ProgressListener that reports the download of one file
+// under the given name.
+func (m *MultiProgress) Listener(name string) ProgressListener {
+	f := &fileProgress{name: name, total: -1}
+
+	m.mu.Lock()
+	m.active = append(m.active, f)
+	m.mu.Unlock()
+
+	return ProgressListenerFunc(func(e Event) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		f.total = e.TotalBytes
+		f.written = e.BytesWritten
+		f.rate = e.Throughput
+		f.eta = e.ETA
+
+		if e.Type == EventFinished {
+			f.finished = true
+			f.err = e.Err
+			m.retire(f)
+		}
+	})
+}
+
+// Start redraws the display periodically until Stop is called.
+func (m *MultiProgress) Start() {
+	refreshRate := m.RefreshRate
+	if refreshRate <= 0 {
+		refreshRate = DefaultRefreshRate
+	}
+
+	m.stop = make(chan struct{})
+	m.done = make(chan struct{})
+
+	go func() {
+		defer close(m.done)
+
+		ticker := time.NewTicker(refreshRate)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.Render()
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends periodic redrawing and renders the final state.
+func (m *MultiProgress) Stop() {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+		m.stop = nil
+	}
+
+	m.Render()
+}
+
+// Render redraws the display once.
+func (m *MultiProgress) Render() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+
+	if m.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dA", m.drawn)
+	}
+
+	for _, f := range m.finished {
+		if f.printed {
+			continue
+		}
+		f.printed = true
+		fmt.Fprintf(&b, "\033[2K%s\n", f.line())
+	}
+
+	m.drawn = 0
+	for _, f := range m.active {
+		fmt.Fprintf(&b, "\033[2K%s\n", f.line())
+		m.drawn++
+	}
+
+	fmt.Fprintf(&b, "\033[2K%s\n", m.totalLine())
+	m.drawn++
+
+	io.WriteString(m.output, b.String())
+}
+
+// retire moves f from the active to the finished files. m.mu must be held.
+func (m *MultiProgress) retire(f *fileProgress) {
+	for i, a := range m.active {
+		if a == f {
+			m.active = append(m.active[:i], m.active[i+1:]...)
+			break
+		}
+	}
+
+	m.finished = append(m.finished, f)
+}
+
+func (m *MultiProgress) totalLine() string {
+	var total, written int64
+	known := true
+
+	for _, files := range [][]*fileProgress{m.finished, m.active} {
+		for _, f := range files {
+			written += f.written
+			if f.total < 0 {
+				known = false
+			} else {
+				total += f.total
+			}
+		}
+	}
+
+	var rate float64
+	var eta time.Duration
+	if elapsed := time.Since(m.started).Seconds(); elapsed > 0 {
+		rate = float64(written) / elapsed
+	}
+	if known && rate > 0 && total > written && len(m.active) > 0 {
+		eta = time.Duration(float64(total-written) / rate * float64(time.Second))
+	}
+
+	name := fmt.Sprintf("total (%d/%d files)", len(m.finished), len(m.finished)+len(m.active))
+	if !known {
+		total = -1
+	}
+
+	return formatProgressLine(name, total, written, rate, eta)
+}
+
+func (f *fileProgress) line() string {
+	if f.finished {
+		if f.err != nil {
+			return fmt.Sprintf("%s  failed: %s", f.name, f.err)
+		}
+		return fmt.Sprintf("%s  done  %s", f.name, formatBytes(f.written))
+	}
+
+	return formatProgressLine(f.name, f.total, f.written, f.rate, f.eta)
+}
+
+func formatProgressLine(name string, total int64, written int64, rate float64, eta time.Duration) string {
+	percent := "   ?%"
+	size := formatBytes(written)
+	if total > 0 {
+		percent = fmt.Sprintf("%4.0f%%", float64(written)/float64(total)*100)
+		size = fmt.Sprintf("%s/%s", formatBytes(written), formatBytes(total))
+	}
+
+	line := fmt.Sprintf("%s  %s  %s  %s/s", name, percent, size, formatBytes(int64(rate)))
+	if eta > 0 {
+		line += fmt.Sprintf("  ETA %s", eta.Truncate(time.Second))
+	}
+
+	return line
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,114 @@
+package download_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MultiProgress", func() {
+	var (
+		output *bytes.Buffer
+		multi  *download.MultiProgress
+	)
+
+	BeforeEach(func() {
+		output = &bytes.Buffer{}
+		multi = download.NewMultiProgress(output)
+	})
+
+	It("shows a line per active file and a total", func() {
+		a := multi.Listener("a.tgz")
+		b := multi.Listener("b.tgz")
+
+		a.OnEvent(download.Event{Type: download.EventBytesWritten, TotalBytes: 2048, BytesWritten: 1024, Throughput: 512, ETA: 2 * time.Second})
+		b.OnEvent(download.Event{Type: download.EventBytesWritten, TotalBytes: 1024, BytesWritten: 0})
+
+		multi.Render()
+
+		Expect(output.String()).To(ContainSubstring("a.tgz    50%  1.0 KiB/2.0 KiB  512 B/s  ETA 2s"))
+		Expect(output.String()).To(ContainSubstring("b.tgz     0%  0 B/1.0 KiB"))
+		Expect(output.String()).To(ContainSubstring("total (0/2 files)    33%  1.0 KiB/3.0 KiB"))
+	})
+
+	It("prints finished files once and redraws the active lines", func() {
+		a := multi.Listener("a.tgz")
+		b := multi.Listener("b.tgz")
+
+		multi.Render()
+		output.Reset()
+
+		a.OnEvent(download.Event{Type: download.EventFinished, TotalBytes: 10, BytesWritten: 10})
+		b.OnEvent(download.Event{Type: download.EventFinished, Err: errors.New("boom")})
+		multi.Render()
+
+		Expect(output.String()).To(HavePrefix("\033[3A"))
+		Expect(output.String()).To(ContainSubstring("a.tgz  done  10 B"))
+		Expect(output.String()).To(ContainSubstring("b.tgz  failed: boom"))
+		Expect(output.String()).To(ContainSubstring("total (2/2 files)"))
+
+		output.Reset()
+		multi.Render()
+		Expect(output.String()).NotTo(ContainSubstring("a.tgz"))
+	})
+
+	It("aggregates concurrent downloads", func() {
+		content := bytes.Repeat([]byte("multi "), 10000)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+		}))
+		defer server.Close()
+
+		multi.RefreshRate = time.Millisecond
+		multi.Start()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			name := fmt.Sprintf("file-%d", i)
+			listener := multi.Listener(name)
+
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				downloadLinkFetcher := &fakes.DownloadLinkFetcher{}
+				downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+
+				downloader := download.Client{
+					HTTPClient: &http.Client{},
+					Ranger:     download.NewRangerWithConfig(download.RangerConfig{NumHunks: 4, MinChunkSize: 1}),
+					Progress:   listener,
+				}
+
+				tmpFile, err := ioutil.TempFile("", "")
+				Expect(err).NotTo(HaveOccurred())
+				defer os.Remove(tmpFile.Name())
+
+				Expect(downloader.Get(tmpFile, downloadLinkFetcher, nil)).To(Succeed())
+			}()
+		}
+		wg.Wait()
+
+		multi.Stop()
+
+		lines := strings.Split(output.String(), "\n")
+		Expect(lines[len(lines)-2]).To(ContainSubstring("total (3/3 files)   100%"))
+		for i := 0; i < 3; i++ {
+			Expect(strings.Count(output.String(), fmt.Sprintf("file-%d  done", i))).To(Equal(1))
+		}
+	})
+})
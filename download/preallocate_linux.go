@@ -0,0 +1,18 @@
+package download
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func preallocate(f *os.File, size int64) error {
+	err := unix.Fallocate(int(f.Fd()), 0, 0, size)
+	if err == unix.EOPNOTSUPP || err == unix.ENOSYS {
+		// Not every filesystem supports fallocate; extending the file
+		// still lets the ranges be written in any order.
+		return f.Truncate(size)
+	}
+
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package download
+
+import "os"
+
+func preallocate(f *os.File, size int64) error {
+	return f.Truncate(size)
+}
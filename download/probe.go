@@ -0,0 +1,262 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+// errRangesUnsupported is returned when a server answers a range request
+// with the whole file.
+var errRangesUnsupported = errors.New("server does not support range requests")
+
+// contentInfo describes a remote file as discovered by inspect.
+type contentInfo struct {
+	url string
+
+	// contentLength is -1 when the server does not report it.
+	contentLength int64
+
+	acceptsRanges bool
+
+	// body is set when the probe already returned the whole file, so it
+	// can be streamed without another request.
+	body io.ReadCloser
+}
+
+// inspect discovers the size of the file at contentURL and whether it can be
+// fetched in ranges. It prefers a HEAD request and falls back to probing
+// with a single-byte range request when HEAD is rejected or inconclusive.
+func (c Client) inspect(ctx context.Context, contentURL string) (contentInfo, error) {
+	req, err := http.NewRequest("HEAD", contentURL, nil)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("failed to construct HEAD request: %s", err)
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("failed to make HEAD request: %s", err)
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		contentURL = resp.Request.URL.String()
+	}
+
+	if resp.StatusCode < http.StatusBadRequest && resp.ContentLength >= 0 {
+		return contentInfo{
+			url:           contentURL,
+			contentLength: resp.ContentLength,
+			acceptsRanges: true,
+		}, nil
+	}
+
+	c.debug("HEAD request inconclusive, probing with a range request", logger.Data{
+		"statusCode":    resp.StatusCode,
+		"contentLength": resp.ContentLength,
+	})
+
+	return c.probe(ctx, contentURL)
+}
+
+func (c Client) probe(ctx context.Context, contentURL string) (contentInfo, error) {
+	req, err := http.NewRequest("GET", contentURL, nil)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("failed to construct probe request: %s", err)
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Add("Range", formatRange(0, 0))
+	req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return contentInfo{}, fmt.Errorf("failed to make probe request: %s", err)
+	}
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		contentURL = resp.Request.URL.String()
+	}
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		resp.Body.Close()
+
+		contentLength := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+		return contentInfo{
+			url:           contentURL,
+			contentLength: contentLength,
+			acceptsRanges: contentLength >= 0,
+		}, nil
+	case http.StatusOK:
+		return contentInfo{
+			url:           contentURL,
+			contentLength: resp.ContentLength,
+			body:          resp.Body,
+		}, nil
+	default:
+		resp.Body.Close()
+		return contentInfo{}, fmt.Errorf("during probe unexpected status code was returned: %d", resp.StatusCode)
+	}
+}
+
+// parseContentRangeTotal returns the complete length from a Content-Range
+// header such as "bytes 0-0/1234", or -1 when it is unknown.
+func parseContentRangeTotal(contentRange string) int64 {
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1
+	}
+
+	total, err := strconv.ParseInt(strings.TrimSpace(contentRange[i+1:]), 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return total
+}
+
+// getStream downloads the file in a single request. It is used when the
+// server does not support ranges or the content length is unknown. Failed
+// requests are retried within the same policy and budget as ranges.
+func (c Client) getStream(
+	ctx context.Context,
+	location *os.File,
+	info contentInfo,
+	downloadLinkFetcher downloadLinkFetcher,
+	progressWriter io.Writer,
+	policy RetryPolicy,
+	budget *retryBudget,
+	p *progress,
+) error {
+	c.debug("downloading file in a single stream", logger.Data{"contentLength": info.contentLength})
+
+	if info.contentLength > 0 {
+		err := checkDiskSpace(location, info.contentLength)
+		if err != nil {
+			return err
+		}
+	}
+
+	total := info.contentLength
+	if total < 0 {
+		total = 0
+	}
+
+	p.start(progressWriter, total)
+	defer p.finishBar()
+
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
+
+	upper := UnknownUpper
+	if info.contentLength >= 0 {
+		upper = info.contentLength - 1
+	}
+
+	currentURL := info.url
+	body := info.body
+
+	for attempt := 1; ; attempt++ {
+		bytesWritten, err := c.requestStream(ctx, currentURL, body, info.contentLength, location, *buf, p)
+		body = nil
+		if err == nil {
+			err = location.Truncate(bytesWritten)
+			if err != nil {
+				return fmt.Errorf("failed to truncate output file: %s", err)
+			}
+
+			return nil
+		}
+
+		p.discard(0, bytesWritten)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !isRetryable(err) || attempt >= policy.MaxAttempts || !budget.take() {
+			return ErrRangesFailed{Failures: []RangeFailure{{
+				Lower:    0,
+				Upper:    upper,
+				Attempts: attempt,
+				Err:      err,
+			}}}
+		}
+
+		p.retried(0, upper, attempt, err)
+
+		if sc, ok := err.(statusCodeError); ok && sc.statusCode == http.StatusForbidden {
+			currentURL, err = downloadLinkFetcher.NewDownloadLink()
+			if err != nil {
+				return err
+			}
+			p.linkRefreshed()
+
+			continue
+		}
+
+		err = sleep(ctx, policy.Backoff(attempt))
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c Client) requestStream(
+	ctx context.Context,
+	currentURL string,
+	body io.ReadCloser,
+	contentLength int64,
+	location io.WriterAt,
+	buf []byte,
+	p *progress,
+) (int64, error) {
+	if body == nil {
+		req, err := http.NewRequest("GET", currentURL, nil)
+		if err != nil {
+			return 0, err
+		}
+		req = req.WithContext(ctx)
+
+		req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
+
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return 0, wrappedError{message: "download request failed", err: err}
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, statusCodeError{statusCode: resp.StatusCode}
+		}
+
+		body = resp.Body
+	}
+	defer body.Close()
+
+	fileWriter := &offsetWriter{writerAt: location}
+
+	bytesWritten, err := io.CopyBuffer(fileWriter, p.reader(c.Limiter.Reader(ctx, body), 0), buf)
+	if err != nil {
+		return bytesWritten, wrappedError{message: "failed to write file during io.Copy", err: err}
+	}
+
+	if contentLength >= 0 && bytesWritten != contentLength {
+		return bytesWritten, io.ErrUnexpectedEOF
+	}
+
+	return bytesWritten, nil
+}
@@ -0,0 +1,207 @@
+package download_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// unknownUpper and rangeFailures are declared here, where the download
+// package is not shadowed by the download helper below.
+var unknownUpper = download.UnknownUpper
+
+func rangeFailures(err error) []download.RangeFailure {
+	rangesFailed, ok := err.(download.ErrRangesFailed)
+	Expect(ok).To(BeTrue(), "expected ErrRangesFailed, got %T", err)
+
+	return rangesFailed.Failures
+}
+
+var _ = Describe("Downloader fallbacks", func() {
+	var (
+		content             []byte
+		server              *httptest.Server
+		handler             http.HandlerFunc
+		requests            []string
+		m                   sync.Mutex
+		bar                 *fakes.Bar
+		downloadLinkFetcher *fakes.DownloadLinkFetcher
+		downloader          download.Client
+	)
+
+	BeforeEach(func() {
+		content = bytes.Repeat([]byte("fallback "), 1000)
+		requests = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			m.Lock()
+			requests = append(requests, req.Method+" "+req.Header.Get("Range"))
+			m.Unlock()
+
+			handler(w, req)
+		}))
+
+		bar = &fakes.Bar{}
+		bar.NewProxyReaderStub = func(reader io.Reader) io.Reader { return reader }
+
+		downloadLinkFetcher = &fakes.DownloadLinkFetcher{}
+		downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+
+		downloader = download.Client{
+			HTTPClient: &http.Client{},
+			Ranger: download.NewRangerWithConfig(download.RangerConfig{
+				NumHunks:     4,
+				MinChunkSize: 1000,
+			}),
+			Bar: bar,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	download := func() []byte {
+		tmpFile, err := ioutil.TempFile("", "")
+		Expect(err).NotTo(HaveOccurred())
+
+		err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents, err := ioutil.ReadFile(tmpFile.Name())
+		Expect(err).NotTo(HaveOccurred())
+
+		return contents
+	}
+
+	Context("when the server rejects HEAD requests", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == "HEAD" {
+					w.WriteHeader(http.StatusMethodNotAllowed)
+					return
+				}
+
+				http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(content))
+			}
+		})
+
+		It("probes with a single byte range and downloads in ranges", func() {
+			Expect(download()).To(Equal(content))
+
+			Expect(requests).To(ContainElement("GET bytes=0-0"))
+			Expect(requests).To(ContainElement("GET bytes=2250-4499"))
+			Expect(bar.SetTotalArgsForCall(0)).To(Equal(int64(len(content))))
+		})
+	})
+
+	Context("when the server ignores range requests", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.Header().Set("Content-Length", "9000")
+				w.WriteHeader(http.StatusOK)
+				if req.Method == "GET" {
+					w.Write(content)
+				}
+			}
+		})
+
+		It("falls back to downloading the file in a single stream", func() {
+			Expect(download()).To(Equal(content))
+
+			Expect(requests).To(ContainElement("GET "))
+		})
+	})
+
+	Context("when the server does not report a content length", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				if req.Method == "HEAD" {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+
+				w.WriteHeader(http.StatusOK)
+				for _, chunk := range strings.SplitAfter(string(content), " ") {
+					io.WriteString(w, chunk)
+					w.(http.Flusher).Flush()
+				}
+			}
+		})
+
+		It("streams the response from the probe request", func() {
+			Expect(download()).To(Equal(content))
+
+			Expect(requests).To(Equal([]string{"HEAD ", "GET bytes=0-0"}))
+			Expect(bar.SetTotalArgsForCall(0)).To(Equal(int64(0)))
+		})
+	})
+
+	Context("when a stream of unknown length keeps failing", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				switch {
+				case req.Method == "HEAD":
+					w.WriteHeader(http.StatusOK)
+				case req.Header.Get("Range") != "":
+					w.WriteHeader(http.StatusOK)
+					io.WriteString(w, "partial")
+					w.(http.Flusher).Flush()
+
+					conn, _, err := w.(http.Hijacker).Hijack()
+					Expect(err).NotTo(HaveOccurred())
+					conn.Close()
+				default:
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}
+
+			downloader.RetryPolicy.MaxRetries = 1
+			downloader.RetryPolicy.InitialBackoff = time.Millisecond
+		})
+
+		It("retries within the budget and reports the range as unbounded", func() {
+			tmpFile, err := ioutil.TempFile("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+			Expect(err).To(HaveOccurred())
+
+			failures := rangeFailures(err)
+			Expect(failures).To(HaveLen(1))
+			Expect(failures[0].Lower).To(Equal(int64(0)))
+			Expect(failures[0].Upper).To(Equal(unknownUpper))
+			Expect(failures[0].Attempts).To(Equal(2))
+			Expect(err.Error()).To(ContainSubstring("bytes=0- after 2 attempt(s)"))
+
+			Expect(requests).To(Equal([]string{"HEAD ", "GET bytes=0-0", "GET "}))
+		})
+	})
+
+	Context("when the probe request fails", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		})
+
+		It("returns an error", func() {
+			tmpFile, err := ioutil.TempFile("", "")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = downloader.Get(tmpFile, downloadLinkFetcher, GinkgoWriter)
+			Expect(err).To(MatchError("during probe unexpected status code was returned: 404"))
+		})
+	})
+})
@@ -6,22 +6,40 @@ import (
 	"net/http"
 )
 
+const (
+	DefaultMinChunkSize = 1024 * 1024
+	DefaultMaxChunkSize = 128 * 1024 * 1024
+)
+
 type Range struct {
 	Lower      int64
 	Upper      int64
 	HTTPHeader http.Header
 }
 
-func NewRange(lower int64, upper int64, httpHeader http.Header) (Range){
-	return Range {
-		 lower,
-		 upper,
+func NewRange(lower int64, upper int64, httpHeader http.Header) Range {
+	return Range{
+		lower,
+		upper,
 		httpHeader,
 	}
 }
 
+type RangerConfig struct {
+	// NumHunks is the number of ranges a file is split into before the
+	// chunk size limits are applied.
+	NumHunks int
+
+	// MinChunkSize and MaxChunkSize bound the size of each range.
+	// A value of zero leaves the bound unset.
+	MinChunkSize int64
+	MaxChunkSize int64
+}
+
 type Ranger struct {
-	numHunks int
+	numHunks     int
+	minChunkSize int64
+	maxChunkSize int64
 }
 
 func NewRanger(hunks int) Ranger {
@@ -30,6 +48,14 @@ func NewRanger(hunks int) Ranger {
 	}
 }
 
+func NewRangerWithConfig(config RangerConfig) Ranger {
+	return Ranger{
+		numHunks:     config.NumHunks,
+		minChunkSize: config.MinChunkSize,
+		maxChunkSize: config.MaxChunkSize,
+	}
+}
+
 func (r Ranger) BuildRange(contentLength int64) ([]Range, error) {
 	var ranges []Range
 
@@ -37,27 +63,56 @@ func (r Ranger) BuildRange(contentLength int64) ([]Range, error) {
 		return ranges, errors.New("content length cannot be zero")
 	}
 
-	hunkSize := contentLength / int64(r.numHunks)
+	numHunks := r.numHunks
+	if numHunks < 1 {
+		numHunks = 1
+	}
+
+	hunkSize := contentLength / int64(numHunks)
+	if r.minChunkSize > 0 && hunkSize < r.minChunkSize {
+		hunkSize = r.minChunkSize
+	}
+	if r.maxChunkSize > 0 && hunkSize > r.maxChunkSize {
+		hunkSize = r.maxChunkSize
+	}
 	if hunkSize == 0 {
 		hunkSize = 2
 	}
+	if hunkSize > contentLength {
+		hunkSize = contentLength
+	}
 
 	iterations := (contentLength / hunkSize)
 	remainder := contentLength % int64(hunkSize)
 
+	// Folding the remainder into the last range must not exceed the
+	// maximum chunk size, so it becomes a range of its own instead.
+	separateRemainder := r.maxChunkSize > 0 && remainder > 0 && hunkSize+remainder > r.maxChunkSize
+
 	for i := int64(0); i < int64(iterations); i++ {
 		lowerByte := i * hunkSize
 		upperByte := ((i + 1) * hunkSize) - 1
-		if i == int64(iterations-1) {
+		if i == int64(iterations-1) && !separateRemainder {
 			upperByte += remainder
 		}
-		formattedBytes := fmt.Sprintf("bytes=%d-%d", lowerByte, upperByte)
-		ranges = append(ranges, Range{
-			Lower:      lowerByte,
-			Upper:      upperByte,
-			HTTPHeader: http.Header{"Range": []string{formattedBytes}},
-		})
+		ranges = append(ranges, newRange(lowerByte, upperByte))
+	}
+
+	if separateRemainder {
+		ranges = append(ranges, newRange(iterations*hunkSize, contentLength-1))
 	}
 
 	return ranges, nil
 }
+
+func newRange(lower int64, upper int64) Range {
+	return Range{
+		Lower:      lower,
+		Upper:      upper,
+		HTTPHeader: http.Header{"Range": []string{formatRange(lower, upper)}},
+	}
+}
+
+func formatRange(lower int64, upper int64) string {
+	return fmt.Sprintf("bytes=%d-%d", lower, upper)
+}
@@ -95,6 +95,57 @@ var _ = Describe("BuildRange", func() {
 		})
 	})
 
+	Context("when chunk size limits are configured", func() {
+		var cr download.Ranger
+
+		BeforeEach(func() {
+			cr = download.NewRangerWithConfig(download.RangerConfig{
+				NumHunks:     10,
+				MinChunkSize: 30,
+				MaxChunkSize: 40,
+			})
+		})
+
+		It("does not build ranges smaller than the minimum chunk size", func() {
+			r, err := cr.BuildRange(int64(100))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r).To(Equal([]download.Range{
+				{Lower: 0, Upper: 29, HTTPHeader: http.Header{"Range": []string{"bytes=0-29"}}},
+				{Lower: 30, Upper: 59, HTTPHeader: http.Header{"Range": []string{"bytes=30-59"}}},
+				{Lower: 60, Upper: 99, HTTPHeader: http.Header{"Range": []string{"bytes=60-99"}}},
+			}))
+		})
+
+		It("returns a single range when the content is smaller than the minimum chunk size", func() {
+			r, err := cr.BuildRange(int64(5))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r).To(Equal([]download.Range{
+				{Lower: 0, Upper: 4, HTTPHeader: http.Header{"Range": []string{"bytes=0-4"}}},
+			}))
+		})
+
+		It("does not build ranges larger than the maximum chunk size", func() {
+			r, err := cr.BuildRange(int64(1000))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r).To(HaveLen(25))
+			for _, byteRange := range r {
+				Expect(byteRange.Upper - byteRange.Lower + 1).To(Equal(int64(40)))
+			}
+		})
+
+		It("puts a remainder that would exceed the maximum into its own range", func() {
+			r, err := cr.BuildRange(int64(810))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(r).To(HaveLen(21))
+			Expect(r[19]).To(Equal(download.Range{Lower: 760, Upper: 799, HTTPHeader: http.Header{"Range": []string{"bytes=760-799"}}}))
+			Expect(r[20]).To(Equal(download.Range{Lower: 800, Upper: 809, HTTPHeader: http.Header{"Range": []string{"bytes=800-809"}}}))
+		})
+	})
+
 	Context("when an error occurs", func() {
 		Context("when the content length is zero", func() {
 			var cr download.Ranger
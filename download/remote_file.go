@@ -0,0 +1,153 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+const remoteFileBlockSize = 256 * 1024
+
+// RemoteFile provides random access to a remote file by issuing HTTP range
+// requests. It implements io.ReaderAt so that formats with a trailing index,
+// such as zip archives, can be inspected without downloading the whole file.
+type RemoteFile struct {
+	httpClient          httpClient
+	downloadLinkFetcher downloadLinkFetcher
+
+	mu    sync.Mutex
+	url   string
+	size  int64
+	block []byte
+	start int64
+}
+
+func NewRemoteFile(
+	httpClient httpClient,
+	downloadLinkFetcher downloadLinkFetcher,
+) (*RemoteFile, error) {
+	contentURL, err := downloadLinkFetcher.NewDownloadLink()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("HEAD", contentURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct HEAD request: %s", err)
+	}
+
+	req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make HEAD request: %s", err)
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("during HEAD unexpected status code was returned: %d", resp.StatusCode)
+	}
+
+	if resp.ContentLength < 0 {
+		return nil, fmt.Errorf("remote file did not report a content length")
+	}
+
+	if resp.Request != nil && resp.Request.URL != nil {
+		contentURL = resp.Request.URL.String()
+	}
+
+	return &RemoteFile{
+		httpClient:          httpClient,
+		downloadLinkFetcher: downloadLinkFetcher,
+		url:                 contentURL,
+		size:                resp.ContentLength,
+	}, nil
+}
+
+func (r *RemoteFile) Size() int64 {
+	return r.size
+}
+
+func (r *RemoteFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset: %d", off)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+
+		if r.block == nil || pos < r.start || pos >= r.start+int64(len(r.block)) {
+			err := r.fetchBlock(pos)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		n += copy(p[n:], r.block[pos-r.start:])
+	}
+
+	return n, nil
+}
+
+func (r *RemoteFile) fetchBlock(pos int64) error {
+	start := pos - pos%remoteFileBlockSize
+	end := start + remoteFileBlockSize - 1
+	if end >= r.size {
+		end = r.size - 1
+	}
+
+	refreshed := false
+	for {
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Add("Referer", "https://go-pivnet.network.pivotal.io")
+		req.Header.Add("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+		resp, err := r.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("range request failed: %s", err)
+		}
+
+		if resp.StatusCode == http.StatusForbidden && !refreshed {
+			resp.Body.Close()
+
+			r.url, err = r.downloadLinkFetcher.NewDownloadLink()
+			if err != nil {
+				return err
+			}
+
+			refreshed = true
+			continue
+		}
+
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return fmt.Errorf("during GET unexpected status code was returned: %d", resp.StatusCode)
+		}
+
+		block := make([]byte, end-start+1)
+		_, err = io.ReadFull(resp.Body, block)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read range: %s", err)
+		}
+
+		r.block = block
+		r.start = start
+
+		return nil
+	}
+}
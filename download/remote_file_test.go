@@ -0,0 +1,126 @@
+package download_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/download/fakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RemoteFile", func() {
+	var (
+		server              *httptest.Server
+		contents            []byte
+		rangeRequests       []string
+		m                   sync.Mutex
+		forbidden           bool
+		downloadLinkFetcher *fakes.DownloadLinkFetcher
+	)
+
+	BeforeEach(func() {
+		contents = bytes.Repeat([]byte("0123456789"), 100000)
+		rangeRequests = nil
+		forbidden = false
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			m.Lock()
+			if req.Method == "GET" {
+				rangeRequests = append(rangeRequests, req.Header.Get("Range"))
+			}
+			isForbidden := forbidden && req.Method == "GET" && req.URL.Path == "/expired"
+			m.Unlock()
+
+			if isForbidden {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			http.ServeContent(w, req, "file", time.Time{}, bytes.NewReader(contents))
+		}))
+
+		downloadLinkFetcher = &fakes.DownloadLinkFetcher{}
+		downloadLinkFetcher.NewDownloadLinkReturns(server.URL+"/file", nil)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("reads arbitrary sections of the remote file", func() {
+		rf, err := download.NewRemoteFile(http.DefaultClient, downloadLinkFetcher)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rf.Size()).To(Equal(int64(len(contents))))
+
+		p := make([]byte, 20)
+		n, err := rf.ReadAt(p, 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(20))
+		Expect(p).To(Equal(contents[5:25]))
+
+		n, err = rf.ReadAt(p, int64(len(contents)-10))
+		Expect(err).To(Equal(io.EOF))
+		Expect(n).To(Equal(10))
+		Expect(p[:10]).To(Equal(contents[len(contents)-10:]))
+
+		Expect(rangeRequests).To(HaveLen(2))
+		for _, r := range rangeRequests {
+			Expect(strings.HasPrefix(r, "bytes=")).To(BeTrue())
+		}
+	})
+
+	It("serves reads within the same block without another request", func() {
+		rf, err := download.NewRemoteFile(http.DefaultClient, downloadLinkFetcher)
+		Expect(err).NotTo(HaveOccurred())
+
+		p := make([]byte, 10)
+		_, err = rf.ReadAt(p, 0)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = rf.ReadAt(p, 100)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rangeRequests).To(HaveLen(1))
+	})
+
+	Context("when the download link has expired", func() {
+		BeforeEach(func() {
+			forbidden = true
+			links := []string{server.URL + "/expired", server.URL + "/file"}
+			downloadLinkFetcher.NewDownloadLinkStub = func() (string, error) {
+				link := links[0]
+				links = links[1:]
+				return link, nil
+			}
+		})
+
+		It("fetches a new link and retries", func() {
+			rf, err := download.NewRemoteFile(http.DefaultClient, downloadLinkFetcher)
+			Expect(err).NotTo(HaveOccurred())
+
+			p := make([]byte, 10)
+			_, err = rf.ReadAt(p, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(Equal(contents[:10]))
+
+			Expect(downloadLinkFetcher.NewDownloadLinkCallCount()).To(Equal(2))
+		})
+	})
+
+	Context("when the HEAD request fails", func() {
+		It("returns an error", func() {
+			downloadLinkFetcher.NewDownloadLinkReturns("%%%", nil)
+
+			_, err := download.NewRemoteFile(http.DefaultClient, downloadLinkFetcher)
+			Expect(err).To(MatchError(ContainSubstring("failed to construct HEAD request")))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package download
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy bounds how often and how quickly failed range requests are
+// retried. Zero fields take their value from DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a single range is requested
+	// before it is reported as failed.
+	MaxAttempts int
+
+	// MaxRetries is the total number of retries shared by all ranges of
+	// a download.
+	MaxRetries int
+
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	// Jitter is the fraction of each backoff that is randomized,
+	// between 0 and 1.
+	Jitter float64
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    5,
+		MaxRetries:     50,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.5,
+	}
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	d := DefaultRetryPolicy()
+
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.MaxRetries <= 0 {
+		p.MaxRetries = d.MaxRetries
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = d.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = d.MaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = d.Multiplier
+	}
+	if p.Jitter <= 0 || p.Jitter > 1 {
+		p.Jitter = d.Jitter
+	}
+
+	return p
+}
+
+// Backoff returns the delay before the given retry, counting from one.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	p = p.withDefaults()
+
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+
+	backoff -= backoff * p.Jitter * rand.Float64()
+
+	return time.Duration(backoff)
+}
+
+// retryBudget is the number of retries remaining for a whole download.
+type retryBudget struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.remaining <= 0 {
+		return false
+	}
+
+	b.remaining--
+	return true
+}
+
+type wrappedError struct {
+	message string
+	err     error
+}
+
+func (e wrappedError) Error() string {
+	return fmt.Sprintf("%s: %s", e.message, e.err)
+}
+
+type statusCodeError struct {
+	statusCode int
+}
+
+func (e statusCodeError) Error() string {
+	return fmt.Sprintf("during GET unexpected status code was returned: %d", e.statusCode)
+}
+
+// isRetryable reports whether a failed range request may succeed if it is
+// attempted again.
+func isRetryable(err error) bool {
+	if w, ok := err.(wrappedError); ok {
+		err = w.err
+	}
+
+	if err == io.ErrUnexpectedEOF {
+		return true
+	}
+
+	switch e := err.(type) {
+	case statusCodeError:
+		return e.statusCode == http.StatusForbidden ||
+			e.statusCode == http.StatusRequestTimeout ||
+			e.statusCode == http.StatusTooManyRequests ||
+			e.statusCode >= http.StatusInternalServerError
+	case net.Error:
+		if e.Timeout() || e.Temporary() {
+			return true
+		}
+	}
+
+	cause := rootCause(err)
+	if cause == syscall.ECONNRESET || cause == syscall.EPIPE || cause == syscall.ECONNREFUSED {
+		return true
+	}
+
+	return strings.Contains(cause.Error(), syscall.ECONNRESET.Error())
+}
+
+func rootCause(err error) error {
+	for {
+		var cause error
+		switch e := err.(type) {
+		case *url.Error:
+			cause = e.Err
+		case *net.OpError:
+			cause = e.Err
+		case *os.SyscallError:
+			cause = e.Err
+		}
+
+		if cause == nil {
+			return err
+		}
+
+		err = cause
+	}
+}
+
+// UnknownUpper is the Upper of a range that runs to the end of a file of
+// unknown length.
+const UnknownUpper int64 = math.MaxInt64
+
+type RangeFailure struct {
+	Lower int64
+
+	// Upper is UnknownUpper when the file was streamed without a known
+	// length.
+	Upper    int64
+	Attempts int
+	Err      error
+}
+
+func (f RangeFailure) String() string {
+	if f.Upper == UnknownUpper {
+		return fmt.Sprintf("bytes=%d-", f.Lower)
+	}
+	return formatRange(f.Lower, f.Upper)
+}
+
+// ErrRangesFailed is returned when one or more ranges could not be
+// downloaded within the retry policy.
+type ErrRangesFailed struct {
+	Failures []RangeFailure
+}
+
+func (e ErrRangesFailed) Error() string {
+	var failures []string
+	for _, f := range e.Failures {
+		failures = append(failures, fmt.Sprintf(
+			"%s after %d attempt(s): %s",
+			f,
+			f.Attempts,
+			f.Err,
+		))
+	}
+
+	return fmt.Sprintf(
+		"failed to download %d range(s): %s",
+		len(e.Failures),
+		strings.Join(failures, "; "),
+	)
+}
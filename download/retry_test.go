@@ -0,0 +1,45 @@
+package download_test
+
+import (
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RetryPolicy", func() {
+	Describe("Backoff", func() {
+		var policy download.RetryPolicy
+
+		BeforeEach(func() {
+			policy = download.RetryPolicy{
+				InitialBackoff: 100 * time.Millisecond,
+				MaxBackoff:     time.Second,
+				Multiplier:     2,
+				Jitter:         0.5,
+			}
+		})
+
+		It("grows exponentially within the jitter", func() {
+			Expect(policy.Backoff(1)).To(BeNumerically("~", 75*time.Millisecond, 25*time.Millisecond))
+			Expect(policy.Backoff(2)).To(BeNumerically("~", 150*time.Millisecond, 50*time.Millisecond))
+			Expect(policy.Backoff(3)).To(BeNumerically("~", 300*time.Millisecond, 100*time.Millisecond))
+		})
+
+		It("never exceeds the maximum backoff", func() {
+			for i := 1; i < 20; i++ {
+				Expect(policy.Backoff(i)).To(BeNumerically("<=", time.Second))
+			}
+		})
+
+		Context("when the policy is empty", func() {
+			It("uses the default policy", func() {
+				backoff := download.RetryPolicy{}.Backoff(1)
+				Expect(backoff).To(BeNumerically("<=", download.DefaultRetryPolicy().InitialBackoff))
+				Expect(backoff).To(BeNumerically(">", 0))
+			})
+		})
+	})
+})
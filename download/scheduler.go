@@ -0,0 +1,226 @@
+package download
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// work is a byte range being downloaded by a single worker. Its upper bound
+// may shrink while it is in flight when an idle worker steals its tail.
+type work struct {
+	lower   int64
+	next    int64
+	upper   int64
+	started time.Time
+}
+
+// scheduler hands out ranges to a pool of workers. Once every planned range
+// has been handed out, idle workers split the remaining portion of the range
+// expected to finish last rather than sitting idle. A range is only split
+// once it has been read from, so that its throughput is known; until then,
+// idle workers wait.
+type scheduler struct {
+	mu           sync.Mutex
+	changed      *sync.Cond
+	pending      []*work
+	active       []*work
+	minSplitSize int64
+	aborted      bool
+}
+
+func newScheduler(ranges []Range, minSplitSize int64) *scheduler {
+	s := &scheduler{minSplitSize: minSplitSize}
+	s.changed = sync.NewCond(&s.mu)
+	for _, r := range ranges {
+		s.pending = append(s.pending, &work{
+			lower: r.Lower,
+			next:  r.Lower,
+			upper: r.Upper,
+		})
+	}
+
+	return s
+}
+
+// next returns the work to perform or nil when nothing is left to do. It
+// blocks while the only ranges that could be split have not been read from
+// yet.
+func (s *scheduler) next() *work {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if s.aborted {
+			return nil
+		}
+
+		now := time.Now()
+
+		if len(s.pending) > 0 {
+			w := s.pending[0]
+			s.pending = s.pending[1:]
+			w.started = now
+			s.active = append(s.active, w)
+			return w
+		}
+
+		victim, unsampled := s.slowest(now)
+		if victim != nil {
+			return s.split(victim, now)
+		}
+		if !unsampled {
+			return nil
+		}
+
+		s.changed.Wait()
+	}
+}
+
+// split hands the second half of what remains of victim to a new work.
+func (s *scheduler) split(victim *work, now time.Time) *work {
+	remaining := victim.upper - victim.next + 1
+	split := victim.next + remaining/2
+
+	w := &work{
+		lower:   split,
+		next:    split,
+		upper:   victim.upper,
+		started: now,
+	}
+	victim.upper = split - 1
+	s.active = append(s.active, w)
+
+	return w
+}
+
+// slowest returns the splittable active range with the longest estimated
+// time to completion. Ranges without a throughput sample, such as one that
+// was just split off, are skipped; unsampled reports whether there were any.
+func (s *scheduler) slowest(now time.Time) (*work, bool) {
+	var victim *work
+	var victimETA time.Duration
+	var victimRemaining int64
+	var unsampled bool
+
+	for _, w := range s.active {
+		remaining := w.upper - w.next + 1
+		if remaining < 2 || remaining < 2*s.minSplitSize {
+			continue
+		}
+
+		eta, ok := estimateRemaining(w, now, remaining)
+		if !ok {
+			unsampled = true
+			continue
+		}
+		if victim == nil || eta > victimETA || (eta == victimETA && remaining > victimRemaining) {
+			victim = w
+			victimETA = eta
+			victimRemaining = remaining
+		}
+	}
+
+	return victim, unsampled
+}
+
+// estimateRemaining returns how long w should take to finish at its
+// throughput so far, or false if nothing has been read for it yet.
+func estimateRemaining(w *work, now time.Time, remaining int64) (time.Duration, bool) {
+	done := w.next - w.lower
+	elapsed := now.Sub(w.started)
+	if done <= 0 || elapsed <= 0 {
+		return 0, false
+	}
+
+	rate := float64(done) / elapsed.Seconds()
+	return time.Duration(float64(remaining) / rate * float64(time.Second)), true
+}
+
+// bounds returns the byte range still to be fetched for w.
+func (s *scheduler) bounds(w *work) (int64, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return w.next, w.upper
+}
+
+// claim records that n bytes were read for w and returns how many of them
+// still belong to w after any concurrent split.
+func (s *scheduler) claim(w *work, n int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	allowed := w.upper - w.next + 1
+	if allowed < 0 {
+		allowed = 0
+	}
+	if int64(n) < allowed {
+		allowed = int64(n)
+	}
+
+	w.next += allowed
+	if allowed > 0 {
+		s.changed.Broadcast()
+	}
+
+	return int(allowed)
+}
+
+func (s *scheduler) reset(w *work) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.next = w.lower
+	w.started = time.Now()
+}
+
+func (s *scheduler) done(w *work) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, a := range s.active {
+		if a == w {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+
+	s.changed.Broadcast()
+}
+
+func (s *scheduler) abort() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aborted = true
+	s.changed.Broadcast()
+}
+
+// workReader stops reading once the bytes belonging to its work have been
+// consumed, so the tail of a stolen range is not written twice.
+type workReader struct {
+	scheduler *scheduler
+	work      *work
+	reader    io.Reader
+}
+
+func (r workReader) Read(p []byte) (int, error) {
+	next, upper := r.scheduler.bounds(r.work)
+	remaining := upper - next + 1
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := r.reader.Read(p)
+	allowed := r.scheduler.claim(r.work, n)
+	if allowed < n {
+		return allowed, io.EOF
+	}
+
+	return n, err
+}
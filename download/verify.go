@@ -0,0 +1,80 @@
+package download
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrSizeMismatch is returned by VerifyFile when a file does not have the
+// expected length.
+type ErrSizeMismatch struct {
+	Expected int64
+	Actual   int64
+}
+
+func (e ErrSizeMismatch) Error() string {
+	return fmt.Sprintf("file size mismatch: expected %d bytes, got %d", e.Expected, e.Actual)
+}
+
+// ErrChecksumMismatch is returned by VerifyFile when a file's digest does
+// not match the expected value.
+type ErrChecksumMismatch struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e ErrChecksumMismatch) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+// VerifyFile checks the file at path against the given size and checksums.
+// A size below one or an empty checksum skips that check.
+func VerifyFile(path string, size int64, sha256sum string, md5sum string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if size > 0 && info.Size() != size {
+		return ErrSizeMismatch{Expected: size, Actual: info.Size()}
+	}
+
+	if sha256sum == "" && md5sum == "" {
+		return nil
+	}
+
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+
+	buf := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(buf)
+
+	_, err = io.CopyBuffer(io.MultiWriter(sha256Hash, md5Hash), f, *buf)
+	if err != nil {
+		return fmt.Errorf("failed to read file for verification: %s", err)
+	}
+
+	actual := hex.EncodeToString(sha256Hash.Sum(nil))
+	if sha256sum != "" && !strings.EqualFold(actual, sha256sum) {
+		return ErrChecksumMismatch{Algorithm: "sha256", Expected: sha256sum, Actual: actual}
+	}
+
+	actual = hex.EncodeToString(md5Hash.Sum(nil))
+	if md5sum != "" && !strings.EqualFold(actual, md5sum) {
+		return ErrChecksumMismatch{Algorithm: "md5", Expected: md5sum, Actual: actual}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package download_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VerifyFile", func() {
+	const (
+		contentsSHA256 = "9332d94d5ee69ad17d310e62cd101d70f578024fd5e8d1647f8073f886c894e1"
+		contentsMD5    = "31568d94c1ff0505d173ca6b5cc3cf49"
+	)
+
+	var path string
+
+	BeforeEach(func() {
+		f, err := ioutil.TempFile("", "verify")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = f.WriteString("some-data")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		path = f.Name()
+	})
+
+	AfterEach(func() {
+		os.Remove(path)
+	})
+
+	It("succeeds when size and checksums match", func() {
+		Expect(download.VerifyFile(path, 9, contentsSHA256, contentsMD5)).To(Succeed())
+	})
+
+	It("skips checks that have no expected value", func() {
+		Expect(download.VerifyFile(path, 0, "", "")).To(Succeed())
+	})
+
+	It("returns an error when the size differs", func() {
+		err := download.VerifyFile(path, 10, contentsSHA256, "")
+		Expect(err).To(Equal(download.ErrSizeMismatch{Expected: 10, Actual: 9}))
+	})
+
+	It("returns an error when the sha256 differs", func() {
+		err := download.VerifyFile(path, 9, "abc", "")
+		Expect(err).To(BeAssignableToTypeOf(download.ErrChecksumMismatch{}))
+		Expect(err.(download.ErrChecksumMismatch).Algorithm).To(Equal("sha256"))
+	})
+
+	It("returns an error when the md5 differs", func() {
+		err := download.VerifyFile(path, 9, "", "abc")
+		Expect(err).To(MatchError(ContainSubstring("md5 checksum mismatch")))
+	})
+})
@@ -0,0 +1,351 @@
+package pivnet
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+const DefaultDownloadConcurrency = 3
+
+// ProgressReporter hands out a progress listener for each file of a batch
+// of downloads. download.MultiProgress is one implementation.
+type ProgressReporter interface {
+	Listener(name string) download.ProgressListener
+}
+
+// DownloadManager downloads every product file of a release or file group.
+type DownloadManager struct {
+	client Client
+
+	// Concurrency is the number of files downloaded at once.
+	// Defaults to DefaultDownloadConcurrency.
+	Concurrency int
+
+	// Progress, if set, reports the progress of each file.
+	Progress ProgressReporter
+}
+
+func NewDownloadManager(client Client) DownloadManager {
+	return DownloadManager{client: client}
+}
+
+type DownloadPlanConfig struct {
+	ProductSlug string
+	ReleaseID   int
+
+	// FileGroupID limits the plan to the files of one file group of the
+	// release. When zero, the release's own files and the files of all of
+	// its file groups are planned.
+	FileGroupID int
+
+	// Globs, if set, limits the plan to files matching at least one of the
+	// patterns, which are matched as ProductFileSelector's Globs are.
+	// Unlike Selector, a pattern that matches no file is not an error, so
+	// the same Globs can be used for releases that lack some of the files.
+	Globs []string
+
+	// Filter, if set, limits the plan to the files for which it returns
+	// true.
+	Filter func(ProductFile) bool
+
+	// Selector, if set, is applied to the files remaining after Globs and
+	// Filter, and its errors are returned from Plan.
+	Selector *ProductFileSelector
+
+	// Directory is where files are downloaded to.
+	Directory string
+}
+
+// PlannedDownload is a product file and the path it is downloaded to.
+type PlannedDownload struct {
+	ProductSlug string
+	ReleaseID   int
+	ProductFile ProductFile
+	Path        string
+
+	// FileGroup is the name of a file group containing the file, if any.
+	FileGroup string
+}
+
+type DownloadStatus string
+
+const (
+	DownloadStatusDownloaded DownloadStatus = "downloaded"
+	DownloadStatusSkipped    DownloadStatus = "skipped"
+	DownloadStatusFailed     DownloadStatus = "failed"
+)
+
+type DownloadResult struct {
+	PlannedDownload
+	Status   DownloadStatus
+	Err      error
+	Duration time.Duration
+}
+
+type DownloadReport struct {
+	Results []DownloadResult
+}
+
+// Failed returns the results of the downloads that did not succeed.
+func (r DownloadReport) Failed() []DownloadResult {
+	var failed []DownloadResult
+	for _, result := range r.Results {
+		if result.Status == DownloadStatusFailed {
+			failed = append(failed, result)
+		}
+	}
+
+	return failed
+}
+
+// Err summarizes the failed downloads, or returns nil if there were none.
+func (r DownloadReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%d of %d downloads failed, first error: %s: %s",
+		len(failed),
+		len(r.Results),
+		failed[0].ProductFile.AWSObjectKey,
+		failed[0].Err,
+	)
+}
+
+// Plan lists the product files to download for config. Files are named
+// after the base of their AWS object key and ordered by name.
+func (m DownloadManager) Plan(config DownloadPlanConfig) ([]PlannedDownload, error) {
+	globs := ProductFileSelector{Globs: config.Globs}
+	_, err := globs.patterns()
+	if err != nil {
+		return nil, err
+	}
+
+	productFiles := ProductFilesService{client: m.client}
+	fileGroups := FileGroupsService{client: m.client}
+
+	type candidate struct {
+		productFile ProductFile
+		fileGroup   string
+	}
+	var candidates []candidate
+
+	if config.FileGroupID == 0 {
+		files, err := productFiles.ListForRelease(config.ProductSlug, config.ReleaseID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pf := range files {
+			candidates = append(candidates, candidate{productFile: pf})
+		}
+	}
+
+	groups, err := fileGroups.ListForRelease(config.ProductSlug, config.ReleaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	foundGroup := false
+	for _, fg := range groups {
+		if config.FileGroupID != 0 && fg.ID != config.FileGroupID {
+			continue
+		}
+		foundGroup = true
+
+		for _, pf := range fg.ProductFiles {
+			candidates = append(candidates, candidate{productFile: pf, fileGroup: fg.Name})
+		}
+	}
+
+	if config.FileGroupID != 0 && !foundGroup {
+		return nil, fmt.Errorf(
+			"file group %d not found in release %d of %s",
+			config.FileGroupID,
+			config.ReleaseID,
+			config.ProductSlug,
+		)
+	}
+
+	seen := map[int]bool{}
+	fileGroupNames := map[int]string{}
+
+	var files []ProductFile
+	for _, c := range candidates {
+		if fileGroupNames[c.productFile.ID] == "" {
+			fileGroupNames[c.productFile.ID] = c.fileGroup
+		}
+
+		if seen[c.productFile.ID] {
+			continue
+		}
+		seen[c.productFile.ID] = true
+
+		if config.Filter != nil && !config.Filter(c.productFile) {
+			continue
+		}
+
+		files = append(files, c.productFile)
+	}
+
+	files, err = globs.filter(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Selector != nil {
+		files, err = config.Selector.Select(files)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	paths := map[string]int{}
+
+	var plan []PlannedDownload
+	for _, pf := range files {
+		name := productFileName(pf)
+
+		if id, ok := paths[name]; ok {
+			return nil, fmt.Errorf("product files %d and %d would both be downloaded to %s", id, pf.ID, name)
+		}
+		paths[name] = pf.ID
+
+		plan = append(plan, PlannedDownload{
+			ProductSlug: config.ProductSlug,
+			ReleaseID:   config.ReleaseID,
+			ProductFile: pf,
+			FileGroup:   fileGroupNames[pf.ID],
+			Path:        filepath.Join(config.Directory, name),
+		})
+	}
+
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].Path < plan[j].Path
+	})
+
+	return plan, nil
+}
+
+// Download runs a plan. Files already present with the expected SHA256 are
+// skipped. Every planned file has a result in the report, in plan order,
+// even if ctx is canceled.
+func (m DownloadManager) Download(ctx context.Context, plan []PlannedDownload) DownloadReport {
+	concurrency := m.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDownloadConcurrency
+	}
+
+	results := make([]DownloadResult, len(plan))
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, planned := range plan {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		if ctx.Err() != nil {
+			results[i] = DownloadResult{
+				PlannedDownload: planned,
+				Status:          DownloadStatusFailed,
+				Err:             ctx.Err(),
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, planned PlannedDownload) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = m.downloadOne(ctx, planned)
+		}(i, planned)
+	}
+
+	wg.Wait()
+
+	return DownloadReport{Results: results}
+}
+
+// DownloadRelease plans and runs the downloads for config.
+func (m DownloadManager) DownloadRelease(ctx context.Context, config DownloadPlanConfig) (DownloadReport, error) {
+	plan, err := m.Plan(config)
+	if err != nil {
+		return DownloadReport{}, err
+	}
+
+	err = os.MkdirAll(config.Directory, 0755)
+	if err != nil {
+		return DownloadReport{}, err
+	}
+
+	return m.Download(ctx, plan), nil
+}
+
+func (m DownloadManager) downloadOne(ctx context.Context, planned PlannedDownload) DownloadResult {
+	start := time.Now()
+	result := DownloadResult{PlannedDownload: planned}
+
+	productFiles := ProductFilesService{client: m.client}
+
+	// Listings do not always include checksums, so the file is fetched
+	// individually.
+	pf, err := productFiles.GetForRelease(planned.ProductSlug, planned.ReleaseID, planned.ProductFile.ID)
+	if err != nil {
+		result.Status = DownloadStatusFailed
+		result.Err = err
+		result.Duration = time.Since(start)
+		return result
+	}
+	result.ProductFile = pf
+
+	if pf.SHA256 != "" && download.VerifyFile(planned.Path, int64(pf.Size), pf.SHA256, "") == nil {
+		m.client.logger.Debug("Skipping file already present", logger.Data{"path": planned.Path})
+
+		result.Status = DownloadStatusSkipped
+		result.Duration = time.Since(start)
+		return result
+	}
+
+	config := AtomicDownloadConfig{
+		ProductSlug:   planned.ProductSlug,
+		ReleaseID:     planned.ReleaseID,
+		ProductFileID: pf.ID,
+		Path:          planned.Path,
+	}
+	if m.Progress != nil {
+		config.Progress = m.Progress.Listener(filepath.Base(planned.Path))
+	}
+
+	_, err = productFiles.downloadAtomically(ctx, pf, config)
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Status = DownloadStatusFailed
+		result.Err = err
+		return result
+	}
+
+	result.Status = DownloadStatusDownloaded
+	return result
+}
+
+func productFileName(pf ProductFile) string {
+	if pf.AWSObjectKey != "" {
+		return path.Base(pf.AWSObjectKey)
+	}
+
+	return fmt.Sprintf("product-file-%d", pf.ID)
+}
@@ -0,0 +1,280 @@
+package pivnet_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/download"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DownloadManager", func() {
+	var (
+		server  *pivnettest.Server
+		manager pivnet.DownloadManager
+		dir     string
+
+		release   pivnet.Release
+		tile      pivnet.ProductFile
+		stemcell  pivnet.ProductFile
+		docs      pivnet.ProductFile
+		fileGroup pivnet.FileGroup
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+
+		release = server.AddRelease("banana", pivnet.Release{Version: "1.2.3"})
+		tile = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/banana-1.2.3.pivotal",
+			FileType:     "Software",
+		}, bytes.Repeat([]byte("tile"), 1000))
+		stemcell = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/stemcell.tgz",
+			FileType:     "Software",
+		}, bytes.Repeat([]byte("stemcell"), 1000))
+		docs = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/docs.pdf",
+			FileType:     "Documentation",
+		}, []byte("docs"))
+		fileGroup = server.AddFileGroup("banana", release.ID, "Stemcells", stemcell.ID)
+
+		client := pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+		manager = pivnet.NewDownloadManager(client)
+
+		var err error
+		dir, err = ioutil.TempDir("", "download-manager")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	Describe("Plan", func() {
+		It("plans every file of the release and its file groups once", func() {
+			plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(plan).To(HaveLen(3))
+			Expect(plan[0].Path).To(Equal(filepath.Join(dir, "banana-1.2.3.pivotal")))
+			Expect(plan[1].Path).To(Equal(filepath.Join(dir, "docs.pdf")))
+			Expect(plan[2].Path).To(Equal(filepath.Join(dir, "stemcell.tgz")))
+			Expect(plan[2].ProductFile.ID).To(Equal(stemcell.ID))
+		})
+
+		It("limits the plan to a file group", func() {
+			plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				FileGroupID: fileGroup.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(plan).To(HaveLen(1))
+			Expect(plan[0].ProductFile.ID).To(Equal(stemcell.ID))
+			Expect(plan[0].FileGroup).To(Equal("Stemcells"))
+		})
+
+		It("applies globs and filters", func() {
+			plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Globs:       []string{"*.pivotal", "*.pdf"},
+				Filter: func(pf pivnet.ProductFile) bool {
+					return pf.FileType == "Software"
+				},
+				Directory: dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(plan).To(HaveLen(1))
+			Expect(plan[0].ProductFile.ID).To(Equal(tile.ID))
+		})
+
+		It("matches globs as a selector does", func() {
+			cli := server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+				AWSObjectKey: "product-files/banana/banana-cli",
+				Name:         "Banana CLI for Linux",
+			}, []byte("cli"))
+
+			plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Globs:       []string{"* for Linux"},
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			selected, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Selector:    &pivnet.ProductFileSelector{Globs: []string{"* for Linux"}},
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(plan).To(HaveLen(1))
+			Expect(plan[0].ProductFile.ID).To(Equal(cli.ID))
+			Expect(plan).To(Equal(selected))
+		})
+
+		It("applies a selector", func() {
+			plan, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Selector: &pivnet.ProductFileSelector{
+					Globs:     []string{"*.tgz"},
+					FileTypes: []string{pivnet.FileTypeSoftware},
+				},
+				Directory: dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(plan).To(HaveLen(1))
+			Expect(plan[0].ProductFile.ID).To(Equal(stemcell.ID))
+			Expect(plan[0].FileGroup).To(Equal("Stemcells"))
+
+			_, err = manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Selector:    &pivnet.ProductFileSelector{Globs: []string{"*.ova"}},
+			})
+			Expect(err).To(Equal(pivnet.ErrNoProductFilesMatched{Pattern: "*.ova"}))
+		})
+
+		It("returns an error for an unknown file group", func() {
+			_, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				FileGroupID: 9999,
+			})
+			Expect(err).To(MatchError(ContainSubstring("file group 9999 not found")))
+		})
+
+		It("returns an error for an invalid glob", func() {
+			_, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Globs:       []string{"["},
+			})
+			Expect(err).To(MatchError(ContainSubstring("invalid glob")))
+		})
+
+		It("forwards API errors", func() {
+			_, err := manager.Plan(pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   9999,
+			})
+			Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNotFound{}))
+		})
+	})
+
+	Describe("DownloadRelease", func() {
+		It("downloads every planned file", func() {
+			report, err := manager.DownloadRelease(context.Background(), pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   filepath.Join(dir, "release"),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(report.Err()).NotTo(HaveOccurred())
+
+			Expect(report.Results).To(HaveLen(3))
+			for _, result := range report.Results {
+				Expect(result.Status).To(Equal(pivnet.DownloadStatusDownloaded))
+			}
+
+			contents, err := ioutil.ReadFile(filepath.Join(dir, "release", "stemcell.tgz"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(contents).To(Equal(bytes.Repeat([]byte("stemcell"), 1000)))
+		})
+
+		It("skips files that are already present", func() {
+			err := ioutil.WriteFile(filepath.Join(dir, "docs.pdf"), []byte("docs"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			report, err := manager.DownloadRelease(context.Background(), pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(report.Results[1].ProductFile.ID).To(Equal(docs.ID))
+			Expect(report.Results[1].Status).To(Equal(pivnet.DownloadStatusSkipped))
+			Expect(server.Downloads(docs.ID)).To(BeZero())
+			Expect(server.Downloads(tile.ID)).To(Equal(1))
+		})
+
+		It("reports failures per file", func() {
+			broken := server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+				AWSObjectKey: "product-files/banana/broken.zip",
+				SHA256:       "not-the-right-sha",
+			}, []byte("broken"))
+
+			manager.Concurrency = 1
+			report, err := manager.DownloadRelease(context.Background(), pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			failed := report.Failed()
+			Expect(failed).To(HaveLen(1))
+			Expect(failed[0].ProductFile.ID).To(Equal(broken.ID))
+			Expect(failed[0].Err).To(BeAssignableToTypeOf(download.ErrChecksumMismatch{}))
+			Expect(report.Err()).To(MatchError(ContainSubstring("1 of 4 downloads failed")))
+
+			_, err = os.Stat(filepath.Join(dir, "broken.zip"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("reports progress for each file", func() {
+			output := &bytes.Buffer{}
+			multi := download.NewMultiProgress(output)
+			manager.Progress = multi
+
+			_, err := manager.DownloadRelease(context.Background(), pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			multi.Stop()
+			Expect(strings.Count(output.String(), "  done  ")).To(Equal(3))
+		})
+
+		It("does not start downloads once the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			report, err := manager.DownloadRelease(ctx, pivnet.DownloadPlanConfig{
+				ProductSlug: "banana",
+				ReleaseID:   release.ID,
+				Directory:   dir,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(report.Failed()).To(HaveLen(3))
+			Expect(report.Results[0].Err).To(Equal(context.Canceled))
+		})
+	})
+})
@@ -92,4 +92,27 @@ func newErrTooManyRequests() ErrTooManyRequests {
 		ResponseCode: http.StatusTooManyRequests,
 		Message: "You have hit a rate limit for this request",
 	}
-}
\ No newline at end of file
+}
+
+// ErrConflict is returned by a patch when the resource changed after the
+// caller last read it.
+type ErrConflict struct {
+	ResponseCode int    `json:"response_code" yaml:"response_code"`
+	Message      string `json:"message" yaml:"message"`
+}
+
+func (e ErrConflict) Error() string {
+	return e.Message
+}
+
+func newErrConflict(resource string, expectedUpdatedAt string, updatedAt string) ErrConflict {
+	return ErrConflict{
+		ResponseCode: http.StatusConflict,
+		Message: fmt.Sprintf(
+			"%s was updated at %s, after it was read at %s",
+			resource,
+			updatedAt,
+			expectedUpdatedAt,
+		),
+	}
+}
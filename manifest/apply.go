@@ -0,0 +1,276 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+// Step is an action taken by Apply and its outcome.
+type Step struct {
+	Action Action
+	Err    error
+}
+
+// Report records what Apply did. Skipped are the actions not taken because
+// an earlier one failed.
+type Report struct {
+	Steps   []Step
+	Skipped []Action
+}
+
+// Err returns the error of the step that failed, if any.
+func (r Report) Err() error {
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			return fmt.Errorf("failed to %s: %s", step.Action, step.Err)
+		}
+	}
+
+	return nil
+}
+
+func (r Report) String() string {
+	var lines []string
+	for _, step := range r.Steps {
+		if step.Err != nil {
+			lines = append(lines, fmt.Sprintf("failed: %s: %s", step.Action, step.Err))
+		} else {
+			lines = append(lines, "done: "+step.Action.String())
+		}
+	}
+	for _, action := range r.Skipped {
+		lines = append(lines, "skipped: "+action.String())
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Apply makes Pivotal Network match a manifest. It plans against the
+// current state and takes each action in turn, stopping at the first that
+// fails. Applying the manifest again picks up where a failed apply left
+// off.
+func Apply(client pivnet.Client, m Manifest) (Report, error) {
+	actions, a, err := plan(client, m)
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	for i, action := range actions {
+		err := action.run(a)
+		report.Steps = append(report.Steps, Step{Action: action, Err: err})
+		if err != nil {
+			report.Skipped = actions[i+1:]
+			return report, report.Err()
+		}
+	}
+
+	return report, nil
+}
+
+func (a *applier) slug() string {
+	return a.manifest.ProductSlug
+}
+
+func (a *applier) createRelease() error {
+	r := a.manifest.Release
+
+	release, err := a.client.Releases.Create(pivnet.CreateReleaseConfig{
+		ProductSlug:           a.slug(),
+		Version:               r.Version,
+		ReleaseType:           r.ReleaseType,
+		ReleaseDate:           r.ReleaseDate,
+		EULASlug:              r.EULASlug,
+		Description:           r.Description,
+		ReleaseNotesURL:       r.ReleaseNotesURL,
+		Controlled:            r.Controlled,
+		ECCN:                  r.ECCN,
+		LicenseException:      r.LicenseException,
+		EndOfSupportDate:      r.EndOfSupportDate,
+		EndOfGuidanceDate:     r.EndOfGuidanceDate,
+		EndOfAvailabilityDate: r.EndOfAvailabilityDate,
+	})
+	if err != nil {
+		return err
+	}
+
+	a.releaseID = release.ID
+	return nil
+}
+
+func (a *applier) updateRelease() error {
+	release, err := a.client.Releases.Get(a.slug(), a.releaseID)
+	if err != nil {
+		return err
+	}
+
+	patch, changes := releasePatch(a.manifest.Release, release)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	patch.CheckUpdatedAt = release.UpdatedAt
+	_, err = a.client.Releases.Patch(a.slug(), a.releaseID, patch)
+	return err
+}
+
+func createProductFile(pf ProductFile) func(a *applier) error {
+	return func(a *applier) error {
+		created, err := a.client.ProductFiles.Create(pivnet.CreateProductFileConfig{
+			ProductSlug:        a.slug(),
+			AWSObjectKey:       pf.AWSObjectKey,
+			Description:        pf.Description,
+			DocsURL:            pf.DocsURL,
+			FileType:           pf.FileType,
+			FileVersion:        pf.FileVersion,
+			IncludedFiles:      pf.IncludedFiles,
+			SHA256:             pf.SHA256,
+			MD5:                pf.MD5,
+			Name:               pf.Name,
+			Platforms:          pf.Platforms,
+			ReleasedAt:         pf.ReleasedAt,
+			SystemRequirements: pf.SystemRequirements,
+		})
+		if err != nil {
+			return err
+		}
+
+		a.productFileIDs[pf.AWSObjectKey] = created.ID
+		return nil
+	}
+}
+
+func updateProductFile(pf ProductFile) func(a *applier) error {
+	return func(a *applier) error {
+		productFileID := a.productFileIDs[pf.AWSObjectKey]
+
+		live, err := a.client.ProductFiles.Get(a.slug(), productFileID)
+		if err != nil {
+			return err
+		}
+
+		patch, changes := productFilePatch(pf, live)
+		if len(changes) == 0 {
+			return nil
+		}
+
+		patch.CheckUpdatedAt = live.UpdatedAt
+		_, err = a.client.ProductFiles.Patch(a.slug(), productFileID, patch)
+		return err
+	}
+}
+
+func addProductFile(key string) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ProductFiles.AddToRelease(a.slug(), a.releaseID, a.productFileIDs[key])
+	}
+}
+
+func removeProductFile(productFileID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ProductFiles.RemoveFromRelease(a.slug(), a.releaseID, productFileID)
+	}
+}
+
+func createFileGroup(name string) func(a *applier) error {
+	return func(a *applier) error {
+		fg, err := a.client.FileGroups.Create(pivnet.CreateFileGroupConfig{
+			ProductSlug: a.slug(),
+			Name:        name,
+		})
+		if err != nil {
+			return err
+		}
+
+		a.fileGroupIDs[name] = fg.ID
+		return nil
+	}
+}
+
+func addToFileGroup(name string, key string) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ProductFiles.AddToFileGroup(a.slug(), a.fileGroupIDs[name], a.productFileIDs[key])
+	}
+}
+
+func removeFromFileGroup(fileGroupID int, productFileID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ProductFiles.RemoveFromFileGroup(a.slug(), fileGroupID, productFileID)
+	}
+}
+
+func addFileGroup(name string) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.FileGroups.AddToRelease(a.slug(), a.releaseID, a.fileGroupIDs[name])
+	}
+}
+
+func removeFileGroup(fileGroupID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.FileGroups.RemoveFromRelease(a.slug(), a.releaseID, fileGroupID)
+	}
+}
+
+func addUserGroup(userGroupID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.UserGroups.AddToRelease(a.slug(), a.releaseID, userGroupID)
+	}
+}
+
+func removeUserGroup(userGroupID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.UserGroups.RemoveFromRelease(a.slug(), a.releaseID, userGroupID)
+	}
+}
+
+func addDependency(releaseID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ReleaseDependencies.Add(a.slug(), a.releaseID, releaseID)
+	}
+}
+
+func removeDependency(releaseID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ReleaseDependencies.Remove(a.slug(), a.releaseID, releaseID)
+	}
+}
+
+func createDependencySpecifier(s DependencySpecifier) func(a *applier) error {
+	return func(a *applier) error {
+		_, err := a.client.DependencySpecifiers.Create(a.slug(), a.releaseID, s.ProductSlug, s.Specifier)
+		return err
+	}
+}
+
+func deleteDependencySpecifier(id int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.DependencySpecifiers.Delete(a.slug(), a.releaseID, id)
+	}
+}
+
+func addUpgradePath(releaseID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ReleaseUpgradePaths.Add(a.slug(), a.releaseID, releaseID)
+	}
+}
+
+func removeUpgradePath(releaseID int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.ReleaseUpgradePaths.Remove(a.slug(), a.releaseID, releaseID)
+	}
+}
+
+func createUpgradePathSpecifier(specifier string) func(a *applier) error {
+	return func(a *applier) error {
+		_, err := a.client.UpgradePathSpecifiers.Create(a.slug(), a.releaseID, specifier)
+		return err
+	}
+}
+
+func deleteUpgradePathSpecifier(id int) func(a *applier) error {
+	return func(a *applier) error {
+		return a.client.UpgradePathSpecifiers.Delete(a.slug(), a.releaseID, id)
+	}
+}
@@ -0,0 +1,242 @@
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/manifest"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+)
+
+var _ = Describe("Apply", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+		m      manifest.Manifest
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		server.AddEULA(pivnet.EULA{Slug: "my-eula", Name: "My EULA"})
+		server.AddUserGroup(pivnet.UserGroup{Name: "Beta Testers"})
+		server.AddRelease("my-product", pivnet.Release{Version: "1.2.2"})
+		server.AddRelease("other-product", pivnet.Release{Version: "2.0.0"})
+
+		m = manifest.Manifest{
+			ProductSlug: "my-product",
+			Release: manifest.Release{
+				Version:      "1.2.3",
+				ReleaseType:  "Minor Release",
+				EULASlug:     "my-eula",
+				Description:  "The next release",
+				Availability: "Selected User Groups Only",
+			},
+			ProductFiles: []manifest.ProductFile{
+				{AWSObjectKey: "tile.pivotal", Name: "Tile", FileVersion: "1.2.3", SHA256: "abc"},
+			},
+			FileGroups: []manifest.FileGroup{
+				{Name: "Stemcells", ProductFiles: []manifest.ProductFile{{AWSObjectKey: "stemcell.tgz", Name: "Stemcell"}}},
+			},
+			UserGroups:            []string{"Beta Testers"},
+			Dependencies:          []manifest.Dependency{{ProductSlug: "other-product", Version: "2.0.0"}},
+			DependencySpecifiers:  []manifest.DependencySpecifier{{ProductSlug: "other-product", Specifier: "2.0.*"}},
+			UpgradePaths:          []string{"1.2.2"},
+			UpgradePathSpecifiers: []string{"1.1.*"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	findRelease := func(version string) pivnet.Release {
+		releases, err := client.Releases.List("my-product")
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, r := range releases {
+			if r.Version == version {
+				return r
+			}
+		}
+
+		Fail("release " + version + " not found")
+		return pivnet.Release{}
+	}
+
+	It("publishes a release as described", func() {
+		report, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Steps).To(HaveLen(13))
+		Expect(report.Skipped).To(BeEmpty())
+		Expect(report.Err()).NotTo(HaveOccurred())
+
+		r := findRelease("1.2.3")
+		Expect(r.ReleaseType).To(Equal(pivnet.ReleaseType("Minor Release")))
+		Expect(r.Description).To(Equal("The next release"))
+		Expect(r.Availability).To(Equal("Selected User Groups Only"))
+		Expect(r.EULA.Slug).To(Equal("my-eula"))
+
+		productFiles, err := client.ProductFiles.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(1))
+		Expect(productFiles[0].AWSObjectKey).To(Equal("tile.pivotal"))
+		Expect(productFiles[0].Name).To(Equal("Tile"))
+		Expect(productFiles[0].SHA256).To(Equal("abc"))
+
+		fileGroups, err := client.FileGroups.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileGroups).To(HaveLen(1))
+		Expect(fileGroups[0].Name).To(Equal("Stemcells"))
+		Expect(fileGroups[0].ProductFiles).To(HaveLen(1))
+		Expect(fileGroups[0].ProductFiles[0].AWSObjectKey).To(Equal("stemcell.tgz"))
+
+		userGroups, err := client.UserGroups.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userGroups).To(HaveLen(1))
+		Expect(userGroups[0].Name).To(Equal("Beta Testers"))
+
+		dependencies, err := client.ReleaseDependencies.List("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies).To(HaveLen(1))
+		Expect(dependencies[0].Release.Version).To(Equal("2.0.0"))
+
+		dependencySpecifiers, err := client.DependencySpecifiers.List("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencySpecifiers).To(HaveLen(1))
+		Expect(dependencySpecifiers[0].Specifier).To(Equal("2.0.*"))
+
+		upgradePaths, err := client.ReleaseUpgradePaths.Get("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePaths).To(HaveLen(1))
+		Expect(upgradePaths[0].Release.Version).To(Equal("1.2.2"))
+
+		upgradePathSpecifiers, err := client.UpgradePathSpecifiers.List("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePathSpecifiers).To(HaveLen(1))
+		Expect(upgradePathSpecifiers[0].Specifier).To(Equal("1.1.*"))
+	})
+
+	It("does nothing the second time", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		report, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Steps).To(BeEmpty())
+	})
+
+	It("brings an existing release in line with the manifest", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.Release.Description = "Now with more features"
+		m.ProductFiles[0].SHA256 = "def"
+		m.FileGroups = nil
+		m.UserGroups = nil
+		m.UpgradePathSpecifiers = []string{"1.2.*"}
+
+		_, err = manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		r := findRelease("1.2.3")
+		Expect(r.Description).To(Equal("Now with more features"))
+
+		productFiles, err := client.ProductFiles.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(1))
+		Expect(productFiles[0].SHA256).To(Equal("def"))
+
+		fileGroups, err := client.FileGroups.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileGroups).To(BeEmpty())
+
+		userGroups, err := client.UserGroups.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userGroups).To(BeEmpty())
+
+		upgradePathSpecifiers, err := client.UpgradePathSpecifiers.List("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePathSpecifiers).To(HaveLen(1))
+		Expect(upgradePathSpecifiers[0].Specifier).To(Equal("1.2.*"))
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actions).To(BeEmpty())
+	})
+
+	It("changes only the fields that differ", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		r := findRelease("1.2.3")
+		eccn := "5D002"
+		_, err = client.Releases.Patch("my-product", r.ID, pivnet.ReleasePatch{ECCN: &eccn})
+		Expect(err).NotTo(HaveOccurred())
+
+		m.Release.Description = "Now with more features"
+		m.ProductFiles[0].DocsURL = "https://docs.example.com"
+		m.ProductFiles[0].Platforms = []string{"Linux", "Windows"}
+
+		_, err = manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		r = findRelease("1.2.3")
+		Expect(r.Description).To(Equal("Now with more features"))
+		Expect(r.ECCN).To(Equal("5D002"))
+
+		productFiles, err := client.ProductFiles.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(1))
+		Expect(productFiles[0].DocsURL).To(Equal("https://docs.example.com"))
+		Expect(productFiles[0].Platforms).To(Equal([]string{"Linux", "Windows"}))
+		Expect(productFiles[0].SHA256).To(Equal("abc"))
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actions).To(BeEmpty())
+	})
+
+	It("stops at the first failure and reports what was skipped", func() {
+		m.Release.EULASlug = "unknown-eula"
+
+		report, err := manifest.Apply(client, m)
+		Expect(err).To(MatchError(ContainSubstring("failed to create release 1.2.3")))
+
+		Expect(report.Steps).To(HaveLen(1))
+		Expect(report.Steps[0].Err).To(HaveOccurred())
+		Expect(report.Skipped).To(HaveLen(12))
+		Expect(report.String()).To(HavePrefix("failed: create release 1.2.3: "))
+		Expect(report.String()).To(ContainSubstring("\nskipped: create product file tile.pivotal\n"))
+
+		productFiles, err := client.ProductFiles.List("my-product")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(BeEmpty())
+	})
+
+	It("picks up where a failed apply left off", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.Release.Description = "Now with more features"
+		m.Release.EULASlug = "unknown-eula"
+		m.ProductFiles = append(m.ProductFiles, manifest.ProductFile{AWSObjectKey: "readme.txt", Name: "Readme"})
+
+		report, err := manifest.Apply(client, m)
+		Expect(err).To(MatchError(ContainSubstring("failed to update release 1.2.3 (eula, description)")))
+		Expect(report.Steps).To(HaveLen(3))
+
+		m.Release.EULASlug = "my-eula"
+
+		report, err = manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.String()).To(Equal("done: update release 1.2.3 (description)"))
+
+		r := findRelease("1.2.3")
+		productFiles, err := client.ProductFiles.ListForRelease("my-product", r.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(2))
+	})
+})
@@ -0,0 +1,251 @@
+// Package manifest publishes releases from a declarative description.
+//
+// A manifest describes a release and everything attached to it: product
+// files, file groups, user groups, dependencies, upgrade paths and their
+// specifiers. Plan compares a manifest with Pivotal Network and lists the
+// actions that would make the release match it, and Apply carries them out.
+// Applying the same manifest again does nothing.
+//
+// Attachments are matched by name: product files by AWS object key, file
+// groups and user groups by name, and dependencies and upgrade paths by
+// version. Anything attached to the release but missing from the manifest
+// is detached. Empty release and product file fields are left as they are.
+package manifest
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+type Manifest struct {
+	ProductSlug string  `json:"product_slug" yaml:"product_slug"`
+	Release     Release `json:"release" yaml:"release"`
+
+	// ProductFiles are attached to the release directly.
+	ProductFiles []ProductFile `json:"product_files,omitempty" yaml:"product_files,omitempty"`
+
+	FileGroups []FileGroup `json:"file_groups,omitempty" yaml:"file_groups,omitempty"`
+
+	// UserGroups are the names of the user groups given access to the
+	// release.
+	UserGroups []string `json:"user_groups,omitempty" yaml:"user_groups,omitempty"`
+
+	Dependencies         []Dependency          `json:"dependencies,omitempty" yaml:"dependencies,omitempty"`
+	DependencySpecifiers []DependencySpecifier `json:"dependency_specifiers,omitempty" yaml:"dependency_specifiers,omitempty"`
+
+	// UpgradePaths are the versions of the same product that can be
+	// upgraded to the release.
+	UpgradePaths          []string `json:"upgrade_paths,omitempty" yaml:"upgrade_paths,omitempty"`
+	UpgradePathSpecifiers []string `json:"upgrade_path_specifiers,omitempty" yaml:"upgrade_path_specifiers,omitempty"`
+}
+
+type Release struct {
+	Version               string `json:"version" yaml:"version"`
+	ReleaseType           string `json:"release_type,omitempty" yaml:"release_type,omitempty"`
+	ReleaseDate           string `json:"release_date,omitempty" yaml:"release_date,omitempty"`
+	EULASlug              string `json:"eula_slug,omitempty" yaml:"eula_slug,omitempty"`
+	Availability          string `json:"availability,omitempty" yaml:"availability,omitempty"`
+	Description           string `json:"description,omitempty" yaml:"description,omitempty"`
+	ReleaseNotesURL       string `json:"release_notes_url,omitempty" yaml:"release_notes_url,omitempty"`
+	Controlled            bool   `json:"controlled,omitempty" yaml:"controlled,omitempty"`
+	ECCN                  string `json:"eccn,omitempty" yaml:"eccn,omitempty"`
+	LicenseException      string `json:"license_exception,omitempty" yaml:"license_exception,omitempty"`
+	EndOfSupportDate      string `json:"end_of_support_date,omitempty" yaml:"end_of_support_date,omitempty"`
+	EndOfGuidanceDate     string `json:"end_of_guidance_date,omitempty" yaml:"end_of_guidance_date,omitempty"`
+	EndOfAvailabilityDate string `json:"end_of_availability_date,omitempty" yaml:"end_of_availability_date,omitempty"`
+}
+
+// ProductFile is a product file identified by its AWS object key. Files
+// that do not exist yet are created from it; existing files are updated
+// with whichever of its fields are set and differ.
+type ProductFile struct {
+	AWSObjectKey       string   `json:"aws_object_key" yaml:"aws_object_key"`
+	Name               string   `json:"name,omitempty" yaml:"name,omitempty"`
+	FileType           string   `json:"file_type,omitempty" yaml:"file_type,omitempty"`
+	FileVersion        string   `json:"file_version,omitempty" yaml:"file_version,omitempty"`
+	Description        string   `json:"description,omitempty" yaml:"description,omitempty"`
+	DocsURL            string   `json:"docs_url,omitempty" yaml:"docs_url,omitempty"`
+	SHA256             string   `json:"sha256,omitempty" yaml:"sha256,omitempty"`
+	MD5                string   `json:"md5,omitempty" yaml:"md5,omitempty"`
+	IncludedFiles      []string `json:"included_files,omitempty" yaml:"included_files,omitempty"`
+	Platforms          []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	ReleasedAt         string   `json:"released_at,omitempty" yaml:"released_at,omitempty"`
+	SystemRequirements []string `json:"system_requirements,omitempty" yaml:"system_requirements,omitempty"`
+}
+
+// FileGroup is a file group of the product, identified by name, and the
+// exact set of product files it should contain.
+type FileGroup struct {
+	Name         string        `json:"name" yaml:"name"`
+	ProductFiles []ProductFile `json:"product_files,omitempty" yaml:"product_files,omitempty"`
+}
+
+// Dependency is a release of another product the release depends on.
+type Dependency struct {
+	ProductSlug string `json:"product_slug" yaml:"product_slug"`
+	Version     string `json:"version" yaml:"version"`
+}
+
+type DependencySpecifier struct {
+	ProductSlug string `json:"product_slug" yaml:"product_slug"`
+	Specifier   string `json:"specifier" yaml:"specifier"`
+}
+
+// Parse decodes a manifest from YAML or JSON. Unknown fields are
+// rejected.
+func Parse(b []byte) (Manifest, error) {
+	var m Manifest
+	err := yaml.UnmarshalStrict(b, &m)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse release manifest: %s", err)
+	}
+
+	err = m.Validate()
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return m, nil
+}
+
+// ReadFile reads and parses a manifest file.
+func ReadFile(path string) (Manifest, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return Parse(b)
+}
+
+// Validate checks that a manifest identifies everything it describes, and
+// describes nothing twice.
+func (m Manifest) Validate() error {
+	if m.ProductSlug == "" {
+		return fmt.Errorf("invalid release manifest: product_slug must be set")
+	}
+	if m.Release.Version == "" {
+		return fmt.Errorf("invalid release manifest: release version must be set")
+	}
+
+	seen := map[string]bool{}
+	for _, pf := range m.ProductFiles {
+		if seen[pf.AWSObjectKey] {
+			return fmt.Errorf("invalid release manifest: product file %s is listed more than once", pf.AWSObjectKey)
+		}
+		seen[pf.AWSObjectKey] = true
+	}
+
+	groups := map[string]bool{}
+	for _, fg := range m.FileGroups {
+		if fg.Name == "" {
+			return fmt.Errorf("invalid release manifest: file group has no name")
+		}
+		if groups[fg.Name] {
+			return fmt.Errorf("invalid release manifest: file group %s is listed more than once", fg.Name)
+		}
+		groups[fg.Name] = true
+
+		inGroup := map[string]bool{}
+		for _, pf := range fg.ProductFiles {
+			if inGroup[pf.AWSObjectKey] {
+				return fmt.Errorf("invalid release manifest: product file %s is listed more than once in file group %s", pf.AWSObjectKey, fg.Name)
+			}
+			inGroup[pf.AWSObjectKey] = true
+		}
+	}
+
+	_, err := m.productFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range m.Dependencies {
+		if d.ProductSlug == "" || d.Version == "" {
+			return fmt.Errorf("invalid release manifest: dependencies need a product_slug and version")
+		}
+	}
+	for _, d := range m.DependencySpecifiers {
+		if d.ProductSlug == "" || d.Specifier == "" {
+			return fmt.Errorf("invalid release manifest: dependency specifiers need a product_slug and specifier")
+		}
+	}
+
+	return nil
+}
+
+// productFiles returns every product file described by the manifest, by
+// AWS object key. A file may be described more than once, such as directly
+// and in a file group, as long as the descriptions agree; a description
+// with only a key refers to a file described elsewhere.
+func (m Manifest) productFiles() (map[string]ProductFile, error) {
+	files := map[string]ProductFile{}
+
+	add := func(pf ProductFile) error {
+		if pf.AWSObjectKey == "" {
+			return fmt.Errorf("invalid release manifest: product file %q has no aws_object_key", pf.Name)
+		}
+
+		existing, ok := files[pf.AWSObjectKey]
+		switch {
+		case !ok, isReference(existing):
+			files[pf.AWSObjectKey] = pf
+		case isReference(pf):
+		case !sameProductFile(existing, pf):
+			return fmt.Errorf("invalid release manifest: product file %s is described differently more than once", pf.AWSObjectKey)
+		}
+
+		return nil
+	}
+
+	for _, pf := range m.ProductFiles {
+		err := add(pf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, fg := range m.FileGroups {
+		for _, pf := range fg.ProductFiles {
+			err := add(pf)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func isReference(pf ProductFile) bool {
+	return sameProductFile(pf, ProductFile{AWSObjectKey: pf.AWSObjectKey})
+}
+
+func sameProductFile(a ProductFile, b ProductFile) bool {
+	return a.Name == b.Name &&
+		a.FileType == b.FileType &&
+		a.FileVersion == b.FileVersion &&
+		a.Description == b.Description &&
+		a.DocsURL == b.DocsURL &&
+		a.SHA256 == b.SHA256 &&
+		a.MD5 == b.MD5 &&
+		a.ReleasedAt == b.ReleasedAt &&
+		equalStrings(a.IncludedFiles, b.IncludedFiles) &&
+		equalStrings(a.Platforms, b.Platforms) &&
+		equalStrings(a.SystemRequirements, b.SystemRequirements)
+}
+
+func equalStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,177 @@
+package manifest_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/go-pivnet/manifest"
+)
+
+var _ = Describe("Manifest", func() {
+	Describe("Parse", func() {
+		It("parses a manifest", func() {
+			m, err := manifest.Parse([]byte(`
+product_slug: my-product
+release:
+  version: 1.2.3
+  release_type: Minor Release
+  eula_slug: my-eula
+product_files:
+- aws_object_key: product-files/my-product/tile.pivotal
+  name: Tile
+  file_version: 1.2.3
+file_groups:
+- name: Stemcells
+  product_files:
+  - aws_object_key: product-files/my-product/stemcell.tgz
+    name: Stemcell
+user_groups: [Beta Testers]
+dependencies:
+- product_slug: other-product
+  version: 2.0.0
+dependency_specifiers:
+- product_slug: other-product
+  specifier: 2.0.*
+upgrade_paths: [1.2.2]
+upgrade_path_specifiers: [1.1.*]
+`))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(m).To(Equal(manifest.Manifest{
+				ProductSlug: "my-product",
+				Release: manifest.Release{
+					Version:     "1.2.3",
+					ReleaseType: "Minor Release",
+					EULASlug:    "my-eula",
+				},
+				ProductFiles: []manifest.ProductFile{
+					{AWSObjectKey: "product-files/my-product/tile.pivotal", Name: "Tile", FileVersion: "1.2.3"},
+				},
+				FileGroups: []manifest.FileGroup{
+					{
+						Name: "Stemcells",
+						ProductFiles: []manifest.ProductFile{
+							{AWSObjectKey: "product-files/my-product/stemcell.tgz", Name: "Stemcell"},
+						},
+					},
+				},
+				UserGroups:   []string{"Beta Testers"},
+				Dependencies: []manifest.Dependency{{ProductSlug: "other-product", Version: "2.0.0"}},
+				DependencySpecifiers: []manifest.DependencySpecifier{
+					{ProductSlug: "other-product", Specifier: "2.0.*"},
+				},
+				UpgradePaths:          []string{"1.2.2"},
+				UpgradePathSpecifiers: []string{"1.1.*"},
+			}))
+		})
+
+		It("parses JSON", func() {
+			m, err := manifest.Parse([]byte(`{"product_slug": "my-product", "release": {"version": "1.2.3"}}`))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.ProductSlug).To(Equal("my-product"))
+			Expect(m.Release.Version).To(Equal("1.2.3"))
+		})
+
+		It("rejects unknown fields", func() {
+			_, err := manifest.Parse([]byte("product_slug: my-product\nrelease:\n  version: 1.2.3\n  verison: 1.2.4\n"))
+			Expect(err).To(MatchError(ContainSubstring("verison")))
+		})
+
+		It("validates the manifest", func() {
+			_, err := manifest.Parse([]byte("product_slug: my-product\n"))
+			Expect(err).To(MatchError(ContainSubstring("release version must be set")))
+		})
+	})
+
+	Describe("ReadFile", func() {
+		It("reads a manifest file", func() {
+			dir, err := ioutil.TempDir("", "manifest")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "release.yml")
+			err = ioutil.WriteFile(path, []byte("product_slug: my-product\nrelease:\n  version: 1.2.3\n"), 0644)
+			Expect(err).NotTo(HaveOccurred())
+
+			m, err := manifest.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(m.Release.Version).To(Equal("1.2.3"))
+		})
+	})
+
+	Describe("Validate", func() {
+		var m manifest.Manifest
+
+		BeforeEach(func() {
+			m = manifest.Manifest{
+				ProductSlug: "my-product",
+				Release:     manifest.Release{Version: "1.2.3"},
+			}
+		})
+
+		It("accepts a minimal manifest", func() {
+			Expect(m.Validate()).To(Succeed())
+		})
+
+		It("requires a product slug", func() {
+			m.ProductSlug = ""
+			Expect(m.Validate()).To(MatchError(ContainSubstring("product_slug must be set")))
+		})
+
+		It("rejects product files listed twice", func() {
+			m.ProductFiles = []manifest.ProductFile{{AWSObjectKey: "a"}, {AWSObjectKey: "a"}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("product file a is listed more than once")))
+		})
+
+		It("rejects product files without a key", func() {
+			m.ProductFiles = []manifest.ProductFile{{Name: "Tile"}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring(`product file "Tile" has no aws_object_key`)))
+		})
+
+		It("rejects file groups without a name", func() {
+			m.FileGroups = []manifest.FileGroup{{}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("file group has no name")))
+		})
+
+		It("rejects file groups listed twice", func() {
+			m.FileGroups = []manifest.FileGroup{{Name: "g"}, {Name: "g"}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("file group g is listed more than once")))
+		})
+
+		It("rejects product files listed twice in a file group", func() {
+			m.FileGroups = []manifest.FileGroup{
+				{Name: "g", ProductFiles: []manifest.ProductFile{{AWSObjectKey: "a"}, {AWSObjectKey: "a"}}},
+			}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("product file a is listed more than once in file group g")))
+		})
+
+		It("allows a product file to be described once and referred to by key elsewhere", func() {
+			m.ProductFiles = []manifest.ProductFile{{AWSObjectKey: "a", Name: "A"}}
+			m.FileGroups = []manifest.FileGroup{
+				{Name: "g", ProductFiles: []manifest.ProductFile{{AWSObjectKey: "a"}}},
+			}
+			Expect(m.Validate()).To(Succeed())
+		})
+
+		It("rejects a product file described differently in two places", func() {
+			m.ProductFiles = []manifest.ProductFile{{AWSObjectKey: "a", Name: "A"}}
+			m.FileGroups = []manifest.FileGroup{
+				{Name: "g", ProductFiles: []manifest.ProductFile{{AWSObjectKey: "a", Name: "B"}}},
+			}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("product file a is described differently more than once")))
+		})
+
+		It("requires dependencies to name a product and version", func() {
+			m.Dependencies = []manifest.Dependency{{ProductSlug: "other-product"}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("dependencies need a product_slug and version")))
+		})
+
+		It("requires dependency specifiers to name a product and specifier", func() {
+			m.DependencySpecifiers = []manifest.DependencySpecifier{{Specifier: "1.*"}}
+			Expect(m.Validate()).To(MatchError(ContainSubstring("dependency specifiers need a product_slug and specifier")))
+		})
+	})
+})
@@ -0,0 +1,773 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type ActionType string
+
+const (
+	ActionCreate ActionType = "create"
+	ActionUpdate ActionType = "update"
+	ActionAttach ActionType = "attach"
+	ActionDetach ActionType = "detach"
+	ActionDelete ActionType = "delete"
+)
+
+// Action is one change that brings Pivotal Network closer to a manifest.
+type Action struct {
+	Type ActionType
+
+	// Resource is the kind of thing changed, such as "product file".
+	Resource string
+
+	// Name identifies the thing changed, such as a product file's AWS
+	// object key.
+	Name string
+
+	// Target is what the thing is attached to or detached from.
+	Target string
+
+	// Changes are the fields changed by an update.
+	Changes []string
+
+	run func(a *applier) error
+}
+
+func (a Action) String() string {
+	s := fmt.Sprintf("%s %s %s", a.Type, a.Resource, a.Name)
+
+	switch a.Type {
+	case ActionAttach:
+		s += " to " + a.Target
+	case ActionDetach:
+		s += " from " + a.Target
+	case ActionUpdate:
+		if len(a.Changes) > 0 {
+			s += " (" + strings.Join(a.Changes, ", ") + ")"
+		}
+	}
+
+	return s
+}
+
+// applier holds the IDs that actions need. IDs of things created by
+// earlier actions are filled in as they run.
+type applier struct {
+	client         pivnet.Client
+	manifest       Manifest
+	releaseID      int
+	productFileIDs map[string]int
+	fileGroupIDs   map[string]int
+}
+
+// Plan lists the actions that would make Pivotal Network match a manifest,
+// in the order Apply would take them. The list is empty if it already
+// matches.
+func Plan(client pivnet.Client, m Manifest) ([]Action, error) {
+	actions, _, err := plan(client, m)
+	return actions, err
+}
+
+func plan(client pivnet.Client, m Manifest) ([]Action, *applier, error) {
+	err := m.Validate()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p := planner{
+		client:   client,
+		manifest: m,
+		target:   "release " + m.Release.Version,
+		releases: map[string][]pivnet.Release{},
+		applier: &applier{
+			client:         client,
+			manifest:       m,
+			productFileIDs: map[string]int{},
+			fileGroupIDs:   map[string]int{},
+		},
+	}
+
+	steps := []func() error{
+		p.planRelease,
+		p.planProductFiles,
+		p.planFileGroups,
+		p.planUserGroups,
+		p.planDependencies,
+		p.planUpgradePaths,
+		p.planReleaseUpdate,
+	}
+	for _, step := range steps {
+		err := step()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	actions := append(p.actions, p.detaches...)
+	return actions, p.applier, nil
+}
+
+type planner struct {
+	client   pivnet.Client
+	manifest Manifest
+	target   string
+	applier  *applier
+
+	// live is the existing release, or nil if it is yet to be created.
+	live *pivnet.Release
+
+	releases map[string][]pivnet.Release
+	actions  []Action
+
+	// detaches run after every other action, so that nothing is taken
+	// away from the release before its replacement is in place.
+	detaches []Action
+}
+
+func (p *planner) add(action Action) {
+	p.actions = append(p.actions, action)
+}
+
+func (p *planner) detach(action Action) {
+	p.detaches = append(p.detaches, action)
+}
+
+// listReleases lists the releases of a product, treating a product without
+// releases as having none.
+func (p *planner) listReleases(productSlug string) ([]pivnet.Release, error) {
+	if releases, ok := p.releases[productSlug]; ok {
+		return releases, nil
+	}
+
+	releases, err := p.client.Releases.List(productSlug)
+	if err != nil {
+		if _, ok := err.(pivnet.ErrNotFound); !ok {
+			return nil, err
+		}
+	}
+
+	p.releases[productSlug] = releases
+	return releases, nil
+}
+
+func (p *planner) findRelease(productSlug string, version string) (pivnet.Release, error) {
+	releases, err := p.listReleases(productSlug)
+	if err != nil {
+		return pivnet.Release{}, err
+	}
+
+	for _, r := range releases {
+		if r.Version == version {
+			return r, nil
+		}
+	}
+
+	return pivnet.Release{}, fmt.Errorf("release %s of product %s not found", version, productSlug)
+}
+
+func (p *planner) planRelease() error {
+	releases, err := p.listReleases(p.manifest.ProductSlug)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range releases {
+		if r.Version == p.manifest.Release.Version {
+			r := r
+			p.live = &r
+			p.applier.releaseID = r.ID
+			return nil
+		}
+	}
+
+	p.add(Action{
+		Type:     ActionCreate,
+		Resource: "release",
+		Name:     p.manifest.Release.Version,
+		run:      (*applier).createRelease,
+	})
+
+	return nil
+}
+
+// planReleaseUpdate updates the release last, so that a change of
+// availability only happens once everything else is in place.
+func (p *planner) planReleaseUpdate() error {
+	live := pivnet.Release{Availability: "Admins Only"}
+	if p.live != nil {
+		live = *p.live
+	}
+
+	_, changes := releasePatch(p.manifest.Release, live)
+	if p.live == nil {
+		// Everything but availability is set when the release is created.
+		changes = nil
+		if p.manifest.Release.Availability != "" && p.manifest.Release.Availability != live.Availability {
+			changes = []string{"availability"}
+		}
+	}
+
+	if len(changes) > 0 {
+		p.add(Action{
+			Type:     ActionUpdate,
+			Resource: "release",
+			Name:     p.manifest.Release.Version,
+			Changes:  changes,
+			run:      (*applier).updateRelease,
+		})
+	}
+
+	return nil
+}
+
+func (p *planner) planProductFiles() error {
+	files, err := p.manifest.productFiles()
+	if err != nil {
+		return err
+	}
+
+	existing, err := p.client.ProductFiles.List(p.manifest.ProductSlug)
+	if err != nil {
+		return err
+	}
+
+	byKey := map[string]pivnet.ProductFile{}
+	for _, pf := range existing {
+		byKey[pf.AWSObjectKey] = pf
+	}
+
+	for _, key := range p.manifest.productFileKeys() {
+		desired := files[key]
+
+		live, ok := byKey[key]
+		if !ok {
+			p.add(Action{
+				Type:     ActionCreate,
+				Resource: "product file",
+				Name:     key,
+				run:      createProductFile(desired),
+			})
+			continue
+		}
+
+		p.applier.productFileIDs[key] = live.ID
+
+		_, changes := productFilePatch(desired, live)
+		if len(changes) > 0 {
+			p.add(Action{
+				Type:     ActionUpdate,
+				Resource: "product file",
+				Name:     key,
+				Changes:  changes,
+				run:      updateProductFile(desired),
+			})
+		}
+	}
+
+	attached := map[string]bool{}
+	if p.live != nil {
+		releaseFiles, err := p.client.ProductFiles.ListForRelease(p.manifest.ProductSlug, p.live.ID)
+		if err != nil {
+			return err
+		}
+
+		wanted := map[string]bool{}
+		for _, pf := range p.manifest.ProductFiles {
+			wanted[pf.AWSObjectKey] = true
+		}
+
+		for _, pf := range releaseFiles {
+			attached[pf.AWSObjectKey] = true
+			if !wanted[pf.AWSObjectKey] {
+				p.detach(Action{
+					Type:     ActionDetach,
+					Resource: "product file",
+					Name:     pf.AWSObjectKey,
+					Target:   p.target,
+					run:      removeProductFile(pf.ID),
+				})
+			}
+		}
+	}
+
+	for _, pf := range p.manifest.ProductFiles {
+		if !attached[pf.AWSObjectKey] {
+			p.add(Action{
+				Type:     ActionAttach,
+				Resource: "product file",
+				Name:     pf.AWSObjectKey,
+				Target:   p.target,
+				run:      addProductFile(pf.AWSObjectKey),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) planFileGroups() error {
+	existing, err := p.client.FileGroups.List(p.manifest.ProductSlug)
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]pivnet.FileGroup{}
+	for _, fg := range existing {
+		byName[fg.Name] = fg
+	}
+
+	attached := map[int]bool{}
+	if p.live != nil {
+		releaseGroups, err := p.client.FileGroups.ListForRelease(p.manifest.ProductSlug, p.live.ID)
+		if err != nil {
+			return err
+		}
+
+		wanted := map[string]bool{}
+		for _, fg := range p.manifest.FileGroups {
+			wanted[fg.Name] = true
+		}
+
+		for _, fg := range releaseGroups {
+			attached[fg.ID] = true
+			if !wanted[fg.Name] {
+				p.detach(Action{
+					Type:     ActionDetach,
+					Resource: "file group",
+					Name:     fg.Name,
+					Target:   p.target,
+					run:      removeFileGroup(fg.ID),
+				})
+			}
+		}
+	}
+
+	for _, fg := range p.manifest.FileGroups {
+		target := "file group " + fg.Name
+
+		live, ok := byName[fg.Name]
+		if ok {
+			p.applier.fileGroupIDs[fg.Name] = live.ID
+		} else {
+			p.add(Action{
+				Type:     ActionCreate,
+				Resource: "file group",
+				Name:     fg.Name,
+				run:      createFileGroup(fg.Name),
+			})
+		}
+
+		members := map[string]bool{}
+		for _, pf := range live.ProductFiles {
+			members[pf.AWSObjectKey] = true
+		}
+
+		wanted := map[string]bool{}
+		for _, pf := range fg.ProductFiles {
+			wanted[pf.AWSObjectKey] = true
+			if !members[pf.AWSObjectKey] {
+				p.add(Action{
+					Type:     ActionAttach,
+					Resource: "product file",
+					Name:     pf.AWSObjectKey,
+					Target:   target,
+					run:      addToFileGroup(fg.Name, pf.AWSObjectKey),
+				})
+			}
+		}
+
+		for _, pf := range live.ProductFiles {
+			if !wanted[pf.AWSObjectKey] {
+				p.detach(Action{
+					Type:     ActionDetach,
+					Resource: "product file",
+					Name:     pf.AWSObjectKey,
+					Target:   target,
+					run:      removeFromFileGroup(live.ID, pf.ID),
+				})
+			}
+		}
+
+		if !ok || !attached[live.ID] {
+			p.add(Action{
+				Type:     ActionAttach,
+				Resource: "file group",
+				Name:     fg.Name,
+				Target:   p.target,
+				run:      addFileGroup(fg.Name),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) planUserGroups() error {
+	if len(p.manifest.UserGroups) == 0 && p.live == nil {
+		return nil
+	}
+
+	all, err := p.client.UserGroups.List()
+	if err != nil {
+		return err
+	}
+
+	byName := map[string]pivnet.UserGroup{}
+	for _, ug := range all {
+		byName[ug.Name] = ug
+	}
+
+	attached := map[int]bool{}
+	if p.live != nil {
+		releaseGroups, err := p.client.UserGroups.ListForRelease(p.manifest.ProductSlug, p.live.ID)
+		if err != nil {
+			return err
+		}
+
+		wanted := map[string]bool{}
+		for _, name := range p.manifest.UserGroups {
+			wanted[name] = true
+		}
+
+		for _, ug := range releaseGroups {
+			attached[ug.ID] = true
+			if !wanted[ug.Name] {
+				p.detach(Action{
+					Type:     ActionDetach,
+					Resource: "user group",
+					Name:     ug.Name,
+					Target:   p.target,
+					run:      removeUserGroup(ug.ID),
+				})
+			}
+		}
+	}
+
+	for _, name := range p.manifest.UserGroups {
+		ug, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("user group %s not found", name)
+		}
+
+		if !attached[ug.ID] {
+			p.add(Action{
+				Type:     ActionAttach,
+				Resource: "user group",
+				Name:     name,
+				Target:   p.target,
+				run:      addUserGroup(ug.ID),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) planDependencies() error {
+	slug := p.manifest.ProductSlug
+
+	var (
+		dependencies []pivnet.ReleaseDependency
+		specifiers   []pivnet.DependencySpecifier
+	)
+	if p.live != nil {
+		var err error
+		dependencies, err = p.client.ReleaseDependencies.List(slug, p.live.ID)
+		if err != nil {
+			return err
+		}
+
+		specifiers, err = p.client.DependencySpecifiers.List(slug, p.live.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	attached := map[int]bool{}
+	for _, d := range dependencies {
+		attached[d.Release.ID] = true
+	}
+
+	wanted := map[int]bool{}
+	for _, d := range p.manifest.Dependencies {
+		r, err := p.findRelease(d.ProductSlug, d.Version)
+		if err != nil {
+			return err
+		}
+
+		wanted[r.ID] = true
+		if !attached[r.ID] {
+			p.add(Action{
+				Type:     ActionAttach,
+				Resource: "dependency",
+				Name:     d.ProductSlug + " " + d.Version,
+				Target:   p.target,
+				run:      addDependency(r.ID),
+			})
+		}
+	}
+
+	for _, d := range dependencies {
+		if !wanted[d.Release.ID] {
+			p.detach(Action{
+				Type:     ActionDetach,
+				Resource: "dependency",
+				Name:     d.Release.Product.Slug + " " + d.Release.Version,
+				Target:   p.target,
+				run:      removeDependency(d.Release.ID),
+			})
+		}
+	}
+
+	existing := map[DependencySpecifier]bool{}
+	for _, s := range specifiers {
+		existing[DependencySpecifier{ProductSlug: s.Product.Slug, Specifier: s.Specifier}] = true
+	}
+
+	wantedSpecifiers := map[DependencySpecifier]bool{}
+	for _, s := range p.manifest.DependencySpecifiers {
+		wantedSpecifiers[s] = true
+		if !existing[s] {
+			p.add(Action{
+				Type:     ActionCreate,
+				Resource: "dependency specifier",
+				Name:     s.ProductSlug + " " + s.Specifier,
+				run:      createDependencySpecifier(s),
+			})
+		}
+	}
+
+	for _, s := range specifiers {
+		key := DependencySpecifier{ProductSlug: s.Product.Slug, Specifier: s.Specifier}
+		if !wantedSpecifiers[key] {
+			p.detach(Action{
+				Type:     ActionDelete,
+				Resource: "dependency specifier",
+				Name:     key.ProductSlug + " " + key.Specifier,
+				run:      deleteDependencySpecifier(s.ID),
+			})
+		}
+	}
+
+	return nil
+}
+
+func (p *planner) planUpgradePaths() error {
+	slug := p.manifest.ProductSlug
+
+	var (
+		upgradePaths []pivnet.ReleaseUpgradePath
+		specifiers   []pivnet.UpgradePathSpecifier
+	)
+	if p.live != nil {
+		var err error
+		upgradePaths, err = p.client.ReleaseUpgradePaths.Get(slug, p.live.ID)
+		if err != nil {
+			return err
+		}
+
+		specifiers, err = p.client.UpgradePathSpecifiers.List(slug, p.live.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	attached := map[int]bool{}
+	for _, u := range upgradePaths {
+		attached[u.Release.ID] = true
+	}
+
+	wanted := map[int]bool{}
+	for _, version := range p.manifest.UpgradePaths {
+		r, err := p.findRelease(slug, version)
+		if err != nil {
+			return err
+		}
+
+		wanted[r.ID] = true
+		if !attached[r.ID] {
+			p.add(Action{
+				Type:     ActionAttach,
+				Resource: "upgrade path",
+				Name:     version,
+				Target:   p.target,
+				run:      addUpgradePath(r.ID),
+			})
+		}
+	}
+
+	for _, u := range upgradePaths {
+		if !wanted[u.Release.ID] {
+			p.detach(Action{
+				Type:     ActionDetach,
+				Resource: "upgrade path",
+				Name:     u.Release.Version,
+				Target:   p.target,
+				run:      removeUpgradePath(u.Release.ID),
+			})
+		}
+	}
+
+	existing := map[string]bool{}
+	for _, s := range specifiers {
+		existing[s.Specifier] = true
+	}
+
+	wantedSpecifiers := map[string]bool{}
+	for _, s := range p.manifest.UpgradePathSpecifiers {
+		wantedSpecifiers[s] = true
+		if !existing[s] {
+			p.add(Action{
+				Type:     ActionCreate,
+				Resource: "upgrade path specifier",
+				Name:     s,
+				run:      createUpgradePathSpecifier(s),
+			})
+		}
+	}
+
+	for _, s := range specifiers {
+		if !wantedSpecifiers[s.Specifier] {
+			p.detach(Action{
+				Type:     ActionDelete,
+				Resource: "upgrade path specifier",
+				Name:     s.Specifier,
+				run:      deleteUpgradePathSpecifier(s.ID),
+			})
+		}
+	}
+
+	return nil
+}
+
+// productFileKeys returns the key of every product file in the manifest,
+// in the order they first appear.
+func (m Manifest) productFileKeys() []string {
+	var keys []string
+	seen := map[string]bool{}
+
+	add := func(pf ProductFile) {
+		if !seen[pf.AWSObjectKey] {
+			seen[pf.AWSObjectKey] = true
+			keys = append(keys, pf.AWSObjectKey)
+		}
+	}
+
+	for _, pf := range m.ProductFiles {
+		add(pf)
+	}
+	for _, fg := range m.FileGroups {
+		for _, pf := range fg.ProductFiles {
+			add(pf)
+		}
+	}
+
+	return keys
+}
+
+// releasePatch sets the fields in the manifest that differ from a
+// release, and names them.
+func releasePatch(desired Release, live pivnet.Release) (pivnet.ReleasePatch, []string) {
+	var (
+		patch   pivnet.ReleasePatch
+		changes []string
+	)
+
+	set := func(name string, field **string, want string, have string) {
+		if want != "" && want != have {
+			*field = &want
+			changes = append(changes, name)
+		}
+	}
+
+	if desired.ReleaseType != "" && desired.ReleaseType != string(live.ReleaseType) {
+		releaseType := pivnet.ReleaseType(desired.ReleaseType)
+		patch.ReleaseType = &releaseType
+		changes = append(changes, "release type")
+	}
+	set("release date", &patch.ReleaseDate, desired.ReleaseDate, live.ReleaseDate)
+
+	eulaSlug := ""
+	if live.EULA != nil {
+		eulaSlug = live.EULA.Slug
+	}
+	set("eula", &patch.EULASlug, desired.EULASlug, eulaSlug)
+
+	set("description", &patch.Description, desired.Description, live.Description)
+	set("release notes url", &patch.ReleaseNotesURL, desired.ReleaseNotesURL, live.ReleaseNotesURL)
+	if desired.Controlled && !live.Controlled {
+		controlled := true
+		patch.Controlled = &controlled
+		changes = append(changes, "controlled")
+	}
+	set("eccn", &patch.ECCN, desired.ECCN, live.ECCN)
+	set("license exception", &patch.LicenseException, desired.LicenseException, live.LicenseException)
+	set("end of support date", &patch.EndOfSupportDate, desired.EndOfSupportDate, live.EndOfSupportDate)
+	set("end of guidance date", &patch.EndOfGuidanceDate, desired.EndOfGuidanceDate, live.EndOfGuidanceDate)
+	set("end of availability date", &patch.EndOfAvailabilityDate, desired.EndOfAvailabilityDate, live.EndOfAvailabilityDate)
+	set("availability", &patch.Availability, desired.Availability, live.Availability)
+
+	return patch, changes
+}
+
+// productFilePatch sets the fields in the manifest that differ from a
+// product file, and names them. Lists are compared regardless of order.
+func productFilePatch(desired ProductFile, live pivnet.ProductFile) (pivnet.ProductFilePatch, []string) {
+	var (
+		patch   pivnet.ProductFilePatch
+		changes []string
+	)
+
+	set := func(name string, field **string, want string, have string) {
+		if want != "" && want != have {
+			*field = &want
+			changes = append(changes, name)
+		}
+	}
+
+	setList := func(name string, field **[]string, want []string, have []string) {
+		if len(want) > 0 && !sameElements(want, have) {
+			*field = &want
+			changes = append(changes, name)
+		}
+	}
+
+	set("name", &patch.Name, desired.Name, live.Name)
+	set("file type", &patch.FileType, desired.FileType, live.FileType)
+	set("description", &patch.Description, desired.Description, live.Description)
+	set("docs url", &patch.DocsURL, desired.DocsURL, live.DocsURL)
+	set("file version", &patch.FileVersion, desired.FileVersion, live.FileVersion)
+	set("sha256", &patch.SHA256, desired.SHA256, live.SHA256)
+	set("md5", &patch.MD5, desired.MD5, live.MD5)
+	setList("included files", &patch.IncludedFiles, desired.IncludedFiles, live.IncludedFiles)
+	setList("platforms", &patch.Platforms, desired.Platforms, live.Platforms)
+	set("released at", &patch.ReleasedAt, desired.ReleasedAt, live.ReleasedAt)
+	setList("system requirements", &patch.SystemRequirements, desired.SystemRequirements, live.SystemRequirements)
+
+	return patch, changes
+}
+
+// sameElements reports whether two lists hold the same strings, in any
+// order.
+func sameElements(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	counts := map[string]int{}
+	for _, s := range a {
+		counts[s]++
+	}
+	for _, s := range b {
+		counts[s]--
+		if counts[s] < 0 {
+			return false
+		}
+	}
+
+	return true
+}
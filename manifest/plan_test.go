@@ -0,0 +1,206 @@
+package manifest_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/manifest"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+)
+
+func actionStrings(actions []manifest.Action) []string {
+	var s []string
+	for _, a := range actions {
+		s = append(s, a.String())
+	}
+	return s
+}
+
+var _ = Describe("Plan", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+		m      manifest.Manifest
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		server.AddEULA(pivnet.EULA{Slug: "my-eula", Name: "My EULA"})
+		server.AddUserGroup(pivnet.UserGroup{Name: "Beta Testers"})
+		server.AddRelease("my-product", pivnet.Release{Version: "1.2.2"})
+		server.AddRelease("other-product", pivnet.Release{Version: "2.0.0"})
+
+		m = manifest.Manifest{
+			ProductSlug: "my-product",
+			Release: manifest.Release{
+				Version:      "1.2.3",
+				ReleaseType:  "Minor Release",
+				EULASlug:     "my-eula",
+				Availability: "Selected User Groups Only",
+			},
+			ProductFiles: []manifest.ProductFile{
+				{AWSObjectKey: "tile.pivotal", Name: "Tile"},
+			},
+			FileGroups: []manifest.FileGroup{
+				{Name: "Stemcells", ProductFiles: []manifest.ProductFile{{AWSObjectKey: "stemcell.tgz", Name: "Stemcell"}}},
+			},
+			UserGroups:            []string{"Beta Testers"},
+			Dependencies:          []manifest.Dependency{{ProductSlug: "other-product", Version: "2.0.0"}},
+			DependencySpecifiers:  []manifest.DependencySpecifier{{ProductSlug: "other-product", Specifier: "2.0.*"}},
+			UpgradePaths:          []string{"1.2.2"},
+			UpgradePathSpecifiers: []string{"1.1.*"},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("plans a new release and everything attached to it", func() {
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(actionStrings(actions)).To(Equal([]string{
+			"create release 1.2.3",
+			"create product file tile.pivotal",
+			"create product file stemcell.tgz",
+			"attach product file tile.pivotal to release 1.2.3",
+			"create file group Stemcells",
+			"attach product file stemcell.tgz to file group Stemcells",
+			"attach file group Stemcells to release 1.2.3",
+			"attach user group Beta Testers to release 1.2.3",
+			"attach dependency other-product 2.0.0 to release 1.2.3",
+			"create dependency specifier other-product 2.0.*",
+			"attach upgrade path 1.2.2 to release 1.2.3",
+			"create upgrade path specifier 1.1.*",
+			"update release 1.2.3 (availability)",
+		}))
+	})
+
+	It("does not change anything", func() {
+		_, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		releases, err := client.Releases.List("my-product")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releases).To(HaveLen(1))
+
+		productFiles, err := client.ProductFiles.List("my-product")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(BeEmpty())
+	})
+
+	It("plans nothing once the manifest is applied", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actions).To(BeEmpty())
+	})
+
+	It("plans updates to changed fields only", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.Release.Description = "Now with more features"
+		m.ProductFiles[0].Name = "Pivotal Tile"
+		m.ProductFiles[0].FileType = "Documentation"
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actionStrings(actions)).To(Equal([]string{
+			"update product file tile.pivotal (name, file type)",
+			"update release 1.2.3 (description)",
+		}))
+	})
+
+	It("plans updates to every field a product file declares", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.ProductFiles[0].DocsURL = "https://docs.example.com"
+		m.ProductFiles[0].IncludedFiles = []string{"metadata.yml"}
+		m.ProductFiles[0].Platforms = []string{"Linux"}
+		m.ProductFiles[0].ReleasedAt = "2026-10-01"
+		m.ProductFiles[0].SystemRequirements = []string{"4GB RAM"}
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actionStrings(actions)).To(Equal([]string{
+			"update product file tile.pivotal (docs url, included files, platforms, released at, system requirements)",
+		}))
+	})
+
+	It("plans to detach whatever is not in the manifest, last", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.ProductFiles = []manifest.ProductFile{{AWSObjectKey: "readme.txt", Name: "Readme"}}
+		m.FileGroups = nil
+		m.UserGroups = nil
+		m.Dependencies = nil
+		m.DependencySpecifiers = nil
+		m.UpgradePaths = nil
+		m.UpgradePathSpecifiers = nil
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actionStrings(actions)).To(Equal([]string{
+			"create product file readme.txt",
+			"attach product file readme.txt to release 1.2.3",
+			"detach product file tile.pivotal from release 1.2.3",
+			"detach file group Stemcells from release 1.2.3",
+			"detach user group Beta Testers from release 1.2.3",
+			"detach dependency other-product 2.0.0 from release 1.2.3",
+			"delete dependency specifier other-product 2.0.*",
+			"detach upgrade path 1.2.2 from release 1.2.3",
+			"delete upgrade path specifier 1.1.*",
+		}))
+	})
+
+	It("plans changes to a file group's product files", func() {
+		_, err := manifest.Apply(client, m)
+		Expect(err).NotTo(HaveOccurred())
+
+		m.FileGroups[0].ProductFiles = []manifest.ProductFile{{AWSObjectKey: "tile.pivotal"}}
+
+		actions, err := manifest.Plan(client, m)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(actionStrings(actions)).To(Equal([]string{
+			"attach product file tile.pivotal to file group Stemcells",
+			"detach product file stemcell.tgz from file group Stemcells",
+		}))
+	})
+
+	It("fails for an unknown user group", func() {
+		m.UserGroups = []string{"Nobody"}
+
+		_, err := manifest.Plan(client, m)
+		Expect(err).To(MatchError("user group Nobody not found"))
+	})
+
+	It("fails for an unknown dependency", func() {
+		m.Dependencies = []manifest.Dependency{{ProductSlug: "other-product", Version: "9.9.9"}}
+
+		_, err := manifest.Plan(client, m)
+		Expect(err).To(MatchError("release 9.9.9 of product other-product not found"))
+	})
+
+	It("fails for an unknown upgrade path", func() {
+		m.UpgradePaths = []string{"0.0.1"}
+
+		_, err := manifest.Plan(client, m)
+		Expect(err).To(MatchError("release 0.0.1 of product my-product not found"))
+	})
+
+	It("fails for an invalid manifest", func() {
+		m.Release.Version = ""
+
+		_, err := manifest.Plan(client, m)
+		Expect(err).To(MatchError(ContainSubstring("release version must be set")))
+	})
+})
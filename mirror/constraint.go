@@ -0,0 +1,270 @@
+package mirror
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Constraint selects release versions. It is a list of alternatives
+// separated by "||", each a comma separated list of comparisons that must
+// all hold, such as ">= 2.1, < 3 || 1.12.x". The operators are =, !=, >,
+// >=, <, <= and ~>, the pessimistic operator: "~> 2.1" allows 2.1 up to but
+// not including 3, and "~> 2.1.3" allows 2.1.3 up to but not including
+// 2.2. A version without an operator may end in x or * to match any
+// version with the same leading components. An empty constraint, or "*",
+// matches every version.
+type Constraint struct {
+	raw          string
+	alternatives [][]comparison
+}
+
+type comparison struct {
+	op       string
+	version  version
+	wildcard bool
+}
+
+// ParseConstraint parses a version constraint.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: s}
+
+	if strings.TrimSpace(s) == "" {
+		return c, nil
+	}
+
+	for _, alternative := range strings.Split(s, "||") {
+		var comparisons []comparison
+
+		for _, clause := range strings.Split(alternative, ",") {
+			comp, err := parseComparison(strings.TrimSpace(clause))
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid version constraint %q: %s", s, err)
+			}
+
+			comparisons = append(comparisons, comp...)
+		}
+
+		c.alternatives = append(c.alternatives, comparisons)
+	}
+
+	return c, nil
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// Matches reports whether v satisfies the constraint.
+func (c Constraint) Matches(v string) bool {
+	if len(c.alternatives) == 0 {
+		return true
+	}
+
+	parsed := parseVersion(v)
+
+	for _, comparisons := range c.alternatives {
+		matched := true
+		for _, comp := range comparisons {
+			if !comp.matches(parsed) {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseComparison(clause string) ([]comparison, error) {
+	if clause == "" {
+		return nil, fmt.Errorf("empty clause")
+	}
+
+	op := "="
+	for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+		if strings.HasPrefix(clause, candidate) {
+			op = candidate
+			clause = strings.TrimSpace(strings.TrimPrefix(clause, candidate))
+			break
+		}
+	}
+
+	if clause == "" {
+		return nil, fmt.Errorf("missing version after %s", op)
+	}
+
+	if clause == "*" || clause == "x" {
+		if op != "=" {
+			return nil, fmt.Errorf("wildcard cannot be used with %s", op)
+		}
+		return nil, nil
+	}
+
+	if strings.HasSuffix(clause, ".x") || strings.HasSuffix(clause, ".*") {
+		if op != "=" {
+			return nil, fmt.Errorf("wildcard cannot be used with %s", op)
+		}
+
+		v := parseVersion(strings.TrimSuffix(strings.TrimSuffix(clause, ".x"), ".*"))
+		return []comparison{{op: "=", version: v, wildcard: true}}, nil
+	}
+
+	v := parseVersion(clause)
+	if len(v.core) == 0 || v.core[0] == "" {
+		return nil, fmt.Errorf("invalid version %q", clause)
+	}
+
+	if op == "~>" {
+		if len(v.core) < 2 {
+			return nil, fmt.Errorf("~> needs at least a major and minor version")
+		}
+
+		upper := make([]string, len(v.core)-1)
+		copy(upper, v.core)
+
+		last, err := strconv.Atoi(upper[len(upper)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version %q", clause)
+		}
+		upper[len(upper)-1] = strconv.Itoa(last + 1)
+
+		return []comparison{
+			{op: ">=", version: v},
+			{op: "<", version: version{core: upper}},
+		}, nil
+	}
+
+	return []comparison{{op: op, version: v}}, nil
+}
+
+func (c comparison) matches(v version) bool {
+	if c.wildcard {
+		if len(v.core) < len(c.version.core) {
+			return false
+		}
+		for i, part := range c.version.core {
+			if comparePart(part, v.core[i]) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	result := compareVersions(v, c.version)
+
+	switch c.op {
+	case "=":
+		return result == 0
+	case "!=":
+		return result != 0
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+
+	return false
+}
+
+// version is a dotted version with an optional pre-release suffix after the
+// first "-". Build metadata after "+" is ignored.
+type version struct {
+	core []string
+	pre  []string
+}
+
+func parseVersion(s string) version {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+
+	var v version
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+	v.core = strings.Split(s, ".")
+
+	return v
+}
+
+// CompareVersions orders release versions: it returns a negative number
+// when a is older than b, zero when they are equal and a positive number
+// otherwise. Numeric components are compared as numbers, missing
+// components count as zero, and a pre-release is older than its release.
+func CompareVersions(a, b string) int {
+	return compareVersions(parseVersion(a), parseVersion(b))
+}
+
+func compareVersions(a, b version) int {
+	if result := compareParts(a.core, b.core, "0"); result != 0 {
+		return result
+	}
+
+	switch {
+	case len(a.pre) == 0 && len(b.pre) == 0:
+		return 0
+	case len(a.pre) == 0:
+		return 1
+	case len(b.pre) == 0:
+		return -1
+	}
+
+	return compareParts(a.pre, b.pre, "")
+}
+
+// compareParts compares component lists. A missing component takes the
+// value of missing or, when missing is empty, makes its list the lesser.
+func compareParts(a, b []string, missing string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		if missing == "" {
+			if i >= len(a) {
+				return -1
+			}
+			if i >= len(b) {
+				return 1
+			}
+		}
+
+		x, y := missing, missing
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+
+		if result := comparePart(x, y); result != 0 {
+			return result
+		}
+	}
+
+	return 0
+}
+
+func comparePart(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+
+	switch {
+	case errA == nil && errB == nil:
+		return x - y
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+
+	return strings.Compare(a, b)
+}
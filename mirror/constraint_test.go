@@ -0,0 +1,72 @@
+package mirror_test
+
+import (
+	"github.com/pivotal-cf/go-pivnet/mirror"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Constraint", func() {
+	matches := func(constraint string, version string) bool {
+		c, err := mirror.ParseConstraint(constraint)
+		Expect(err).NotTo(HaveOccurred())
+		return c.Matches(version)
+	}
+
+	It("matches every version when empty", func() {
+		Expect(matches("", "1.2.3")).To(BeTrue())
+		Expect(matches("*", "1.2.3")).To(BeTrue())
+	})
+
+	It("compares versions", func() {
+		Expect(matches("1.2.3", "1.2.3")).To(BeTrue())
+		Expect(matches("= 1.2", "1.2.0")).To(BeTrue())
+		Expect(matches("1.2.3", "1.2.4")).To(BeFalse())
+		Expect(matches("!= 1.2.3", "1.2.3")).To(BeFalse())
+		Expect(matches("> 2.9", "2.10")).To(BeTrue())
+		Expect(matches("< 2.1.0", "2.1.0-rc.1")).To(BeTrue())
+		Expect(matches("= 2.1.0", "2.1.0+build.5")).To(BeTrue())
+	})
+
+	It("requires every comparison of an alternative", func() {
+		Expect(matches(">= 2.1, < 3", "2.4.10")).To(BeTrue())
+		Expect(matches(">= 2.1, < 3", "3.0.0")).To(BeFalse())
+		Expect(matches(">= 2.1, < 3", "2.0.9")).To(BeFalse())
+	})
+
+	It("matches any alternative", func() {
+		Expect(matches("1.12.x || >= 2.1", "1.12.7")).To(BeTrue())
+		Expect(matches("1.12.x || >= 2.1", "2.3.0")).To(BeTrue())
+		Expect(matches("1.12.x || >= 2.1", "1.13.0")).To(BeFalse())
+	})
+
+	It("matches wildcards", func() {
+		Expect(matches("2.*", "2.7.1")).To(BeTrue())
+		Expect(matches("2.1.x", "2.1.4")).To(BeTrue())
+		Expect(matches("2.1.x", "2.10.0")).To(BeFalse())
+	})
+
+	It("matches the pessimistic operator", func() {
+		Expect(matches("~> 2.1", "2.9.0")).To(BeTrue())
+		Expect(matches("~> 2.1", "3.0.0")).To(BeFalse())
+		Expect(matches("~> 2.1.3", "2.1.9")).To(BeTrue())
+		Expect(matches("~> 2.1.3", "2.1.2")).To(BeFalse())
+		Expect(matches("~> 2.1.3", "2.2.0")).To(BeFalse())
+	})
+
+	It("returns an error for invalid constraints", func() {
+		for _, constraint := range []string{">= 1.0,", ">=", "> 1.x", "~> 2"} {
+			_, err := mirror.ParseConstraint(constraint)
+			Expect(err).To(MatchError(ContainSubstring("invalid version constraint")), constraint)
+		}
+	})
+
+	It("orders versions", func() {
+		Expect(mirror.CompareVersions("1.10.0", "1.9.0")).To(BeNumerically(">", 0))
+		Expect(mirror.CompareVersions("1.0", "1.0.0")).To(BeZero())
+		Expect(mirror.CompareVersions("1.0.0-rc.1", "1.0.0-rc.2")).To(BeNumerically("<", 0))
+		Expect(mirror.CompareVersions("1.0.0-rc", "1.0.0-rc.1")).To(BeNumerically("<", 0))
+		Expect(mirror.CompareVersions("1.0.0-rc.10", "1.0.0")).To(BeNumerically("<", 0))
+	})
+})
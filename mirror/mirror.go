@@ -0,0 +1,505 @@
+// Package mirror keeps a local directory tree of product releases in sync
+// with Pivotal Network, for copying to sites without network access.
+//
+// Each release is mirrored to <directory>/<product slug>/<version>, next to
+// a metadata file describing the release and its files.
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+// MetadataFileName is the name of the metadata file written to the
+// directory of every mirrored release.
+const MetadataFileName = "pivnet-release.json"
+
+const releaseDateLayout = "2006-01-02"
+
+type Config struct {
+	// Directory is the root of the mirror.
+	Directory string
+
+	Products []ProductConfig
+
+	// Concurrency and Progress configure the downloads of each release, as
+	// in pivnet.DownloadManager.
+	Concurrency int
+	Progress    pivnet.ProgressReporter
+}
+
+type ProductConfig struct {
+	Slug string
+
+	// Versions is a version constraint, as understood by ParseConstraint.
+	// When empty, every release is mirrored.
+	Versions string
+
+	// Globs, if set, limits the mirrored files to those matching at least
+	// one of the patterns, as pivnet.DownloadPlanConfig's Globs do.
+	Globs []string
+
+	Retention Retention
+}
+
+// Retention limits the releases of a product kept in the mirror. Releases
+// outside the limits are not downloaded, and are removed if they were
+// mirrored before. Zero values impose no limit.
+type Retention struct {
+	// KeepLast keeps only the newest matching versions.
+	KeepLast int
+
+	// MaxAge keeps only releases published within this duration.
+	// Releases without a valid release date are kept.
+	MaxAge time.Duration
+}
+
+// Metadata is the content of a release's metadata file.
+type Metadata struct {
+	ProductSlug string         `json:"product_slug"`
+	Release     pivnet.Release `json:"release"`
+	Files       []FileMetadata `json:"files"`
+	SyncedAt    time.Time      `json:"synced_at"`
+}
+
+type FileMetadata struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	FileType  string `json:"file_type,omitempty"`
+	FileGroup string `json:"file_group,omitempty"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256,omitempty"`
+	MD5       string `json:"md5,omitempty"`
+}
+
+// Mirror syncs the configured products into a directory.
+type Mirror struct {
+	client   pivnet.Client
+	manager  pivnet.DownloadManager
+	config   Config
+	versions []Constraint
+}
+
+func New(client pivnet.Client, config Config) (*Mirror, error) {
+	if config.Directory == "" {
+		return nil, fmt.Errorf("mirror directory must be set")
+	}
+
+	m := &Mirror{
+		client:  client,
+		manager: pivnet.NewDownloadManager(client),
+		config:  config,
+	}
+	m.manager.Concurrency = config.Concurrency
+	m.manager.Progress = config.Progress
+
+	for _, p := range config.Products {
+		if p.Slug == "" {
+			return nil, fmt.Errorf("product slug must be set")
+		}
+
+		c, err := ParseConstraint(p.Versions)
+		if err != nil {
+			return nil, err
+		}
+		m.versions = append(m.versions, c)
+	}
+
+	return m, nil
+}
+
+type Report struct {
+	Products []ProductReport
+}
+
+type ProductReport struct {
+	Slug string
+
+	// Releases holds the releases that were synced, newest first.
+	Releases []ReleaseReport
+
+	// Pruned holds the directories of releases removed by retention.
+	Pruned []string
+
+	// Err is set when the product could not be synced at all.
+	Err error
+}
+
+type ReleaseReport struct {
+	Release   pivnet.Release
+	Directory string
+
+	// Results has an entry for every file of the release. Files unchanged
+	// since the last sync are reported as skipped.
+	Results []pivnet.DownloadResult
+
+	// Removed holds files that were mirrored before but are no longer part
+	// of the release.
+	Removed []string
+
+	// Err is set when the release could not be planned or its metadata
+	// could not be written.
+	Err error
+}
+
+// Err summarizes the failures of a sync, or returns nil if there were none.
+func (r Report) Err() error {
+	var failures []string
+
+	for _, p := range r.Products {
+		if p.Err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", p.Slug, p.Err))
+		}
+
+		for _, rr := range p.Releases {
+			if rr.Err != nil {
+				failures = append(failures, fmt.Sprintf("%s %s: %s", p.Slug, rr.Release.Version, rr.Err))
+			}
+
+			for _, result := range rr.Results {
+				if result.Status == pivnet.DownloadStatusFailed {
+					failures = append(failures, fmt.Sprintf("%s: %s", result.Path, result.Err))
+				}
+			}
+		}
+	}
+
+	if len(failures) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("mirror sync had %d failure(s), first: %s", len(failures), failures[0])
+}
+
+// Sync brings every configured product up to date. Products are synced one
+// after another and failures are recorded in the report rather than
+// stopping the sync.
+func (m *Mirror) Sync(ctx context.Context) Report {
+	var report Report
+
+	for i, p := range m.config.Products {
+		report.Products = append(report.Products, m.syncProduct(ctx, p, m.versions[i]))
+	}
+
+	return report
+}
+
+func (m *Mirror) syncProduct(ctx context.Context, config ProductConfig, versions Constraint) ProductReport {
+	report := ProductReport{Slug: config.Slug}
+
+	releases, err := m.client.Releases.List(config.Slug)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	wanted := selectReleases(releases, versions, config.Retention, time.Now())
+
+	for _, release := range wanted {
+		if ctx.Err() != nil {
+			report.Err = ctx.Err()
+			return report
+		}
+
+		report.Releases = append(report.Releases, m.syncRelease(ctx, config, release))
+	}
+
+	report.Pruned, err = m.prune(config.Slug, wanted)
+	if err != nil {
+		report.Err = err
+	}
+
+	return report
+}
+
+// selectReleases returns the releases to mirror, newest first.
+func selectReleases(releases []pivnet.Release, versions Constraint, retention Retention, now time.Time) []pivnet.Release {
+	var selected []pivnet.Release
+
+	for _, r := range releases {
+		if !versions.Matches(r.Version) {
+			continue
+		}
+
+		if retention.MaxAge > 0 {
+			date, err := time.Parse(releaseDateLayout, r.ReleaseDate)
+			if err == nil && date.Before(now.Add(-retention.MaxAge)) {
+				continue
+			}
+		}
+
+		selected = append(selected, r)
+	}
+
+	sort.SliceStable(selected, func(i, j int) bool {
+		return CompareVersions(selected[i].Version, selected[j].Version) > 0
+	})
+
+	if retention.KeepLast > 0 && len(selected) > retention.KeepLast {
+		selected = selected[:retention.KeepLast]
+	}
+
+	return selected
+}
+
+func (m *Mirror) syncRelease(ctx context.Context, config ProductConfig, release pivnet.Release) ReleaseReport {
+	dir := ReleaseDirectory(m.config.Directory, config.Slug, release)
+	report := ReleaseReport{Release: release, Directory: dir}
+
+	plan, err := m.manager.Plan(pivnet.DownloadPlanConfig{
+		ProductSlug: config.Slug,
+		ReleaseID:   release.ID,
+		Globs:       config.Globs,
+		Directory:   dir,
+	})
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	for _, planned := range plan {
+		if filepath.Base(planned.Path) == MetadataFileName {
+			report.Err = fmt.Errorf("product file %d is named %s, which the mirror uses for metadata", planned.ProductFile.ID, MetadataFileName)
+			return report
+		}
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	previous, err := ReadMetadata(dir)
+	if err != nil && !os.IsNotExist(err) {
+		report.Err = err
+		return report
+	}
+
+	unchanged := map[int]FileMetadata{}
+	var changed []pivnet.PlannedDownload
+	for _, planned := range plan {
+		if f, ok := unchangedFile(previous, release, planned); ok {
+			unchanged[planned.ProductFile.ID] = f
+		} else {
+			changed = append(changed, planned)
+		}
+	}
+
+	downloads := m.manager.Download(ctx, changed).Results
+
+	metadata := Metadata{
+		ProductSlug: config.Slug,
+		Release:     release,
+		SyncedAt:    time.Now().UTC(),
+	}
+
+	for _, planned := range plan {
+		var result pivnet.DownloadResult
+		var file FileMetadata
+
+		if f, ok := unchanged[planned.ProductFile.ID]; ok {
+			result = pivnet.DownloadResult{PlannedDownload: planned, Status: pivnet.DownloadStatusSkipped}
+			file = f
+		} else {
+			result, downloads = downloads[0], downloads[1:]
+			file = fileMetadata(result.PlannedDownload)
+		}
+
+		report.Results = append(report.Results, result)
+
+		if result.Status != pivnet.DownloadStatusFailed {
+			metadata.Files = append(metadata.Files, file)
+		}
+	}
+
+	report.Removed, err = removeStaleFiles(dir, previous, plan)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	err = WriteMetadata(dir, metadata)
+	if err != nil {
+		report.Err = err
+	}
+
+	return report
+}
+
+// unchangedFile reports whether a planned file was mirrored by the previous
+// sync and has not changed since, without reading its contents. A file is
+// unchanged if the release's files were not updated, the file's checksum,
+// when listed, is the same, and the file on disk has the recorded size.
+func unchangedFile(previous Metadata, release pivnet.Release, planned pivnet.PlannedDownload) (FileMetadata, bool) {
+	if previous.Release.ID != release.ID || previous.Release.SoftwareFilesUpdatedAt != release.SoftwareFilesUpdatedAt {
+		return FileMetadata{}, false
+	}
+
+	for _, f := range previous.Files {
+		if f.ID != planned.ProductFile.ID || f.Name != filepath.Base(planned.Path) {
+			continue
+		}
+
+		if planned.ProductFile.SHA256 != "" && !strings.EqualFold(planned.ProductFile.SHA256, f.SHA256) {
+			return FileMetadata{}, false
+		}
+
+		info, err := os.Stat(planned.Path)
+		if err != nil || info.Size() != int64(f.Size) {
+			return FileMetadata{}, false
+		}
+
+		return f, true
+	}
+
+	return FileMetadata{}, false
+}
+
+func fileMetadata(planned pivnet.PlannedDownload) FileMetadata {
+	return FileMetadata{
+		ID:        planned.ProductFile.ID,
+		Name:      filepath.Base(planned.Path),
+		FileType:  planned.ProductFile.FileType,
+		FileGroup: planned.FileGroup,
+		Size:      planned.ProductFile.Size,
+		SHA256:    planned.ProductFile.SHA256,
+		MD5:       planned.ProductFile.MD5,
+	}
+}
+
+// removeStaleFiles deletes files recorded in the previous metadata that are
+// no longer planned. Files the mirror did not write are left alone.
+func removeStaleFiles(dir string, previous Metadata, plan []pivnet.PlannedDownload) ([]string, error) {
+	planned := map[string]bool{}
+	for _, p := range plan {
+		planned[filepath.Base(p.Path)] = true
+	}
+
+	var removed []string
+	for _, f := range previous.Files {
+		if planned[f.Name] || f.Name != filepath.Base(f.Name) {
+			continue
+		}
+
+		path := filepath.Join(dir, f.Name)
+		err := os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("failed to remove stale file: %s", err)
+		}
+		removed = append(removed, path)
+	}
+
+	return removed, nil
+}
+
+// prune removes the mirrored releases of a product that are not wanted.
+// Only directories with a metadata file are considered.
+func (m *Mirror) prune(slug string, wanted []pivnet.Release) ([]string, error) {
+	keep := map[int]bool{}
+	for _, r := range wanted {
+		keep[r.ID] = true
+	}
+
+	productDir := filepath.Join(m.config.Directory, slug)
+
+	entries, err := ioutil.ReadDir(productDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(productDir, entry.Name())
+
+		metadata, err := ReadMetadata(dir)
+		if err != nil || keep[metadata.Release.ID] {
+			continue
+		}
+
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return pruned, fmt.Errorf("failed to prune %s: %s", dir, err)
+		}
+		pruned = append(pruned, dir)
+	}
+
+	return pruned, nil
+}
+
+// ReadMetadata reads the metadata file of a mirrored release directory.
+func ReadMetadata(dir string) (Metadata, error) {
+	var metadata Metadata
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, MetadataFileName))
+	if err != nil {
+		return metadata, err
+	}
+
+	err = json.Unmarshal(b, &metadata)
+	if err != nil {
+		return metadata, fmt.Errorf("invalid metadata in %s: %s", dir, err)
+	}
+
+	return metadata, nil
+}
+
+// WriteMetadata replaces the metadata file of dir through a temporary file,
+// so an interrupted write leaves the previous metadata in place.
+func WriteMetadata(dir string, metadata Metadata) error {
+	b, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+MetadataFileName+"-")
+	if err != nil {
+		return fmt.Errorf("failed to write metadata: %s", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write metadata: %s", err)
+	}
+
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write metadata: %s", err)
+	}
+
+	err = os.Chmod(f.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), filepath.Join(dir, MetadataFileName))
+}
+
+// ReleaseDirectory returns the directory a release is mirrored to, named
+// after its version.
+func ReleaseDirectory(root string, productSlug string, release pivnet.Release) string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(release.Version)
+	if name == "" || name == "." || name == ".." {
+		name = fmt.Sprintf("release-%d", release.ID)
+	}
+
+	return filepath.Join(root, productSlug, name)
+}
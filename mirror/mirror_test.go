@@ -0,0 +1,238 @@
+package mirror_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/mirror"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mirror", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+		dir    string
+		config mirror.Config
+
+		releases map[string]pivnet.Release
+		tiles    map[string]pivnet.ProductFile
+	)
+
+	daysAgo := func(days int) string {
+		return time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+	}
+
+	addRelease := func(version string, releaseDate string) {
+		r := server.AddRelease("banana", pivnet.Release{Version: version, ReleaseDate: releaseDate})
+		releases[version] = r
+
+		tiles[version] = server.AddProductFile("banana", r.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/banana-" + version + ".pivotal",
+			FileType:     pivnet.FileTypeSoftware,
+		}, []byte("tile "+version))
+		server.AddProductFile("banana", r.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/release-notes.pdf",
+			FileType:     pivnet.FileTypeDocumentation,
+		}, []byte("notes "+version))
+	}
+
+	sync := func() mirror.Report {
+		m, err := mirror.New(client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		report := m.Sync(context.Background())
+		Expect(report.Err()).NotTo(HaveOccurred())
+		return report
+	}
+
+	versionsIn := func(slug string) []string {
+		entries, err := ioutil.ReadDir(filepath.Join(dir, slug))
+		Expect(err).NotTo(HaveOccurred())
+
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		releases = map[string]pivnet.Release{}
+		tiles = map[string]pivnet.ProductFile{}
+
+		addRelease("1.12.4", daysAgo(400))
+		addRelease("2.0.1", daysAgo(90))
+		addRelease("2.1.0", daysAgo(30))
+		addRelease("2.1.1", daysAgo(2))
+
+		var err error
+		dir, err = ioutil.TempDir("", "mirror")
+		Expect(err).NotTo(HaveOccurred())
+
+		config = mirror.Config{
+			Directory: dir,
+			Products: []mirror.ProductConfig{
+				{Slug: "banana", Versions: ">= 2.0"},
+			},
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("mirrors matching releases into product and version directories", func() {
+		report := sync()
+
+		Expect(versionsIn("banana")).To(Equal([]string{"2.0.1", "2.1.0", "2.1.1"}))
+
+		Expect(report.Products).To(HaveLen(1))
+		Expect(report.Products[0].Releases).To(HaveLen(3))
+		Expect(report.Products[0].Releases[0].Release.Version).To(Equal("2.1.1"))
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "banana", "2.1.1", "banana-2.1.1.pivotal"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("tile 2.1.1"))
+	})
+
+	It("writes metadata next to the files", func() {
+		sync()
+
+		metadata, err := mirror.ReadMetadata(filepath.Join(dir, "banana", "2.1.1"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(metadata.ProductSlug).To(Equal("banana"))
+		Expect(metadata.Release.ID).To(Equal(releases["2.1.1"].ID))
+		Expect(metadata.Files).To(HaveLen(2))
+		Expect(metadata.Files[0]).To(Equal(mirror.FileMetadata{
+			ID:       tiles["2.1.1"].ID,
+			Name:     "banana-2.1.1.pivotal",
+			FileType: pivnet.FileTypeSoftware,
+			Size:     tiles["2.1.1"].Size,
+			SHA256:   tiles["2.1.1"].SHA256,
+			MD5:      tiles["2.1.1"].MD5,
+		}))
+	})
+
+	It("applies file globs", func() {
+		config.Products[0].Globs = []string{"*.pivotal"}
+		sync()
+
+		entries, err := ioutil.ReadDir(filepath.Join(dir, "banana", "2.1.1"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Name()).To(Equal("banana-2.1.1.pivotal"))
+		Expect(entries[1].Name()).To(Equal(mirror.MetadataFileName))
+	})
+
+	It("only downloads new or changed files", func() {
+		sync()
+		Expect(server.Downloads(tiles["2.1.1"].ID)).To(Equal(1))
+
+		addRelease("2.2.0", daysAgo(0))
+		server.SetContents(tiles["2.1.0"].ID, []byte("rebuilt tile 2.1.0"))
+
+		report := sync()
+
+		Expect(server.Downloads(tiles["2.1.1"].ID)).To(Equal(1))
+		Expect(server.Downloads(tiles["2.1.0"].ID)).To(Equal(2))
+		Expect(server.Downloads(tiles["2.2.0"].ID)).To(Equal(1))
+
+		for _, result := range report.Products[0].Releases[1].Results {
+			Expect(result.Status).To(Equal(pivnet.DownloadStatusSkipped))
+		}
+
+		contents, err := ioutil.ReadFile(filepath.Join(dir, "banana", "2.1.0", "banana-2.1.0.pivotal"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("rebuilt tile 2.1.0"))
+	})
+
+	It("downloads files that were removed or truncated locally", func() {
+		sync()
+
+		path := filepath.Join(dir, "banana", "2.1.1", "banana-2.1.1.pivotal")
+		Expect(ioutil.WriteFile(path, []byte("tile"), 0644)).To(Succeed())
+
+		sync()
+
+		Expect(server.Downloads(tiles["2.1.1"].ID)).To(Equal(2))
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(Equal("tile 2.1.1"))
+	})
+
+	It("removes files no longer mirrored", func() {
+		sync()
+
+		config.Products[0].Globs = []string{"*.pivotal"}
+		report := sync()
+
+		Expect(report.Products[0].Releases[0].Removed).To(ConsistOf(
+			filepath.Join(dir, "banana", "2.1.1", "release-notes.pdf"),
+		))
+
+		_, err := os.Stat(filepath.Join(dir, "banana", "2.1.1", "release-notes.pdf"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("keeps the last N versions", func() {
+		sync()
+
+		config.Products[0].Retention.KeepLast = 2
+		report := sync()
+
+		Expect(versionsIn("banana")).To(Equal([]string{"2.1.0", "2.1.1"}))
+		Expect(report.Products[0].Pruned).To(Equal([]string{filepath.Join(dir, "banana", "2.0.1")}))
+	})
+
+	It("keeps versions released within the maximum age", func() {
+		config.Products[0].Versions = ""
+		config.Products[0].Retention.MaxAge = 60 * 24 * time.Hour
+		sync()
+
+		Expect(versionsIn("banana")).To(Equal([]string{"2.1.0", "2.1.1"}))
+	})
+
+	It("leaves directories it did not create alone", func() {
+		Expect(os.MkdirAll(filepath.Join(dir, "banana", "notes"), 0755)).To(Succeed())
+
+		config.Products[0].Retention.KeepLast = 1
+		sync()
+
+		Expect(versionsIn("banana")).To(Equal([]string{"2.1.1", "notes"}))
+	})
+
+	It("reports products that cannot be synced and continues", func() {
+		config.Products = append([]mirror.ProductConfig{{Slug: "missing"}}, config.Products...)
+
+		m, err := mirror.New(client, config)
+		Expect(err).NotTo(HaveOccurred())
+
+		report := m.Sync(context.Background())
+		Expect(report.Products[0].Err).To(HaveOccurred())
+		Expect(report.Products[1].Releases).To(HaveLen(3))
+		Expect(report.Err()).To(MatchError(ContainSubstring("mirror sync had 1 failure(s), first: missing:")))
+	})
+
+	It("returns an error for an invalid configuration", func() {
+		config.Products[0].Versions = ">="
+		_, err := mirror.New(client, config)
+		Expect(err).To(MatchError(ContainSubstring("invalid version constraint")))
+
+		_, err = mirror.New(client, mirror.Config{})
+		Expect(err).To(MatchError("mirror directory must be set"))
+	})
+})
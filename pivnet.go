@@ -1,6 +1,7 @@
 package pivnet
 
 import (
+	"context"
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
@@ -12,6 +13,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/pivotal-cf/go-pivnet/cache"
 	"github.com/pivotal-cf/go-pivnet/download"
 	"github.com/pivotal-cf/go-pivnet/logger"
 	"log"
@@ -33,6 +35,7 @@ type Client struct {
 	HTTP *http.Client
 
 	downloader download.Client
+	cache      *cache.Cache
 
 	Auth                  *AuthService
 	EULA                  *EULAsService
@@ -40,6 +43,7 @@ type Client struct {
 	FileGroups            *FileGroupsService
 	Releases              *ReleasesService
 	Products              *ProductsService
+	ExperimentalProducts  *ExperimentalProductsService
 	UserGroups            *UserGroupsService
 	ReleaseTypes          *ReleaseTypesService
 	ReleaseDependencies   *ReleaseDependenciesService
@@ -53,6 +57,24 @@ type ClientConfig struct {
 	Token             string
 	UserAgent         string
 	SkipSSLValidation bool
+
+	// DownloadWorkers, DownloadMinChunkSize and DownloadMaxChunkSize tune
+	// the parallel downloader. Zero values select the download package
+	// defaults.
+	DownloadWorkers      int
+	DownloadMinChunkSize int64
+	DownloadMaxChunkSize int64
+
+	// DownloadPreallocate reserves disk space for a download before it starts.
+	DownloadPreallocate bool
+
+	// DownloadLimiter caps the bandwidth of downloads. It may be shared
+	// between clients and adjusted while downloads are running.
+	DownloadLimiter *download.Limiter
+
+	// Cache, if set, is checked for a product file's SHA256 before it is
+	// downloaded, and receives every verified download.
+	Cache *cache.Cache
 }
 
 func NewClient(
@@ -81,11 +103,29 @@ func NewClient(
 		},
 	}
 
-	ranger := download.NewRanger(concurrentDownloads)
+	minChunkSize := config.DownloadMinChunkSize
+	if minChunkSize <= 0 {
+		minChunkSize = download.DefaultMinChunkSize
+	}
+
+	maxChunkSize := config.DownloadMaxChunkSize
+	if maxChunkSize <= 0 {
+		maxChunkSize = download.DefaultMaxChunkSize
+	}
+
+	ranger := download.NewRangerWithConfig(download.RangerConfig{
+		NumHunks:     concurrentDownloads,
+		MinChunkSize: minChunkSize,
+		MaxChunkSize: maxChunkSize,
+	})
 	downloader := download.Client{
-		HTTPClient: downloadClient,
-		Ranger:     ranger,
-		Logger:     logger,
+		HTTPClient:   downloadClient,
+		Ranger:       ranger,
+		Logger:       logger,
+		Workers:      config.DownloadWorkers,
+		MinSplitSize: minChunkSize,
+		Preallocate:  config.DownloadPreallocate,
+		Limiter:      config.DownloadLimiter,
 	}
 
 	client := Client{
@@ -94,6 +134,7 @@ func NewClient(
 		userAgent:  config.UserAgent,
 		logger:     logger,
 		downloader: downloader,
+		cache:      config.Cache,
 		HTTP:       httpClient,
 	}
 
@@ -103,6 +144,7 @@ func NewClient(
 	client.FileGroups = &FileGroupsService{client: client}
 	client.Releases = &ReleasesService{client: client, l: logger}
 	client.Products = &ProductsService{client: client, l: logger}
+	client.ExperimentalProducts = &ExperimentalProductsService{client: client, l: logger}
 	client.UserGroups = &UserGroupsService{client: client}
 	client.ReleaseTypes = &ReleaseTypesService{client: client}
 	client.ReleaseDependencies = &ReleaseDependenciesService{client: client}
@@ -157,11 +199,24 @@ func (c Client) MakeRequest(
 	endpoint string,
 	expectedStatusCode int,
 	body io.Reader,
+) (*http.Response, error) {
+	return c.makeRequestWithContext(context.Background(), requestType, endpoint, expectedStatusCode, body)
+}
+
+// makeRequestWithContext is like MakeRequest, but the request is canceled
+// when ctx is done.
+func (c Client) makeRequestWithContext(
+	ctx context.Context,
+	requestType string,
+	endpoint string,
+	expectedStatusCode int,
+	body io.Reader,
 ) (*http.Response, error) {
 	req, err := c.CreateRequest(requestType, endpoint, body)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 
 	reqBytes, err := httputil.DumpRequestOut(req, true)
 	if err != nil {
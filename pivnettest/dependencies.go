@@ -0,0 +1,269 @@
+package pivnettest
+
+import (
+	"net/http"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type dependencyBody struct {
+	Dependency struct {
+		ReleaseID int `json:"release_id"`
+	} `json:"dependency"`
+}
+
+type upgradePathBody struct {
+	UpgradePath struct {
+		ReleaseID int `json:"release_id"`
+	} `json:"upgrade_path"`
+}
+
+type dependencySpecifierBody struct {
+	DependencySpecifier struct {
+		ProductSlug string `json:"product_slug"`
+		Specifier   string `json:"specifier"`
+	} `json:"dependency_specifier"`
+}
+
+type upgradePathSpecifierBody struct {
+	UpgradePathSpecifier struct {
+		Specifier string `json:"specifier"`
+	} `json:"upgrade_path_specifier"`
+}
+
+func (s *Server) listDependencies(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.ReleaseDependenciesResponse{ReleaseDependencies: r.dependencies}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) addDependency(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body dependencyBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	dependency, ok := s.releases[body.Dependency.ReleaseID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "dependent release not found")
+		return
+	}
+
+	for _, d := range r.dependencies {
+		if d.Release.ID == dependency.ID {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	r.dependencies = append(r.dependencies, pivnet.ReleaseDependency{
+		Release: pivnet.DependentRelease{
+			ID:      dependency.ID,
+			Version: dependency.Version,
+			Product: pivnet.Product{Slug: dependency.productSlug},
+		},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeDependency(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body dependencyBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	for i, d := range r.dependencies {
+		if d.Release.ID == body.Dependency.ReleaseID {
+			r.dependencies = append(r.dependencies[:i:i], r.dependencies[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "dependency not found")
+}
+
+func (s *Server) listUpgradePaths(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.ReleaseUpgradePathsResponse{ReleaseUpgradePaths: r.upgradePaths}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) addUpgradePath(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body upgradePathBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	from, ok := s.releases[body.UpgradePath.ReleaseID]
+	if !ok || from.productSlug != r.productSlug {
+		writeError(w, http.StatusNotFound, "previous release not found")
+		return
+	}
+
+	for _, u := range r.upgradePaths {
+		if u.Release.ID == from.ID {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	r.upgradePaths = append(r.upgradePaths, pivnet.ReleaseUpgradePath{
+		Release: pivnet.UpgradePathRelease{ID: from.ID, Version: from.Version},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeUpgradePath(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body upgradePathBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	for i, u := range r.upgradePaths {
+		if u.Release.ID == body.UpgradePath.ReleaseID {
+			r.upgradePaths = append(r.upgradePaths[:i:i], r.upgradePaths[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "upgrade path not found")
+}
+
+func (s *Server) listDependencySpecifiers(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.DependencySpecifiersResponse{DependencySpecifiers: r.dependencySpecifiers}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createDependencySpecifier(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body dependencySpecifierBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if body.DependencySpecifier.ProductSlug == "" || body.DependencySpecifier.Specifier == "" {
+		writeError(w, http.StatusUnprocessableEntity, "product_slug and specifier are required")
+		return
+	}
+
+	specifier := pivnet.DependencySpecifier{
+		ID:        s.id(),
+		Product:   pivnet.Product{Slug: body.DependencySpecifier.ProductSlug},
+		Specifier: body.DependencySpecifier.Specifier,
+	}
+	r.dependencySpecifiers = append(r.dependencySpecifiers, specifier)
+
+	writeJSON(w, http.StatusCreated, pivnet.DependencySpecifierResponse{DependencySpecifier: specifier})
+}
+
+func (s *Server) deleteDependencySpecifier(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	id := atoi(args[2])
+	for i, d := range r.dependencySpecifiers {
+		if d.ID == id {
+			r.dependencySpecifiers = append(r.dependencySpecifiers[:i:i], r.dependencySpecifiers[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "dependency specifier not found")
+}
+
+func (s *Server) listUpgradePathSpecifiers(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.UpgradePathSpecifiersResponse{UpgradePathSpecifiers: r.upgradePathSpecifiers}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createUpgradePathSpecifier(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body upgradePathSpecifierBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if body.UpgradePathSpecifier.Specifier == "" {
+		writeError(w, http.StatusUnprocessableEntity, "specifier is required")
+		return
+	}
+
+	specifier := pivnet.UpgradePathSpecifier{
+		ID:        s.id(),
+		Specifier: body.UpgradePathSpecifier.Specifier,
+	}
+	r.upgradePathSpecifiers = append(r.upgradePathSpecifiers, specifier)
+
+	writeJSON(w, http.StatusCreated, pivnet.UpgradePathSpecifierResponse{UpgradePathSpecifier: specifier})
+}
+
+func (s *Server) deleteUpgradePathSpecifier(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	id := atoi(args[2])
+	for i, u := range r.upgradePathSpecifiers {
+		if u.ID == id {
+			r.upgradePathSpecifiers = append(r.upgradePathSpecifiers[:i:i], r.upgradePathSpecifiers[i+1:]...)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, "upgrade path specifier not found")
+}
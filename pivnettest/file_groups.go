@@ -0,0 +1,215 @@
+package pivnettest
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type fileGroupBody struct {
+	FileGroup struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	} `json:"file_group"`
+}
+
+func (s *Server) fileGroup(w http.ResponseWriter, productSlug string, fileGroupID int) (*fileGroup, bool) {
+	fg, ok := s.fileGroups[fileGroupID]
+	if !ok || fg.productSlug != productSlug {
+		writeError(w, http.StatusNotFound, "file group not found")
+		return nil, false
+	}
+
+	return fg, true
+}
+
+func removeFromFileGroup(fg *fileGroup, productFileID int) bool {
+	for i, pf := range fg.ProductFiles {
+		if pf.ID == productFileID {
+			fg.ProductFiles = append(fg.ProductFiles[:i:i], fg.ProductFiles[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) listFileGroups(w http.ResponseWriter, req *http.Request, args []string) {
+	var ids []int
+	for id, fg := range s.fileGroups {
+		if fg.productSlug == args[0] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	response := pivnet.FileGroupsResponse{FileGroups: []pivnet.FileGroup{}}
+	for _, id := range ids {
+		response.FileGroups = append(response.FileGroups, s.fileGroups[id].FileGroup)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	var body fileGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if body.FileGroup.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "name is required")
+		return
+	}
+
+	fg := &fileGroup{
+		FileGroup:   pivnet.FileGroup{ID: s.id(), Name: body.FileGroup.Name},
+		productSlug: args[0],
+	}
+	s.fileGroups[fg.ID] = fg
+
+	writeJSON(w, http.StatusCreated, fg.FileGroup)
+}
+
+func (s *Server) getFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	fg, ok := s.fileGroup(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, fg.FileGroup)
+}
+
+func (s *Server) updateFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	fg, ok := s.fileGroup(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	var body fileGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if body.FileGroup.Name != "" {
+		fg.Name = body.FileGroup.Name
+	}
+
+	writeJSON(w, http.StatusOK, fg.FileGroup)
+}
+
+// deleteFileGroup deletes a file group and removes it from every release.
+// Its product files are kept.
+func (s *Server) deleteFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	fg, ok := s.fileGroup(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	delete(s.fileGroups, fg.ID)
+	for _, r := range s.releases {
+		r.fileGroups, _ = remove(r.fileGroups, fg.ID)
+	}
+
+	writeJSON(w, http.StatusOK, fg.FileGroup)
+}
+
+func (s *Server) addProductFileToFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	fg, ok := s.fileGroup(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	var body productFileBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	pf, ok := s.productFile(w, args[0], body.ProductFile.ID)
+	if !ok {
+		return
+	}
+
+	removeFromFileGroup(fg, pf.ID)
+	fg.ProductFiles = append(fg.ProductFiles, pf.ProductFile)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeProductFileFromFileGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	fg, ok := s.fileGroup(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	var body productFileBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if !removeFromFileGroup(fg, body.ProductFile.ID) {
+		writeError(w, http.StatusNotFound, "product file not found in file group")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listFileGroupsForRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.FileGroupsResponse{FileGroups: []pivnet.FileGroup{}}
+	for _, id := range r.fileGroups {
+		response.FileGroups = append(response.FileGroups, s.fileGroups[id].FileGroup)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) addFileGroupToRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body fileGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	fg, ok := s.fileGroup(w, args[0], body.FileGroup.ID)
+	if !ok {
+		return
+	}
+
+	if !contains(r.fileGroups, fg.ID) {
+		r.fileGroups = append(r.fileGroups, fg.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeFileGroupFromRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body fileGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	var removed bool
+	r.fileGroups, removed = remove(r.fileGroups, body.FileGroup.ID)
+	if !removed {
+		writeError(w, http.StatusNotFound, "file group not found in release")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package pivnettest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type productFileBody struct {
+	ProductFile pivnet.ProductFile `json:"product_file"`
+}
+
+// productFile finds a product file of a product by its ID.
+func (s *Server) productFile(w http.ResponseWriter, productSlug string, productFileID int) (*productFile, bool) {
+	pf, ok := s.productFiles[productFileID]
+	if !ok || pf.productSlug != productSlug {
+		writeError(w, http.StatusNotFound, "product file not found")
+		return nil, false
+	}
+
+	return pf, true
+}
+
+func (s *Server) releaseFile(w http.ResponseWriter, args []string) (*productFile, bool) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return nil, false
+	}
+
+	id := atoi(args[2])
+	if !contains(r.productFiles, id) {
+		writeError(w, http.StatusNotFound, "product file not found")
+		return nil, false
+	}
+
+	return s.productFiles[id], true
+}
+
+// inRelease returns a product file with its download link for a release.
+func (s *Server) inRelease(pf *productFile, releaseID int) pivnet.ProductFile {
+	productFile := pf.ProductFile
+	productFile.Links = &pivnet.Links{
+		Download: map[string]string{
+			"href": fmt.Sprintf("%s%s/products/%s/releases/%d/product_files/%d/download", s.URL, apiPrefix, pf.productSlug, releaseID, pf.ID),
+		},
+	}
+
+	return productFile
+}
+
+func (s *Server) listProductFiles(w http.ResponseWriter, req *http.Request, args []string) {
+	var ids []int
+	for id, pf := range s.productFiles {
+		if pf.productSlug == args[0] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	response := pivnet.ProductFilesResponse{ProductFiles: []pivnet.ProductFile{}}
+	for _, id := range ids {
+		response.ProductFiles = append(response.ProductFiles, s.productFiles[id].ProductFile)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// createProductFile stores a product file without contents. It is not
+// added to any release.
+func (s *Server) createProductFile(w http.ResponseWriter, req *http.Request, args []string) {
+	var body productFileBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	pf := body.ProductFile
+	if pf.AWSObjectKey == "" {
+		writeError(w, http.StatusUnprocessableEntity, "aws_object_key is required")
+		return
+	}
+
+	pf.ID = s.id()
+	pf.UpdatedAt = timestamp()
+	s.productFiles[pf.ID] = &productFile{ProductFile: pf, productSlug: args[0]}
+
+	writeJSON(w, http.StatusCreated, pivnet.ProductFileResponse{ProductFile: pf})
+}
+
+func (s *Server) getProductFile(w http.ResponseWriter, req *http.Request, args []string) {
+	pf, ok := s.productFile(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pivnet.ProductFileResponse{ProductFile: pf.ProductFile})
+}
+
+// updateProductFile changes the fields present in the request, like the
+// real API.
+func (s *Server) updateProductFile(w http.ResponseWriter, req *http.Request, args []string) {
+	pf, ok := s.productFile(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	body := productFileBody{ProductFile: pf.ProductFile}
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	body.ProductFile.ID = pf.ID
+	body.ProductFile.UpdatedAt = timestamp()
+	pf.ProductFile = body.ProductFile
+	s.updateFileGroupCopies(pf.ProductFile)
+
+	writeJSON(w, http.StatusOK, pivnet.ProductFileResponse{ProductFile: pf.ProductFile})
+}
+
+// deleteProductFile deletes a product file and removes it from every
+// release and file group.
+func (s *Server) deleteProductFile(w http.ResponseWriter, req *http.Request, args []string) {
+	pf, ok := s.productFile(w, args[0], atoi(args[1]))
+	if !ok {
+		return
+	}
+
+	delete(s.productFiles, pf.ID)
+
+	for _, r := range s.releases {
+		r.productFiles, _ = remove(r.productFiles, pf.ID)
+	}
+	for _, fg := range s.fileGroups {
+		removeFromFileGroup(fg, pf.ID)
+	}
+
+	writeJSON(w, http.StatusOK, pivnet.ProductFileResponse{ProductFile: pf.ProductFile})
+}
+
+func (s *Server) listProductFilesForRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.ProductFilesResponse{ProductFiles: []pivnet.ProductFile{}}
+	for _, id := range r.productFiles {
+		response.ProductFiles = append(response.ProductFiles, s.inRelease(s.productFiles[id], r.ID))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getProductFileForRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	pf, ok := s.releaseFile(w, args)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, pivnet.ProductFileResponse{ProductFile: s.inRelease(pf, atoi(args[1]))})
+}
+
+func (s *Server) downloadLink(w http.ResponseWriter, req *http.Request, args []string) {
+	pf, ok := s.releaseFile(w, args)
+	if !ok {
+		return
+	}
+
+	s.downloads[pf.ID]++
+
+	w.Header().Set("Location", fmt.Sprintf("%s/files/%d", s.URL, pf.ID))
+	writeJSON(w, http.StatusFound, struct{}{})
+}
+
+func (s *Server) addProductFileToRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body productFileBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	pf, ok := s.productFile(w, args[0], body.ProductFile.ID)
+	if !ok {
+		return
+	}
+
+	if !contains(r.productFiles, pf.ID) {
+		r.productFiles = append(r.productFiles, pf.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeProductFileFromRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body productFileBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	var removed bool
+	r.productFiles, removed = remove(r.productFiles, body.ProductFile.ID)
+	if !removed {
+		writeError(w, http.StatusNotFound, "product file not found in release")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
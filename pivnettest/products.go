@@ -0,0 +1,192 @@
+package pivnettest
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type product struct {
+	pivnet.Product
+	settings pivnet.ProductSettings
+}
+
+type productBody struct {
+	Product pivnet.Product `json:"product"`
+}
+
+type productSettingsBody struct {
+	Settings pivnet.ProductSettings `json:"settings"`
+}
+
+func (s *Server) product(w http.ResponseWriter, slug string) (*product, bool) {
+	p, ok := s.products[slug]
+	if !ok {
+		writeError(w, http.StatusNotFound, "product not found")
+		return nil, false
+	}
+
+	return p, true
+}
+
+func (s *Server) hasReleases(productSlug string) bool {
+	for _, r := range s.releases {
+		if r.productSlug == productSlug {
+			return true
+		}
+	}
+
+	return false
+}
+
+// renameProduct moves everything of a product to a new slug.
+func (s *Server) renameProduct(from string, to string) {
+	p := s.products[from]
+	delete(s.products, from)
+	p.Slug = to
+	s.products[to] = p
+
+	for _, r := range s.releases {
+		if r.productSlug == from {
+			r.productSlug = to
+		}
+	}
+	for _, pf := range s.productFiles {
+		if pf.productSlug == from {
+			pf.productSlug = to
+		}
+	}
+	for _, fg := range s.fileGroups {
+		if fg.productSlug == from {
+			fg.productSlug = to
+		}
+	}
+}
+
+func (s *Server) listProducts(w http.ResponseWriter, req *http.Request, args []string) {
+	var slugs []string
+	for slug := range s.products {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	response := pivnet.ProductsResponse{Products: []pivnet.Product{}}
+	for _, slug := range slugs {
+		response.Products = append(response.Products, s.products[slug].Product)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createProduct(w http.ResponseWriter, req *http.Request, args []string) {
+	var body productBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	p := body.Product
+	if p.Slug == "" || p.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "slug and name are required")
+		return
+	}
+	if _, ok := s.products[p.Slug]; ok {
+		writeError(w, http.StatusUnprocessableEntity, "slug has already been taken")
+		return
+	}
+
+	p.ID = s.id()
+	s.products[p.Slug] = &product{Product: p}
+
+	writeJSON(w, http.StatusCreated, p)
+}
+
+func (s *Server) getProduct(w http.ResponseWriter, req *http.Request, args []string) {
+	p, ok := s.product(w, args[0])
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, p.Product)
+}
+
+// updateProduct changes the fields present in the request. A change of
+// slug carries the product's releases, product files and file groups
+// with it.
+func (s *Server) updateProduct(w http.ResponseWriter, req *http.Request, args []string) {
+	p, ok := s.product(w, args[0])
+	if !ok {
+		return
+	}
+
+	body := productBody{Product: p.Product}
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	updated := body.Product
+	updated.ID = p.ID
+	if updated.Slug == "" || updated.Name == "" {
+		writeError(w, http.StatusUnprocessableEntity, "slug and name are required")
+		return
+	}
+	if updated.Slug != p.Slug {
+		if _, ok := s.products[updated.Slug]; ok {
+			writeError(w, http.StatusUnprocessableEntity, "slug has already been taken")
+			return
+		}
+		s.renameProduct(p.Slug, updated.Slug)
+	}
+	p.Product = updated
+
+	writeJSON(w, http.StatusOK, p.Product)
+}
+
+// deleteProduct deletes a product that has no releases.
+func (s *Server) deleteProduct(w http.ResponseWriter, req *http.Request, args []string) {
+	p, ok := s.product(w, args[0])
+	if !ok {
+		return
+	}
+
+	if s.hasReleases(p.Slug) {
+		writeError(w, http.StatusUnprocessableEntity, "product has releases")
+		return
+	}
+
+	delete(s.products, p.Slug)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getProductSettings(w http.ResponseWriter, req *http.Request, args []string) {
+	p, ok := s.product(w, args[0])
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, productSettingsBody{Settings: p.settings})
+}
+
+func (s *Server) updateProductSettings(w http.ResponseWriter, req *http.Request, args []string) {
+	p, ok := s.product(w, args[0])
+	if !ok {
+		return
+	}
+
+	var body productSettingsBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if slug := body.Settings.DefaultEULASlug; slug != "" {
+		if _, ok := s.eulas[slug]; !ok {
+			writeError(w, http.StatusUnprocessableEntity, "eula not found")
+			return
+		}
+	}
+
+	p.settings = body.Settings
+
+	writeJSON(w, http.StatusOK, productSettingsBody{Settings: p.settings})
+}
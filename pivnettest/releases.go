@@ -0,0 +1,193 @@
+package pivnettest
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type releaseBody struct {
+	Release      pivnet.Release `json:"release"`
+	CopyMetadata bool           `json:"copy_metadata"`
+}
+
+func (s *Server) release(w http.ResponseWriter, productSlug string, releaseID string) (*release, bool) {
+	r, ok := s.releases[atoi(releaseID)]
+	if !ok || r.productSlug != productSlug {
+		writeError(w, http.StatusNotFound, "release not found")
+		return nil, false
+	}
+
+	return r, true
+}
+
+func (s *Server) hasVersion(productSlug string, version string, exceptID int) bool {
+	for id, r := range s.releases {
+		if id != exceptID && r.productSlug == productSlug && r.Version == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// resolveEULA replaces a release's EULA with the stored EULA of the same
+// slug, without its content.
+func (s *Server) resolveEULA(w http.ResponseWriter, r *pivnet.Release) bool {
+	if r.EULA == nil || r.EULA.Slug == "" {
+		r.EULA = nil
+		return true
+	}
+
+	eula, ok := s.eulas[r.EULA.Slug]
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "eula not found")
+		return false
+	}
+
+	eula.Content = ""
+	r.EULA = &eula
+
+	return true
+}
+
+func (s *Server) listReleases(w http.ResponseWriter, req *http.Request, args []string) {
+	var ids []int
+	for id, r := range s.releases {
+		if r.productSlug == args[0] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	// Products not added to the server are known through their releases.
+	if _, ok := s.products[args[0]]; !ok && len(ids) == 0 {
+		writeError(w, http.StatusNotFound, "product not found")
+		return
+	}
+
+	response := pivnet.ReleasesResponse{Releases: []pivnet.Release{}}
+	for _, id := range ids {
+		response.Releases = append(response.Releases, s.releases[id].Release)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	var body releaseBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	r := body.Release
+	if r.Version == "" {
+		writeError(w, http.StatusUnprocessableEntity, "version is required")
+		return
+	}
+	if s.hasVersion(args[0], r.Version, 0) {
+		writeError(w, http.StatusUnprocessableEntity, "version has already been taken")
+		return
+	}
+	if !s.resolveEULA(w, &r) {
+		return
+	}
+
+	if r.Availability == "" {
+		r.Availability = "Admins Only"
+	}
+	r.ID = s.id()
+	r.UpdatedAt = timestamp()
+
+	s.releases[r.ID] = &release{Release: r, productSlug: args[0]}
+
+	writeJSON(w, http.StatusCreated, pivnet.CreateReleaseResponse{Release: r})
+}
+
+func (s *Server) getRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, r.Release)
+}
+
+// updateRelease changes the fields present in the request, like the real
+// API.
+func (s *Server) updateRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	body := releaseBody{Release: r.Release}
+	if r.EULA != nil {
+		eula := *r.EULA
+		body.Release.EULA = &eula
+	}
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	updated := body.Release
+	if s.hasVersion(args[0], updated.Version, r.ID) {
+		writeError(w, http.StatusUnprocessableEntity, "version has already been taken")
+		return
+	}
+	if updated.EULA == nil || r.EULA == nil || updated.EULA.Slug != r.EULA.Slug {
+		if !s.resolveEULA(w, &updated) {
+			return
+		}
+	}
+
+	updated.ID = r.ID
+	updated.UpdatedAt = timestamp()
+	r.Release = updated
+
+	writeJSON(w, http.StatusOK, pivnet.CreateReleaseResponse{Release: updated})
+}
+
+func (s *Server) deleteRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	delete(s.releases, r.ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listReleaseTypes(w http.ResponseWriter, req *http.Request, args []string) {
+	response := pivnet.ReleaseTypesResponse{ReleaseTypes: append([]pivnet.ReleaseType{}, s.releaseTypes...)}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) listEULAs(w http.ResponseWriter, req *http.Request, args []string) {
+	var slugs []string
+	for slug := range s.eulas {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	response := pivnet.EULAsResponse{EULAs: []pivnet.EULA{}}
+	for _, slug := range slugs {
+		eula := s.eulas[slug]
+		eula.Content = ""
+		response.EULAs = append(response.EULAs, eula)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getEULA(w http.ResponseWriter, req *http.Request, args []string) {
+	eula, ok := s.eulas[args[0]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "eula not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, eula)
+}
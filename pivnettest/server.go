@@ -0,0 +1,516 @@
+// Package pivnettest provides an in-memory Pivotal Network API server for
+// tests of code built on go-pivnet.
+package pivnettest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+const (
+	apiPrefix = "/api/v2"
+
+	// Token is accepted by the server as a legacy API token.
+	Token = "pivnettest-token"
+)
+
+var filePath = regexp.MustCompile(`^/files/(\d+)$`)
+
+type route struct {
+	method  string
+	pattern *regexp.Regexp
+	handler func(w http.ResponseWriter, req *http.Request, args []string)
+}
+
+type release struct {
+	pivnet.Release
+	productSlug           string
+	productFiles          []int
+	fileGroups            []int
+	userGroups            []int
+	dependencies          []pivnet.ReleaseDependency
+	upgradePaths          []pivnet.ReleaseUpgradePath
+	dependencySpecifiers  []pivnet.DependencySpecifier
+	upgradePathSpecifiers []pivnet.UpgradePathSpecifier
+}
+
+type failure struct {
+	method     string
+	path       string
+	statusCode int
+	remaining  int
+}
+
+type productFile struct {
+	pivnet.ProductFile
+	productSlug string
+	contents    []byte
+}
+
+type fileGroup struct {
+	pivnet.FileGroup
+	productSlug string
+}
+
+// Server is a fake Pivotal Network. Products, releases, product files and
+// file groups are added with the Add methods or through the API, and served
+// through the same endpoints as the real API. Product file contents are served with
+// support for HEAD and range requests.
+type Server struct {
+	*httptest.Server
+
+	mu           sync.Mutex
+	nextID       int
+	products     map[string]*product
+	releases     map[int]*release
+	productFiles map[int]*productFile
+	fileGroups   map[int]*fileGroup
+	userGroups   map[int]*pivnet.UserGroup
+	eulas        map[string]pivnet.EULA
+	releaseTypes []pivnet.ReleaseType
+	downloads    map[int]int
+	failures     []*failure
+	routes       []route
+}
+
+func NewServer() *Server {
+	s := &Server{
+		products:     map[string]*product{},
+		releases:     map[int]*release{},
+		productFiles: map[int]*productFile{},
+		fileGroups:   map[int]*fileGroup{},
+		userGroups:   map[int]*pivnet.UserGroup{},
+		eulas:        map[string]pivnet.EULA{},
+		downloads:    map[int]int{},
+		releaseTypes: []pivnet.ReleaseType{
+			"Major Release",
+			"Minor Release",
+			"Maintenance Release",
+			"Security Release",
+			"Beta Release",
+			"Alpha Release",
+			"Developer Release",
+		},
+	}
+
+	s.route("GET", `/products`, s.listProducts)
+	s.route("POST", `/products`, s.createProduct)
+	s.route("GET", `/products/([^/]+)`, s.getProduct)
+	s.route("PATCH", `/products/([^/]+)`, s.updateProduct)
+	s.route("DELETE", `/products/([^/]+)`, s.deleteProduct)
+	s.route("GET", `/products/([^/]+)/settings`, s.getProductSettings)
+	s.route("PUT", `/products/([^/]+)/settings`, s.updateProductSettings)
+
+	s.route("GET", `/products/([^/]+)/releases`, s.listReleases)
+	s.route("POST", `/products/([^/]+)/releases`, s.createRelease)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)`, s.getRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)`, s.updateRelease)
+	s.route("DELETE", `/products/([^/]+)/releases/(\d+)`, s.deleteRelease)
+
+	s.route("GET", `/releases/release_types`, s.listReleaseTypes)
+
+	s.route("GET", `/eulas`, s.listEULAs)
+	s.route("GET", `/eulas/([^/]+)`, s.getEULA)
+
+	s.route("GET", `/products/([^/]+)/product_files`, s.listProductFiles)
+	s.route("POST", `/products/([^/]+)/product_files`, s.createProductFile)
+	s.route("GET", `/products/([^/]+)/product_files/(\d+)`, s.getProductFile)
+	s.route("PATCH", `/products/([^/]+)/product_files/(\d+)`, s.updateProductFile)
+	s.route("DELETE", `/products/([^/]+)/product_files/(\d+)`, s.deleteProductFile)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/product_files`, s.listProductFilesForRelease)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/product_files/(\d+)`, s.getProductFileForRelease)
+	s.route("POST", `/products/([^/]+)/releases/(\d+)/product_files/(\d+)/download`, s.downloadLink)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/add_product_file`, s.addProductFileToRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/remove_product_file`, s.removeProductFileFromRelease)
+
+	s.route("GET", `/products/([^/]+)/file_groups`, s.listFileGroups)
+	s.route("POST", `/products/([^/]+)/file_groups`, s.createFileGroup)
+	s.route("GET", `/products/([^/]+)/file_groups/(\d+)`, s.getFileGroup)
+	s.route("PATCH", `/products/([^/]+)/file_groups/(\d+)`, s.updateFileGroup)
+	s.route("DELETE", `/products/([^/]+)/file_groups/(\d+)`, s.deleteFileGroup)
+	s.route("PATCH", `/products/([^/]+)/file_groups/(\d+)/add_product_file`, s.addProductFileToFileGroup)
+	s.route("PATCH", `/products/([^/]+)/file_groups/(\d+)/remove_product_file`, s.removeProductFileFromFileGroup)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/file_groups`, s.listFileGroupsForRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/add_file_group`, s.addFileGroupToRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/remove_file_group`, s.removeFileGroupFromRelease)
+
+	s.route("GET", `/user_groups`, s.listUserGroups)
+	s.route("GET", `/user_groups/(\d+)`, s.getUserGroup)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/user_groups`, s.listUserGroupsForRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/add_user_group`, s.addUserGroupToRelease)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/remove_user_group`, s.removeUserGroupFromRelease)
+
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/dependencies`, s.listDependencies)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/add_dependency`, s.addDependency)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/remove_dependency`, s.removeDependency)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/upgrade_paths`, s.listUpgradePaths)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/add_upgrade_path`, s.addUpgradePath)
+	s.route("PATCH", `/products/([^/]+)/releases/(\d+)/remove_upgrade_path`, s.removeUpgradePath)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/dependency_specifiers`, s.listDependencySpecifiers)
+	s.route("POST", `/products/([^/]+)/releases/(\d+)/dependency_specifiers`, s.createDependencySpecifier)
+	s.route("DELETE", `/products/([^/]+)/releases/(\d+)/dependency_specifiers/(\d+)`, s.deleteDependencySpecifier)
+	s.route("GET", `/products/([^/]+)/releases/(\d+)/upgrade_path_specifiers`, s.listUpgradePathSpecifiers)
+	s.route("POST", `/products/([^/]+)/releases/(\d+)/upgrade_path_specifiers`, s.createUpgradePathSpecifier)
+	s.route("DELETE", `/products/([^/]+)/releases/(\d+)/upgrade_path_specifiers/(\d+)`, s.deleteUpgradePathSpecifier)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// ClientConfig returns the configuration for a client of this server.
+func (s *Server) ClientConfig() pivnet.ClientConfig {
+	return pivnet.ClientConfig{
+		Host:      s.URL,
+		Token:     Token,
+		UserAgent: "pivnettest",
+	}
+}
+
+// AddProduct stores a product and returns it with its ID assigned.
+func (s *Server) AddProduct(p pivnet.Product) pivnet.Product {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p.ID = s.id()
+	s.products[p.Slug] = &product{Product: p}
+
+	return p
+}
+
+// AddRelease stores a release of the given product and returns it with its
+// ID assigned.
+func (s *Server) AddRelease(productSlug string, r pivnet.Release) pivnet.Release {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r.ID = s.id()
+	if r.UpdatedAt == "" {
+		r.UpdatedAt = timestamp()
+	}
+	s.releases[r.ID] = &release{Release: r, productSlug: productSlug}
+
+	return r
+}
+
+// AddProductFile stores a product file with the given contents and adds it
+// to a release. The ID, size, checksums and download link are derived
+// unless already set.
+func (s *Server) AddProductFile(productSlug string, releaseID int, pf pivnet.ProductFile, contents []byte) pivnet.ProductFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRelease(productSlug, releaseID)
+
+	pf.ID = s.id()
+	if pf.Size == 0 {
+		pf.Size = len(contents)
+	}
+	if pf.SHA256 == "" {
+		sum := sha256.Sum256(contents)
+		pf.SHA256 = hex.EncodeToString(sum[:])
+	}
+	if pf.MD5 == "" {
+		sum := md5.Sum(contents)
+		pf.MD5 = hex.EncodeToString(sum[:])
+	}
+	if pf.AWSObjectKey == "" {
+		pf.AWSObjectKey = fmt.Sprintf("product-files/%s/file-%d", productSlug, pf.ID)
+	}
+	if pf.UpdatedAt == "" {
+		pf.UpdatedAt = timestamp()
+	}
+	pf.Links = &pivnet.Links{
+		Download: map[string]string{
+			"href": fmt.Sprintf("%s%s/products/%s/releases/%d/product_files/%d/download", s.URL, apiPrefix, productSlug, releaseID, pf.ID),
+		},
+	}
+
+	s.productFiles[pf.ID] = &productFile{ProductFile: pf, productSlug: productSlug, contents: contents}
+	r.productFiles = append(r.productFiles, pf.ID)
+
+	return pf
+}
+
+// SetContents replaces the contents of a product file and updates its size
+// and checksums to match.
+func (s *Server) SetContents(productFileID int, contents []byte) pivnet.ProductFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pf, ok := s.productFiles[productFileID]
+	if !ok {
+		panic(fmt.Sprintf("pivnettest: no product file %d", productFileID))
+	}
+
+	sha256sum := sha256.Sum256(contents)
+	md5sum := md5.Sum(contents)
+
+	pf.contents = contents
+	pf.Size = len(contents)
+	pf.SHA256 = hex.EncodeToString(sha256sum[:])
+	pf.MD5 = hex.EncodeToString(md5sum[:])
+	pf.UpdatedAt = timestamp()
+
+	s.updateFileGroupCopies(pf.ProductFile)
+
+	return pf.ProductFile
+}
+
+// AddFileGroup creates a file group of existing product files and adds it
+// to a release.
+func (s *Server) AddFileGroup(productSlug string, releaseID int, name string, productFileIDs ...int) pivnet.FileGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRelease(productSlug, releaseID)
+
+	fg := &fileGroup{FileGroup: pivnet.FileGroup{ID: s.id(), Name: name}, productSlug: productSlug}
+	for _, id := range productFileIDs {
+		pf, ok := s.productFiles[id]
+		if !ok {
+			panic(fmt.Sprintf("pivnettest: no product file %d", id))
+		}
+		fg.ProductFiles = append(fg.ProductFiles, pf.ProductFile)
+	}
+
+	s.fileGroups[fg.ID] = fg
+	r.fileGroups = append(r.fileGroups, fg.ID)
+
+	return fg.FileGroup
+}
+
+// AddUserGroup stores a user group and returns it with its ID assigned.
+func (s *Server) AddUserGroup(ug pivnet.UserGroup) pivnet.UserGroup {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ug.ID = s.id()
+	s.userGroups[ug.ID] = &ug
+
+	return ug
+}
+
+// AddEULA stores a EULA, served by its slug.
+func (s *Server) AddEULA(eula pivnet.EULA) pivnet.EULA {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	eula.ID = s.id()
+	s.eulas[eula.Slug] = eula
+
+	return eula
+}
+
+// SetReleaseTypes replaces the release types served by the server.
+func (s *Server) SetReleaseTypes(releaseTypes ...pivnet.ReleaseType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.releaseTypes = releaseTypes
+}
+
+// AddDependency makes a release depend on another.
+func (s *Server) AddDependency(productSlug string, releaseID int, dependency pivnet.DependentRelease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRelease(productSlug, releaseID)
+	r.dependencies = append(r.dependencies, pivnet.ReleaseDependency{Release: dependency})
+}
+
+// AddUpgradePath records that a release can be upgraded from another.
+func (s *Server) AddUpgradePath(productSlug string, releaseID int, from pivnet.UpgradePathRelease) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.mustRelease(productSlug, releaseID)
+	r.upgradePaths = append(r.upgradePaths, pivnet.ReleaseUpgradePath{Release: from})
+}
+
+// Fail makes the next n API requests with the given method and path, such
+// as "/products/banana/releases/1/add_product_file", fail with the given
+// status code without taking effect.
+func (s *Server) Fail(method string, path string, statusCode int, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		method:     method,
+		path:       apiPrefix + path,
+		statusCode: statusCode,
+		remaining:  n,
+	})
+}
+
+// Downloads returns how many download links were issued for a product file.
+func (s *Server) Downloads(productFileID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.downloads[productFileID]
+}
+
+func (s *Server) id() int {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *Server) mustRelease(productSlug string, releaseID int) *release {
+	r, ok := s.releases[releaseID]
+	if !ok || r.productSlug != productSlug {
+		panic(fmt.Sprintf("pivnettest: no release %d of product %s", releaseID, productSlug))
+	}
+
+	return r
+}
+
+// updateFileGroupCopies updates the copies of a product file held by file
+// groups.
+func (s *Server) updateFileGroupCopies(pf pivnet.ProductFile) {
+	for _, fg := range s.fileGroups {
+		for i := range fg.ProductFiles {
+			if fg.ProductFiles[i].ID == pf.ID {
+				fg.ProductFiles[i] = pf
+			}
+		}
+	}
+}
+
+func (s *Server) route(method string, pattern string, handler func(http.ResponseWriter, *http.Request, []string)) {
+	s.routes = append(s.routes, route{
+		method:  method,
+		pattern: regexp.MustCompile("^" + apiPrefix + pattern + "$"),
+		handler: handler,
+	})
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if m := filePath.FindStringSubmatch(req.URL.Path); m != nil {
+		s.serveContents(w, req, atoi(m[1]))
+		return
+	}
+
+	if req.Header.Get("Authorization") != "Token "+Token {
+		writeError(w, http.StatusUnauthorized, "invalid API token")
+		return
+	}
+
+	if statusCode, ok := s.injectedFailure(req); ok {
+		writeError(w, statusCode, "injected failure")
+		return
+	}
+
+	for _, r := range s.routes {
+		if r.method != req.Method {
+			continue
+		}
+
+		m := r.pattern.FindStringSubmatch(req.URL.Path)
+		if m == nil {
+			continue
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		r.handler(w, req, m[1:])
+		return
+	}
+
+	writeError(w, http.StatusNotFound, fmt.Sprintf("no route for %s %s", req.Method, req.URL.Path))
+}
+
+func (s *Server) injectedFailure(req *http.Request) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.failures {
+		if f.remaining > 0 && f.method == req.Method && f.path == req.URL.Path {
+			f.remaining--
+			return f.statusCode, true
+		}
+	}
+
+	return 0, false
+}
+
+func (s *Server) serveContents(w http.ResponseWriter, req *http.Request, id int) {
+	s.mu.Lock()
+	pf, ok := s.productFiles[id]
+	s.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+
+	http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(pf.contents))
+}
+
+// readBody decodes a JSON request body into v, writing an error response
+// if it cannot.
+func readBody(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	err := json.NewDecoder(req.Body).Decode(v)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"message": message,
+		"errors":  []string{},
+	})
+}
+
+func atoi(s string) int {
+	i, _ := strconv.Atoi(s)
+	return i
+}
+
+// remove returns ids without id, and whether it was present.
+func remove(ids []int, id int) ([]int, bool) {
+	for i, existing := range ids {
+		if existing == id {
+			return append(ids[:i:i], ids[i+1:]...), true
+		}
+	}
+
+	return ids, false
+}
+
+func contains(ids []int, id int) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func timestamp() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
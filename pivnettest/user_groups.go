@@ -0,0 +1,95 @@
+package pivnettest
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+type userGroupBody struct {
+	UserGroup pivnet.UserGroup `json:"user_group"`
+}
+
+func (s *Server) listUserGroups(w http.ResponseWriter, req *http.Request, args []string) {
+	var ids []int
+	for id := range s.userGroups {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	response := pivnet.UserGroupsResponse{UserGroups: []pivnet.UserGroup{}}
+	for _, id := range ids {
+		response.UserGroups = append(response.UserGroups, *s.userGroups[id])
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getUserGroup(w http.ResponseWriter, req *http.Request, args []string) {
+	ug, ok := s.userGroups[atoi(args[0])]
+	if !ok {
+		writeError(w, http.StatusNotFound, "user group not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, *ug)
+}
+
+func (s *Server) listUserGroupsForRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	response := pivnet.UserGroupsResponse{UserGroups: []pivnet.UserGroup{}}
+	for _, id := range r.userGroups {
+		response.UserGroups = append(response.UserGroups, *s.userGroups[id])
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) addUserGroupToRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body userGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	if _, ok := s.userGroups[body.UserGroup.ID]; !ok {
+		writeError(w, http.StatusNotFound, "user group not found")
+		return
+	}
+
+	if !contains(r.userGroups, body.UserGroup.ID) {
+		r.userGroups = append(r.userGroups, body.UserGroup.ID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeUserGroupFromRelease(w http.ResponseWriter, req *http.Request, args []string) {
+	r, ok := s.release(w, args[0], args[1])
+	if !ok {
+		return
+	}
+
+	var body userGroupBody
+	if !readBody(w, req, &body) {
+		return
+	}
+
+	var removed bool
+	r.userGroups, removed = remove(r.userGroups, body.UserGroup.ID)
+	if !removed {
+		writeError(w, http.StatusNotFound, "user group not found in release")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
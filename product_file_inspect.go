@@ -0,0 +1,200 @@
+package pivnet
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pivotal-cf/go-pivnet/tile"
+)
+
+// maxIncludedFiles bounds the archive entries listed by InspectProductFile.
+const maxIncludedFiles = 1000
+
+var (
+	documentationExtensions = []string{".pdf", ".md", ".txt", ".html", ".htm"}
+
+	// archiveExtensions are removed from file names before looking for a
+	// version.
+	archiveExtensions = []string{".tar.gz", ".tgz", ".tar", ".zip", ".pivotal", ".gz", ".exe", ".msi", ".dmg", ".pkg"}
+
+	fileNameVersion = regexp.MustCompile(`\d+\.\d+(\.\d+)*(-(?i:alpha|beta|rc|build|dev|pre)[0-9A-Za-z]*(\.[0-9A-Za-z]+)*)?`)
+)
+
+// InspectProductFile computes the metadata of a local file for creating a
+// product file from it. Name is the file's name, SHA256 and MD5 its
+// checksums, and IncludedFiles lists the contents of zip and tar archives.
+// FileVersion is read from the metadata of a .pivotal tile or, for other
+// files, from a version in the file name. Platforms are inferred from the
+// operating systems and architectures the file name mentions, named as in
+// runtime.GOOS and runtime.GOARCH, which ProductFileSelector's Platforms
+// and SelectForPlatform both understand.
+//
+// ProductSlug and AWSObjectKey are left for the caller to fill in.
+func InspectProductFile(filePath string) (CreateProductFileConfig, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return CreateProductFileConfig{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return CreateProductFileConfig{}, err
+	}
+
+	name := filepath.Base(filePath)
+	config := CreateProductFileConfig{
+		Name:     name,
+		FileType: FileTypeSoftware,
+	}
+
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(sha256Hash, md5Hash), f)
+	if err != nil {
+		return CreateProductFileConfig{}, fmt.Errorf("failed to read %s: %s", filePath, err)
+	}
+	config.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	config.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+
+	config.IncludedFiles, err = archiveContents(f, info.Size())
+	if err != nil {
+		return CreateProductFileConfig{}, fmt.Errorf("failed to list contents of %s: %s", filePath, err)
+	}
+
+	lower := strings.ToLower(name)
+	for _, ext := range documentationExtensions {
+		if strings.HasSuffix(lower, ext) {
+			config.FileType = FileTypeDocumentation
+			break
+		}
+	}
+
+	if strings.HasSuffix(lower, ".pivotal") {
+		metadata, err := tile.Read(f, info.Size())
+		if err != nil {
+			return CreateProductFileConfig{}, fmt.Errorf("failed to read tile metadata of %s: %s", filePath, err)
+		}
+		config.FileVersion = metadata.ProductVersion
+	} else {
+		config.FileVersion = versionFromFileName(name)
+	}
+
+	config.Platforms = platformsFromFileName(name)
+
+	return config, nil
+}
+
+// archiveContents lists the regular files of a zip, tar or gzipped tar
+// archive, recognized by their contents. Other files have no contents.
+func archiveContents(f *os.File, size int64) ([]string, error) {
+	header := make([]byte, 512)
+	n, err := f.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	var names []string
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")):
+		zr, err := zip.NewReader(f, size)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, zf := range zr.File {
+			if !zf.FileInfo().IsDir() {
+				names = append(names, zf.Name)
+			}
+		}
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(bufio.NewReader(io.NewSectionReader(f, 0, size)))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		br := bufio.NewReader(gr)
+		peek, _ := br.Peek(512)
+		if !isTar(peek) {
+			return nil, nil
+		}
+
+		names, err = tarContents(br)
+		if err != nil {
+			return nil, err
+		}
+	case isTar(header):
+		names, err = tarContents(io.NewSectionReader(f, 0, size))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+
+	sort.Strings(names)
+	if len(names) > maxIncludedFiles {
+		names = names[:maxIncludedFiles]
+	}
+
+	return names, nil
+}
+
+func isTar(header []byte) bool {
+	return len(header) >= 262 && bytes.HasPrefix(header[257:], []byte("ustar"))
+}
+
+func tarContents(r io.Reader) ([]string, error) {
+	var names []string
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, strings.TrimPrefix(header.Name, "./"))
+		}
+	}
+}
+
+func versionFromFileName(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			name = name[:len(name)-len(ext)]
+			break
+		}
+	}
+
+	return fileNameVersion.FindString(name)
+}
+
+// platformsFromFileName returns a tag for each operating system and
+// architecture the file name mentions.
+func platformsFromFileName(name string) []string {
+	oses, arches := mentionedPlatforms(name)
+
+	return append(oses, arches...)
+}
@@ -0,0 +1,148 @@
+package pivnet_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/go-pivnet"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InspectProductFile", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "inspect")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	writeZip := func(name string, files map[string]string) string {
+		p := filepath.Join(dir, name)
+		f, err := os.Create(p)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		w := zip.NewWriter(f)
+		for n, contents := range files {
+			fw, err := w.Create(n)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = fw.Write([]byte(contents))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(w.Close()).To(Succeed())
+
+		return p
+	}
+
+	writeTarGz := func(name string, files ...string) string {
+		p := filepath.Join(dir, name)
+		f, err := os.Create(p)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		gw := gzip.NewWriter(f)
+		tw := tar.NewWriter(gw)
+		Expect(tw.WriteHeader(&tar.Header{Name: "./bin/", Typeflag: tar.TypeDir, Mode: 0755})).To(Succeed())
+		for _, n := range files {
+			Expect(tw.WriteHeader(&tar.Header{Name: n, Typeflag: tar.TypeReg, Mode: 0644, Size: 2})).To(Succeed())
+			_, err = io.WriteString(tw, "hi")
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+		Expect(gw.Close()).To(Succeed())
+
+		return p
+	}
+
+	It("computes the checksums, name and file type of a plain file", func() {
+		p := filepath.Join(dir, "release-notes.pdf")
+		Expect(ioutil.WriteFile(p, []byte("hello"), 0644)).To(Succeed())
+
+		config, err := pivnet.InspectProductFile(p)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.Name).To(Equal("release-notes.pdf"))
+		Expect(config.FileType).To(Equal(pivnet.FileTypeDocumentation))
+		Expect(config.SHA256).To(Equal("2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"))
+		Expect(config.MD5).To(Equal("5d41402abc4b2a76b9719d911017c592"))
+		Expect(config.IncludedFiles).To(BeEmpty())
+		Expect(config.Platforms).To(BeEmpty())
+		Expect(config.ProductSlug).To(BeEmpty())
+		Expect(config.AWSObjectKey).To(BeEmpty())
+	})
+
+	It("reads the version of a tile from its metadata", func() {
+		p := writeZip("banana-tile.pivotal", map[string]string{
+			"metadata/banana.yml":  "name: banana\nproduct_version: 2.3.4-build.5\n",
+			"releases/banana.tgz":  "release",
+			"migrations/v1/001.js": "migration",
+		})
+
+		config, err := pivnet.InspectProductFile(p)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.FileType).To(Equal(pivnet.FileTypeSoftware))
+		Expect(config.FileVersion).To(Equal("2.3.4-build.5"))
+		Expect(config.IncludedFiles).To(Equal([]string{
+			"metadata/banana.yml",
+			"migrations/v1/001.js",
+			"releases/banana.tgz",
+		}))
+	})
+
+	It("returns an error for a tile without metadata", func() {
+		p := writeZip("banana.pivotal", map[string]string{"releases/banana.tgz": "release"})
+
+		_, err := pivnet.InspectProductFile(p)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("lists gzipped tarballs and infers the version and platforms from the file name", func() {
+		p := writeTarGz("banana-cli-1.2.0-rc.1-linux-x86_64.tar.gz", "./bin/banana", "./README.md")
+
+		config, err := pivnet.InspectProductFile(p)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.IncludedFiles).To(Equal([]string{"README.md", "bin/banana"}))
+		Expect(config.FileVersion).To(Equal("1.2.0-rc.1"))
+		Expect(config.Platforms).To(Equal([]string{"linux", "amd64"}))
+	})
+
+	It("does not mistake platform names for pre-release versions", func() {
+		p := filepath.Join(dir, "banana-3.1.4-darwin-arm64")
+		Expect(ioutil.WriteFile(p, []byte("binary"), 0644)).To(Succeed())
+
+		config, err := pivnet.InspectProductFile(p)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(config.FileVersion).To(Equal("3.1.4"))
+		Expect(config.Platforms).To(ConsistOf("darwin", "arm64"))
+	})
+
+	It("tags platforms as a selector expects them", func() {
+		p := filepath.Join(dir, "banana-cli-1.2.0-windows-x64.exe")
+		Expect(ioutil.WriteFile(p, []byte("binary"), 0644)).To(Succeed())
+
+		config, err := pivnet.InspectProductFile(p)
+		Expect(err).NotTo(HaveOccurred())
+
+		productFiles := []pivnet.ProductFile{{Name: "cli", Platforms: config.Platforms}}
+		for _, platform := range []string{"windows", "amd64"} {
+			selected, err := pivnet.ProductFileSelector{Platforms: []string{platform}}.Select(productFiles)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(selected).To(HaveLen(1))
+		}
+	})
+})
@@ -14,9 +14,13 @@ func NewProductFileLinkFetcher(downloadLink string, client Client) ProductFileLi
 }
 
 func (p ProductFileLinkFetcher) NewDownloadLink() (string, error) {
-	p.client.HTTP.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+	// Redirects are disabled on a copy of the HTTP client, as the shared
+	// one may be in use by concurrent requests.
+	httpClient := *p.client.HTTP
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
 		return http.ErrUseLastResponse
 	}
+	p.client.HTTP = &httpClient
 
 	resp, err := p.client.MakeRequest("POST", p.downloadLink, http.StatusFound, nil)
 	if err != nil {
@@ -25,7 +29,5 @@ func (p ProductFileLinkFetcher) NewDownloadLink() (string, error) {
 
 	defer resp.Body.Close()
 
-	p.client.HTTP.CheckRedirect = nil
-
 	return resp.Header.Get("Location"), nil
 }
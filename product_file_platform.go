@@ -0,0 +1,316 @@
+package pivnet
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Platform is an operating system and architecture, named as in
+// runtime.GOOS and runtime.GOARCH.
+type Platform struct {
+	OS   string
+	Arch string
+}
+
+func CurrentPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+}
+
+func (p Platform) String() string {
+	return fmt.Sprintf("%s/%s", p.OS, p.Arch)
+}
+
+// PlatformMatch is a product file scored against a platform.
+type PlatformMatch struct {
+	ProductFile ProductFile
+	Score       int
+
+	// Excluded is set when the file names a different platform only.
+	Excluded bool
+
+	Reasons []string
+}
+
+// PlatformSelection explains how a file was chosen for a platform.
+type PlatformSelection struct {
+	Platform Platform
+
+	// Candidates holds every file, best first.
+	Candidates []PlatformMatch
+}
+
+// Best returns the highest scoring file, if any file matched.
+func (s PlatformSelection) Best() (PlatformMatch, bool) {
+	if len(s.Candidates) == 0 {
+		return PlatformMatch{}, false
+	}
+
+	best := s.Candidates[0]
+	if best.Excluded || best.Score <= 0 {
+		return PlatformMatch{}, false
+	}
+
+	return best, true
+}
+
+// Explain describes the score of every candidate.
+func (s PlatformSelection) Explain() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "selecting for %s:\n", s.Platform)
+	for _, c := range s.Candidates {
+		status := fmt.Sprintf("score %d", c.Score)
+		if c.Excluded {
+			status = "excluded"
+		}
+
+		fmt.Fprintf(&b, "  %s (%s)\n", productFileName(c.ProductFile), status)
+		for _, reason := range c.Reasons {
+			fmt.Fprintf(&b, "    - %s\n", reason)
+		}
+	}
+
+	return b.String()
+}
+
+// ErrNoPlatformMatch is returned when no product file matches a platform.
+type ErrNoPlatformMatch struct {
+	Selection PlatformSelection
+}
+
+func (e ErrNoPlatformMatch) Error() string {
+	return fmt.Sprintf("no product file matches %s\n%s", e.Selection.Platform, e.Selection.Explain())
+}
+
+// ErrAmbiguousPlatformMatch is returned when several product files share
+// the best score for a platform.
+type ErrAmbiguousPlatformMatch struct {
+	Selection PlatformSelection
+	Names     []string
+}
+
+func (e ErrAmbiguousPlatformMatch) Error() string {
+	return fmt.Sprintf(
+		"product files %s match %s equally well\n%s",
+		strings.Join(e.Names, ", "),
+		e.Selection.Platform,
+		e.Selection.Explain(),
+	)
+}
+
+var osAliases = map[string][]string{
+	"darwin":  {"darwin", "macos", "mac", "osx", "os x", "apple"},
+	"linux":   {"linux"},
+	"windows": {"windows", "win64", "win32", "win"},
+}
+
+var archAliases = map[string][]string{
+	"amd64": {"amd64", "x86_64", "x86-64", "x64", "64-bit", "64bit"},
+	"arm64": {"arm64", "aarch64"},
+	"386":   {"386", "i386", "i686", "x86", "32-bit", "32bit"},
+	"arm":   {"armv7", "armv6", "armhf", "arm"},
+}
+
+// compatibleArch lists architectures whose binaries also run on a platform,
+// such as amd64 binaries on Apple silicon through Rosetta 2.
+var compatibleArch = map[Platform]string{
+	{OS: "darwin", Arch: "arm64"}:  "amd64",
+	{OS: "windows", Arch: "arm64"}: "amd64",
+	{OS: "windows", Arch: "amd64"}: "386",
+	{OS: "linux", Arch: "amd64"}:   "386",
+}
+
+type platformHint struct {
+	source string
+	text   string
+	weight int
+}
+
+// SelectForPlatform scores product files against platform using their
+// platform tags, names, included files and system requirements, and
+// returns the best match. Empty fields of platform default to the current
+// host. The selection is returned with ErrNoPlatformMatch and
+// ErrAmbiguousPlatformMatch so callers can show why.
+func SelectForPlatform(productFiles []ProductFile, platform Platform) (ProductFile, PlatformSelection, error) {
+	current := CurrentPlatform()
+	if platform.OS == "" {
+		platform.OS = current.OS
+	}
+	if platform.Arch == "" {
+		platform.Arch = current.Arch
+	}
+
+	selection := PlatformSelection{Platform: platform}
+	for _, pf := range productFiles {
+		selection.Candidates = append(selection.Candidates, scorePlatform(pf, platform))
+	}
+
+	sort.SliceStable(selection.Candidates, func(i, j int) bool {
+		a, b := selection.Candidates[i], selection.Candidates[j]
+		if a.Excluded != b.Excluded {
+			return !a.Excluded
+		}
+		return a.Score > b.Score
+	})
+
+	best, ok := selection.Best()
+	if !ok {
+		return ProductFile{}, selection, ErrNoPlatformMatch{Selection: selection}
+	}
+
+	var tied []string
+	for _, c := range selection.Candidates {
+		if !c.Excluded && c.Score == best.Score {
+			tied = append(tied, productFileName(c.ProductFile))
+		}
+	}
+	if len(tied) > 1 {
+		return ProductFile{}, selection, ErrAmbiguousPlatformMatch{Selection: selection, Names: tied}
+	}
+
+	return best.ProductFile, selection, nil
+}
+
+func scorePlatform(pf ProductFile, platform Platform) PlatformMatch {
+	match := PlatformMatch{ProductFile: pf}
+
+	var hints []platformHint
+	for _, tag := range pf.Platforms {
+		hints = append(hints, platformHint{source: "platform tag", text: tag, weight: 4})
+	}
+	if pf.AWSObjectKey != "" {
+		hints = append(hints, platformHint{source: "file name", text: path.Base(pf.AWSObjectKey), weight: 3})
+	}
+	if pf.Name != "" {
+		hints = append(hints, platformHint{source: "name", text: pf.Name, weight: 3})
+	}
+	for _, f := range pf.IncludedFiles {
+		hints = append(hints, platformHint{source: "included file", text: f, weight: 2})
+	}
+	for _, r := range pf.SystemRequirements {
+		hints = append(hints, platformHint{source: "system requirement", text: r, weight: 1})
+	}
+
+	var osMatched, osConflict, archMatched, archConflict bool
+	var conflicts []string
+
+	for _, hint := range hints {
+		oses, arches := mentionedPlatforms(hint.text)
+
+		for _, os := range oses {
+			if os == platform.OS {
+				osMatched = true
+				match.Score += 3 * hint.weight
+				match.Reasons = append(match.Reasons, fmt.Sprintf("%s %q mentions %s (+%d)", hint.source, hint.text, os, 3*hint.weight))
+			} else {
+				osConflict = true
+				conflicts = append(conflicts, fmt.Sprintf("%s %q mentions %s", hint.source, hint.text, os))
+			}
+		}
+
+		for _, arch := range arches {
+			switch arch {
+			case platform.Arch:
+				archMatched = true
+				match.Score += 2 * hint.weight
+				match.Reasons = append(match.Reasons, fmt.Sprintf("%s %q mentions %s (+%d)", hint.source, hint.text, arch, 2*hint.weight))
+			case compatibleArch[platform]:
+				archMatched = true
+				match.Score += hint.weight
+				match.Reasons = append(match.Reasons, fmt.Sprintf("%s %q mentions %s, which runs on %s (+%d)", hint.source, hint.text, arch, platform, hint.weight))
+			default:
+				archConflict = true
+				conflicts = append(conflicts, fmt.Sprintf("%s %q mentions %s", hint.source, hint.text, arch))
+			}
+		}
+	}
+
+	if (osConflict && !osMatched) || (archConflict && !archMatched) {
+		match.Excluded = true
+		match.Reasons = append(match.Reasons, conflicts...)
+	}
+
+	if len(match.Reasons) == 0 {
+		match.Reasons = append(match.Reasons, "does not mention any platform")
+	}
+
+	return match
+}
+
+type platformAlias struct {
+	name    string
+	isOS    bool
+	pattern *regexp.Regexp
+}
+
+// platformAliases holds every alias, longest first, so that "x86_64" is
+// matched before it can be read as "x86".
+var platformAliases []platformAlias
+
+func init() {
+	type alias struct {
+		name  string
+		alias string
+		isOS  bool
+	}
+
+	var aliases []alias
+	for name, list := range osAliases {
+		for _, a := range list {
+			aliases = append(aliases, alias{name: name, alias: a, isOS: true})
+		}
+	}
+	for name, list := range archAliases {
+		for _, a := range list {
+			aliases = append(aliases, alias{name: name, alias: a})
+		}
+	}
+
+	sort.Slice(aliases, func(i, j int) bool {
+		if len(aliases[i].alias) != len(aliases[j].alias) {
+			return len(aliases[i].alias) > len(aliases[j].alias)
+		}
+		return aliases[i].alias < aliases[j].alias
+	})
+
+	for _, a := range aliases {
+		platformAliases = append(platformAliases, platformAlias{
+			name:    a.name,
+			isOS:    a.isOS,
+			pattern: regexp.MustCompile(`(^|[^a-z0-9])` + regexp.QuoteMeta(a.alias) + `($|[^a-z0-9])`),
+		})
+	}
+}
+
+// mentionedPlatforms returns the operating systems and architectures named
+// in text.
+func mentionedPlatforms(text string) ([]string, []string) {
+	text = strings.ToLower(text)
+
+	var oses, arches []string
+	found := map[string]bool{}
+
+	for _, a := range platformAliases {
+		if !a.pattern.MatchString(text) {
+			continue
+		}
+		text = a.pattern.ReplaceAllString(text, "$1 $2")
+
+		if found[a.name] {
+			continue
+		}
+		found[a.name] = true
+
+		if a.isOS {
+			oses = append(oses, a.name)
+		} else {
+			arches = append(arches, a.name)
+		}
+	}
+
+	return oses, arches
+}
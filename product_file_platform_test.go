@@ -0,0 +1,122 @@
+package pivnet_test
+
+import (
+	"runtime"
+
+	"github.com/pivotal-cf/go-pivnet"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SelectForPlatform", func() {
+	var productFiles []pivnet.ProductFile
+
+	BeforeEach(func() {
+		productFiles = []pivnet.ProductFile{
+			{
+				ID:           1,
+				AWSObjectKey: "product-files/pivnet-cli/pivnet-linux-amd64-0.0.55",
+				Name:         "pivnet-cli Linux",
+			},
+			{
+				ID:           2,
+				AWSObjectKey: "product-files/pivnet-cli/pivnet-darwin-amd64-0.0.55",
+				Name:         "pivnet-cli Mac OS X",
+			},
+			{
+				ID:           3,
+				AWSObjectKey: "product-files/pivnet-cli/pivnet-windows-amd64-0.0.55.exe",
+				Name:         "pivnet-cli Windows",
+			},
+			{
+				ID:           4,
+				AWSObjectKey: "product-files/pivnet-cli/pivnet-linux-arm64-0.0.55",
+				Name:         "pivnet-cli Linux ARM",
+			},
+			{
+				ID:           5,
+				AWSObjectKey: "product-files/pivnet-cli/release-notes.pdf",
+				Name:         "Release Notes",
+			},
+		}
+	})
+
+	It("selects the file for the given platform", func() {
+		pf, selection, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "linux", Arch: "arm64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf.ID).To(Equal(4))
+
+		Expect(selection.Candidates[0].ProductFile.ID).To(Equal(4))
+		Expect(selection.Candidates[0].Reasons).To(ContainElement(
+			`file name "pivnet-linux-arm64-0.0.55" mentions arm64 (+6)`,
+		))
+
+		for _, c := range selection.Candidates {
+			if c.ProductFile.ID == 1 || c.ProductFile.ID == 2 {
+				Expect(c.Excluded).To(BeTrue())
+			}
+		}
+	})
+
+	It("reads x86_64 as amd64 rather than x86", func() {
+		productFiles = []pivnet.ProductFile{
+			{ID: 1, AWSObjectKey: "product-files/om/om-linux-x86_64"},
+			{ID: 2, AWSObjectKey: "product-files/om/om-linux-x86"},
+		}
+
+		pf, _, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "linux", Arch: "amd64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf.ID).To(Equal(1))
+	})
+
+	It("falls back to compatible architectures", func() {
+		pf, selection, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "darwin", Arch: "arm64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf.ID).To(Equal(2))
+		Expect(selection.Explain()).To(ContainSubstring("mentions amd64, which runs on darwin/arm64"))
+	})
+
+	It("uses platform tags, included files and system requirements", func() {
+		productFiles = []pivnet.ProductFile{
+			{ID: 1, Name: "Installer", Platforms: []string{"Linux"}, SystemRequirements: []string{"64-bit"}},
+			{ID: 2, Name: "Installer", Platforms: []string{"Windows"}},
+			{ID: 3, Name: "Bundle", IncludedFiles: []string{"tool-linux-386"}},
+		}
+
+		pf, _, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "linux", Arch: "amd64"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf.ID).To(Equal(1))
+	})
+
+	It("defaults to the current host", func() {
+		productFiles = []pivnet.ProductFile{
+			{ID: 1, AWSObjectKey: "tool-" + runtime.GOOS + "-" + runtime.GOARCH},
+			{ID: 2, AWSObjectKey: "tool-plan9-mips"},
+		}
+
+		pf, selection, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pf.ID).To(Equal(1))
+		Expect(selection.Platform).To(Equal(pivnet.CurrentPlatform()))
+	})
+
+	It("explains why nothing matched", func() {
+		_, _, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "freebsd", Arch: "amd64"})
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNoPlatformMatch{}))
+		Expect(err.Error()).To(ContainSubstring("no product file matches freebsd/amd64"))
+		Expect(err.Error()).To(ContainSubstring(`pivnet-linux-amd64-0.0.55 (excluded)`))
+		Expect(err.Error()).To(ContainSubstring(`release-notes.pdf (score 0)`))
+	})
+
+	It("returns an error when files tie", func() {
+		productFiles = []pivnet.ProductFile{
+			{ID: 1, AWSObjectKey: "a-linux-amd64"},
+			{ID: 2, AWSObjectKey: "b-linux-amd64"},
+		}
+
+		_, _, err := pivnet.SelectForPlatform(productFiles, pivnet.Platform{OS: "linux", Arch: "amd64"})
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrAmbiguousPlatformMatch{}))
+		Expect(err.(pivnet.ErrAmbiguousPlatformMatch).Names).To(Equal([]string{"a-linux-amd64", "b-linux-amd64"}))
+	})
+})
@@ -0,0 +1,209 @@
+package pivnet
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ProductFileSelector picks product files out of a list. A file is selected
+// when it matches any of the Globs or Regexes (or there are none) and passes
+// the FileTypes and Platforms filters.
+type ProductFileSelector struct {
+	// Globs are matched, as understood by path.Match, against the base
+	// name of a file's AWS object key and against its Name.
+	Globs []string
+
+	// Regexes are matched against the same names as Globs.
+	Regexes []string
+
+	// FileTypes, if set, limits the selection to files of these types,
+	// such as FileTypeSoftware.
+	FileTypes []string
+
+	// Platforms, if set, limits the selection to files listing at least
+	// one of these platforms. Comparison ignores case.
+	Platforms []string
+
+	// Max is the largest number of files that may be selected. Zero means
+	// no limit.
+	Max int
+}
+
+// ErrNoProductFilesMatched is returned when a pattern, or the selector as a
+// whole when Pattern is empty, matches no product files.
+type ErrNoProductFilesMatched struct {
+	Pattern string
+}
+
+func (e ErrNoProductFilesMatched) Error() string {
+	if e.Pattern == "" {
+		return "no product files matched the selection"
+	}
+
+	return fmt.Sprintf("no product files matched %q", e.Pattern)
+}
+
+// ErrTooManyProductFiles is returned when more files are selected than the
+// selector's Max allows.
+type ErrTooManyProductFiles struct {
+	Max     int
+	Matched []string
+}
+
+func (e ErrTooManyProductFiles) Error() string {
+	return fmt.Sprintf(
+		"expected at most %d product file(s) but %d matched: %s",
+		e.Max,
+		len(e.Matched),
+		strings.Join(e.Matched, ", "),
+	)
+}
+
+type pattern struct {
+	source string
+	match  func(name string) bool
+}
+
+func (s ProductFileSelector) patterns() ([]pattern, error) {
+	var patterns []pattern
+
+	for _, glob := range s.Globs {
+		_, err := path.Match(glob, "")
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %s", glob, err)
+		}
+
+		glob := glob
+		patterns = append(patterns, pattern{
+			source: glob,
+			match: func(name string) bool {
+				ok, _ := path.Match(glob, name)
+				return ok
+			},
+		})
+	}
+
+	for _, expr := range s.Regexes {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex %q: %s", expr, err)
+		}
+
+		patterns = append(patterns, pattern{
+			source: expr,
+			match:  re.MatchString,
+		})
+	}
+
+	return patterns, nil
+}
+
+// Select returns the selected files in the order they were given. Each glob
+// and regex must match at least one file that passes the filters.
+func (s ProductFileSelector) Select(productFiles []ProductFile) ([]ProductFile, error) {
+	patterns, err := s.patterns()
+	if err != nil {
+		return nil, err
+	}
+
+	selected, matchedPatterns := s.match(patterns, productFiles)
+
+	for i, matched := range matchedPatterns {
+		if !matched {
+			return nil, ErrNoProductFilesMatched{Pattern: patterns[i].source}
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, ErrNoProductFilesMatched{}
+	}
+
+	if s.Max > 0 && len(selected) > s.Max {
+		var names []string
+		for _, pf := range selected {
+			names = append(names, productFileName(pf))
+		}
+
+		return nil, ErrTooManyProductFiles{Max: s.Max, Matched: names}
+	}
+
+	return selected, nil
+}
+
+// filter is like Select but only drops the files that are not selected. It
+// does not require any pattern, or the selector as a whole, to match, and
+// ignores Max.
+func (s ProductFileSelector) filter(productFiles []ProductFile) ([]ProductFile, error) {
+	patterns, err := s.patterns()
+	if err != nil {
+		return nil, err
+	}
+
+	selected, _ := s.match(patterns, productFiles)
+	return selected, nil
+}
+
+// match returns the files that pass the filters and match any of patterns,
+// and which of patterns matched one of them.
+func (s ProductFileSelector) match(patterns []pattern, productFiles []ProductFile) ([]ProductFile, []bool) {
+	matchedPatterns := make([]bool, len(patterns))
+
+	var selected []ProductFile
+	for _, pf := range productFiles {
+		if !s.passesFilters(pf) {
+			continue
+		}
+
+		matched := len(patterns) == 0
+		for i, p := range patterns {
+			if matchesName(p, pf) {
+				matchedPatterns[i] = true
+				matched = true
+			}
+		}
+
+		if matched {
+			selected = append(selected, pf)
+		}
+	}
+
+	return selected, matchedPatterns
+}
+
+func (s ProductFileSelector) passesFilters(pf ProductFile) bool {
+	if len(s.FileTypes) > 0 && !containsFold(s.FileTypes, pf.FileType) {
+		return false
+	}
+
+	if len(s.Platforms) > 0 {
+		for _, platform := range pf.Platforms {
+			if containsFold(s.Platforms, platform) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return true
+}
+
+func matchesName(p pattern, pf ProductFile) bool {
+	if pf.AWSObjectKey != "" && p.match(path.Base(pf.AWSObjectKey)) {
+		return true
+	}
+
+	return pf.Name != "" && p.match(pf.Name)
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
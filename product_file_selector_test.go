@@ -0,0 +1,130 @@
+package pivnet_test
+
+import (
+	"github.com/pivotal-cf/go-pivnet"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProductFileSelector", func() {
+	var productFiles []pivnet.ProductFile
+
+	ids := func(files []pivnet.ProductFile) []int {
+		var result []int
+		for _, pf := range files {
+			result = append(result, pf.ID)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		productFiles = []pivnet.ProductFile{
+			{
+				ID:           1,
+				AWSObjectKey: "product-files/cf/cf-2.1.0.pivotal",
+				Name:         "PCF Elastic Runtime",
+				FileType:     pivnet.FileTypeSoftware,
+			},
+			{
+				ID:           2,
+				AWSObjectKey: "product-files/stemcells/stemcell-3541-vsphere-esxi-ubuntu-trusty.tgz",
+				Name:         "Ubuntu Trusty Stemcell for vSphere",
+				FileType:     pivnet.FileTypeSoftware,
+				Platforms:    []string{"vSphere"},
+			},
+			{
+				ID:           3,
+				AWSObjectKey: "product-files/stemcells/stemcell-3541-aws-xen-hvm-ubuntu-trusty.tgz",
+				Name:         "Ubuntu Trusty Stemcell for AWS",
+				FileType:     pivnet.FileTypeSoftware,
+				Platforms:    []string{"AWS"},
+			},
+			{
+				ID:           4,
+				AWSObjectKey: "product-files/cf/open_source_license_cf.txt",
+				Name:         "Open Source License",
+				FileType:     pivnet.FileTypeOpenSourceLicense,
+			},
+		}
+	})
+
+	It("selects every file when empty", func() {
+		selected, err := pivnet.ProductFileSelector{}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{1, 2, 3, 4}))
+	})
+
+	It("matches globs against the object key base name", func() {
+		selected, err := pivnet.ProductFileSelector{
+			Globs: []string{"*.pivotal", "stemcell-*-vsphere-*.tgz"},
+		}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{1, 2}))
+	})
+
+	It("matches globs against the name", func() {
+		selected, err := pivnet.ProductFileSelector{
+			Globs: []string{"*for AWS"},
+		}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{3}))
+	})
+
+	It("matches regexes", func() {
+		selected, err := pivnet.ProductFileSelector{
+			Regexes: []string{`^stemcell-\d+-aws-`},
+		}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{3}))
+	})
+
+	It("filters by file type and platform", func() {
+		selected, err := pivnet.ProductFileSelector{
+			FileTypes: []string{pivnet.FileTypeOpenSourceLicense},
+		}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{4}))
+
+		selected, err = pivnet.ProductFileSelector{
+			Globs:     []string{"stemcell-*"},
+			Platforms: []string{"vsphere"},
+		}.Select(productFiles)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(selected)).To(Equal([]int{2}))
+	})
+
+	It("returns an error naming a pattern that matched nothing", func() {
+		_, err := pivnet.ProductFileSelector{
+			Globs: []string{"*.pivotal", "*.ova"},
+		}.Select(productFiles)
+		Expect(err).To(Equal(pivnet.ErrNoProductFilesMatched{Pattern: "*.ova"}))
+		Expect(err).To(MatchError(`no product files matched "*.ova"`))
+	})
+
+	It("returns an error when the filters leave nothing", func() {
+		_, err := pivnet.ProductFileSelector{
+			Platforms: []string{"Azure"},
+		}.Select(productFiles)
+		Expect(err).To(Equal(pivnet.ErrNoProductFilesMatched{}))
+	})
+
+	It("returns an error when more files match than expected", func() {
+		_, err := pivnet.ProductFileSelector{
+			Globs: []string{"stemcell-*"},
+			Max:   1,
+		}.Select(productFiles)
+		Expect(err).To(MatchError(
+			"expected at most 1 product file(s) but 2 matched: " +
+				"stemcell-3541-vsphere-esxi-ubuntu-trusty.tgz, stemcell-3541-aws-xen-hvm-ubuntu-trusty.tgz",
+		))
+	})
+
+	It("returns an error for invalid patterns", func() {
+		_, err := pivnet.ProductFileSelector{Globs: []string{"["}}.Select(productFiles)
+		Expect(err).To(MatchError(ContainSubstring("invalid glob")))
+
+		_, err = pivnet.ProductFileSelector{Regexes: []string{"("}}.Select(productFiles)
+		Expect(err).To(MatchError(ContainSubstring("invalid regex")))
+	})
+})
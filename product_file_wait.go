@@ -0,0 +1,194 @@
+package pivnet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+const (
+	DefaultWaitPollInterval    = 2 * time.Second
+	DefaultWaitMaxPollInterval = 30 * time.Second
+)
+
+// DefaultFailedTransferStatuses are the transfer statuses taken to mean a
+// failed transfer when WaitConfig.FailedStatuses is nil. Pivotal Network
+// does not document its transfer statuses, so callers that see others can
+// list them in FailedStatuses.
+var DefaultFailedTransferStatuses = []string{"failed", "error"}
+
+type WaitConfig struct {
+	// Timeout bounds the whole wait. When zero, the wait lasts until the
+	// context is done.
+	Timeout time.Duration
+
+	// PollInterval is the delay before the second poll. It doubles after
+	// each poll up to MaxPollInterval. They default to
+	// DefaultWaitPollInterval and DefaultWaitMaxPollInterval.
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+
+	// FailedStatuses are the transfer statuses that mean a file will never
+	// be ready to serve. When nil, DefaultFailedTransferStatuses are used;
+	// an empty, non-nil list checks only ReadyToServe, so a failed
+	// transfer ends in a timeout. Comparison ignores case.
+	FailedStatuses []string
+}
+
+// ErrFileTransferFailed is returned when Pivotal Network reports that the
+// transfer of a product file failed.
+type ErrFileTransferFailed struct {
+	ProductFileID int
+	Status        string
+}
+
+func (e ErrFileTransferFailed) Error() string {
+	return fmt.Sprintf("transfer of product file %d failed with status %q", e.ProductFileID, e.Status)
+}
+
+// ErrWaitTimeout is returned when a product file is not ready to serve
+// within a wait's timeout.
+type ErrWaitTimeout struct {
+	ProductFileID int
+	Status        string
+	Timeout       time.Duration
+}
+
+func (e ErrWaitTimeout) Error() string {
+	return fmt.Sprintf(
+		"product file %d was not ready to serve after %s (transfer status %q)",
+		e.ProductFileID,
+		e.Timeout,
+		e.Status,
+	)
+}
+
+// WaitUntilReady polls a product file until it is ready to serve and
+// returns it. Rate limiting and server errors while polling are retried.
+// A file whose transfer status is one of config.FailedStatuses stops the
+// wait with ErrFileTransferFailed.
+func (p ProductFilesService) WaitUntilReady(
+	ctx context.Context,
+	productSlug string,
+	productFileID int,
+	config WaitConfig,
+) (ProductFile, error) {
+	productFiles, err := p.WaitUntilAllReady(ctx, productSlug, []int{productFileID}, config)
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	return productFiles[0], nil
+}
+
+// WaitUntilAllReady polls product files until all of them are ready to
+// serve and returns them in the order of productFileIDs. It stops at the
+// first failed transfer.
+func (p ProductFilesService) WaitUntilAllReady(
+	ctx context.Context,
+	productSlug string,
+	productFileIDs []int,
+	config WaitConfig,
+) ([]ProductFile, error) {
+	interval := config.PollInterval
+	if interval <= 0 {
+		interval = DefaultWaitPollInterval
+	}
+
+	maxInterval := config.MaxPollInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultWaitMaxPollInterval
+	}
+
+	failedStatuses := config.FailedStatuses
+	if failedStatuses == nil {
+		failedStatuses = DefaultFailedTransferStatuses
+	}
+
+	var timeout <-chan time.Time
+	if config.Timeout > 0 {
+		timer := time.NewTimer(config.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	productFiles := make([]ProductFile, len(productFileIDs))
+	ready := make([]bool, len(productFileIDs))
+
+	for {
+		pending := 0
+
+		for i, id := range productFileIDs {
+			if ready[i] {
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			pf, err := p.get(ctx, productSlug, id)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				if !isTransient(err) {
+					return nil, err
+				}
+
+				p.client.logger.Info("Retrying product file poll", logger.Data{"product_file_id": id, "error": err.Error()})
+				pending++
+				continue
+			}
+
+			productFiles[i] = pf
+
+			switch {
+			case pf.ReadyToServe:
+				ready[i] = true
+			case containsFold(failedStatuses, pf.FileTransferStatus):
+				return nil, ErrFileTransferFailed{ProductFileID: id, Status: pf.FileTransferStatus}
+			default:
+				pending++
+			}
+		}
+
+		if pending == 0 {
+			return productFiles, nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-timeout:
+			for i, id := range productFileIDs {
+				if !ready[i] {
+					return nil, ErrWaitTimeout{
+						ProductFileID: id,
+						Status:        productFiles[i].FileTransferStatus,
+						Timeout:       config.Timeout,
+					}
+				}
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		interval *= 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case ErrTooManyRequests:
+		return true
+	case ErrPivnetOther:
+		return e.ResponseCode >= 500
+	}
+
+	return false
+}
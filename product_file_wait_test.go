@@ -0,0 +1,211 @@
+package pivnet_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PivnetClient - wait for product files", func() {
+	var (
+		server *ghttp.Server
+		client pivnet.Client
+		config pivnet.WaitConfig
+	)
+
+	respondWith := func(productFileID int, statusCode int, pf pivnet.ProductFile) {
+		pf.ID = productFileID
+		server.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/banana/product_files/%d", apiPrefix, productFileID)),
+				ghttp.RespondWithJSONEncoded(statusCode, pivnet.ProductFileResponse{ProductFile: pf}),
+			),
+		)
+	}
+
+	inProgress := pivnet.ProductFile{FileTransferStatus: "in_progress"}
+	complete := pivnet.ProductFile{FileTransferStatus: "complete", ReadyToServe: true}
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		client = pivnet.NewClient(pivnet.ClientConfig{
+			Host:      server.URL(),
+			Token:     "my-auth-token",
+			UserAgent: "pivnet-resource/0.1.0 (some-url)",
+		}, &loggerfakes.FakeLogger{})
+
+		config = pivnet.WaitConfig{
+			PollInterval:    time.Millisecond,
+			MaxPollInterval: 4 * time.Millisecond,
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("WaitUntilReady", func() {
+		It("polls until the file is ready to serve", func() {
+			respondWith(1234, http.StatusOK, inProgress)
+			respondWith(1234, http.StatusOK, inProgress)
+			respondWith(1234, http.StatusOK, complete)
+
+			pf, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pf.ID).To(Equal(1234))
+			Expect(pf.ReadyToServe).To(BeTrue())
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("retries server errors and rate limiting", func() {
+			respondWith(1234, http.StatusServiceUnavailable, pivnet.ProductFile{})
+			respondWith(1234, http.StatusTooManyRequests, pivnet.ProductFile{})
+			respondWith(1234, http.StatusOK, complete)
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns other errors", func() {
+			respondWith(1234, http.StatusNotFound, pivnet.ProductFile{})
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNotFound{}))
+		})
+
+		It("decides readiness by ReadyToServe alone", func() {
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{})
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{FileTransferStatus: "complete"})
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{ReadyToServe: true})
+
+			pf, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(pf.ReadyToServe).To(BeTrue())
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("returns an error when the transfer status is a failed one", func() {
+			respondWith(1234, http.StatusOK, inProgress)
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{FileTransferStatus: "failed_sha256_check"})
+			config.FailedStatuses = []string{"FAILED_SHA256_CHECK"}
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(Equal(pivnet.ErrFileTransferFailed{ProductFileID: 1234, Status: "failed_sha256_check"}))
+		})
+
+		It("keeps waiting for statuses that are not configured as failed", func() {
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/banana/product_files/1234", apiPrefix),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: pivnet.ProductFile{FileTransferStatus: "failed_sha256_check"},
+				}),
+			)
+			config.Timeout = 20 * time.Millisecond
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(BeAssignableToTypeOf(pivnet.ErrWaitTimeout{}))
+		})
+
+		It("treats the default failed statuses as failed when none are configured", func() {
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{FileTransferStatus: "Failed"})
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(Equal(pivnet.ErrFileTransferFailed{ProductFileID: 1234, Status: "Failed"}))
+		})
+
+		It("only checks ReadyToServe when the failed statuses are empty", func() {
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/banana/product_files/1234", apiPrefix),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+					ProductFile: pivnet.ProductFile{FileTransferStatus: "failed"},
+				}),
+			)
+			config.FailedStatuses = []string{}
+			config.Timeout = 20 * time.Millisecond
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(BeAssignableToTypeOf(pivnet.ErrWaitTimeout{}))
+		})
+
+		It("prefers ReadyToServe over a failed status", func() {
+			respondWith(1234, http.StatusOK, pivnet.ProductFile{FileTransferStatus: "failed", ReadyToServe: true})
+			config.FailedStatuses = []string{"failed"}
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("returns an error after the timeout", func() {
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/banana/product_files/1234", apiPrefix),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{ProductFile: inProgress}),
+			)
+			config.Timeout = 20 * time.Millisecond
+
+			_, err := client.ProductFiles.WaitUntilReady(context.Background(), "banana", 1234, config)
+			Expect(err).To(Equal(pivnet.ErrWaitTimeout{
+				ProductFileID: 1234,
+				Status:        "in_progress",
+				Timeout:       20 * time.Millisecond,
+			}))
+		})
+
+		It("stops when the context is canceled", func() {
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/banana/product_files/1234", apiPrefix),
+				ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{ProductFile: inProgress}),
+			)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+
+			_, err := client.ProductFiles.WaitUntilReady(ctx, "banana", 1234, config)
+			Expect(err).To(Equal(context.DeadlineExceeded))
+		})
+		It("cancels a poll in flight when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			server.RouteToHandler("GET", fmt.Sprintf("%s/products/banana/product_files/1234", apiPrefix),
+				func(w http.ResponseWriter, req *http.Request) {
+					cancel()
+					<-req.Context().Done()
+				},
+			)
+
+			_, err := client.ProductFiles.WaitUntilReady(ctx, "banana", 1234, config)
+			Expect(err).To(Equal(context.Canceled))
+		})
+	})
+
+	Describe("WaitUntilAllReady", func() {
+		It("stops polling files once they are ready and returns them in order", func() {
+			respondWith(1, http.StatusOK, complete)
+			respondWith(2, http.StatusOK, inProgress)
+			respondWith(2, http.StatusOK, complete)
+
+			productFiles, err := client.ProductFiles.WaitUntilAllReady(context.Background(), "banana", []int{1, 2}, config)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(productFiles).To(HaveLen(2))
+			Expect(productFiles[0].ID).To(Equal(1))
+			Expect(productFiles[1].ID).To(Equal(2))
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("returns the first failed transfer", func() {
+			respondWith(1, http.StatusOK, inProgress)
+			respondWith(2, http.StatusOK, pivnet.ProductFile{FileTransferStatus: "failed"})
+			config.FailedStatuses = []string{"failed"}
+
+			_, err := client.ProductFiles.WaitUntilAllReady(context.Background(), "banana", []int{1, 2}, config)
+			Expect(err).To(Equal(pivnet.ErrFileTransferFailed{ProductFileID: 2, Status: "failed"}))
+		})
+	})
+})
@@ -2,14 +2,20 @@ package pivnet
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"time"
 
 	"github.com/pivotal-cf/go-pivnet/download"
 	"github.com/pivotal-cf/go-pivnet/logger"
+	"github.com/pivotal-cf/go-pivnet/tile"
 )
 
 type ProductFilesService struct {
@@ -58,6 +64,7 @@ type ProductFile struct {
 	ReleasedAt         string   `json:"released_at,omitempty" yaml:"released_at,omitempty"`
 	Size               int      `json:"size,omitempty" yaml:"size,omitempty"`
 	SystemRequirements []string `json:"system_requirements,omitempty" yaml:"system_requirements,omitempty"`
+	UpdatedAt          string   `json:"updated_at,omitempty" yaml:"updated_at,omitempty"`
 	Links              *Links   `json:"_links,omitempty" yaml:"_links,omitempty"`
 }
 
@@ -126,6 +133,10 @@ func (p ProductFilesService) ListForRelease(productSlug string, releaseID int) (
 }
 
 func (p ProductFilesService) Get(productSlug string, productFileID int) (ProductFile, error) {
+	return p.get(context.Background(), productSlug, productFileID)
+}
+
+func (p ProductFilesService) get(ctx context.Context, productSlug string, productFileID int) (ProductFile, error) {
 	url := fmt.Sprintf(
 		"/products/%s/product_files/%d",
 		productSlug,
@@ -133,7 +144,8 @@ func (p ProductFilesService) Get(productSlug string, productFileID int) (Product
 	)
 
 	var response ProductFileResponse
-	resp, err := p.client.MakeRequest(
+	resp, err := p.client.makeRequestWithContext(
+		ctx,
 		"GET",
 		url,
 		http.StatusOK,
@@ -280,6 +292,76 @@ type createUpdateProductFileBody struct {
 	ProductFile ProductFile `json:"product_file"`
 }
 
+// ProductFilePatch holds the product file fields to change. Nil fields
+// are left as they are.
+type ProductFilePatch struct {
+	Name               *string   `json:"name,omitempty"`
+	Description        *string   `json:"description,omitempty"`
+	DocsURL            *string   `json:"docs_url,omitempty"`
+	FileType           *string   `json:"file_type,omitempty"`
+	FileVersion        *string   `json:"file_version,omitempty"`
+	SHA256             *string   `json:"sha256,omitempty"`
+	MD5                *string   `json:"md5,omitempty"`
+	IncludedFiles      *[]string `json:"included_files,omitempty"`
+	Platforms          *[]string `json:"platforms,omitempty"`
+	ReleasedAt         *string   `json:"released_at,omitempty"`
+	SystemRequirements *[]string `json:"system_requirements,omitempty"`
+
+	// CheckUpdatedAt, when set, is the UpdatedAt of the product file as last
+	// read. The patch fails with ErrConflict if the product file has
+	// changed since. Like ReleasePatch.CheckUpdatedAt, the check is
+	// best-effort.
+	CheckUpdatedAt string `json:"-"`
+}
+
+type patchProductFileBody struct {
+	ProductFile ProductFilePatch `json:"product_file"`
+}
+
+// Patch changes only the fields set in the patch. Unlike Update, it can
+// change every mutable field of a product file.
+func (p ProductFilesService) Patch(productSlug string, productFileID int, patch ProductFilePatch) (ProductFile, error) {
+	if patch.CheckUpdatedAt != "" {
+		current, err := p.Get(productSlug, productFileID)
+		if err != nil {
+			return ProductFile{}, err
+		}
+
+		if current.UpdatedAt != patch.CheckUpdatedAt {
+			resource := fmt.Sprintf("product file %d", productFileID)
+			return ProductFile{}, newErrConflict(resource, patch.CheckUpdatedAt, current.UpdatedAt)
+		}
+	}
+
+	url := fmt.Sprintf("/products/%s/product_files/%d", productSlug, productFileID)
+
+	b, err := json.Marshal(patchProductFileBody{ProductFile: patch})
+	if err != nil {
+		// Untested as we cannot force an error because we are marshalling
+		// a known-good body
+		return ProductFile{}, err
+	}
+
+	var response ProductFileResponse
+	resp, err := p.client.MakeRequest(
+		"PATCH",
+		url,
+		http.StatusOK,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return ProductFile{}, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	return response.ProductFile, nil
+}
+
 func (p ProductFilesService) Delete(productSlug string, id int) (ProductFile, error) {
 	url := fmt.Sprintf(
 		"/products/%s/product_files/%d",
@@ -465,6 +547,49 @@ func (p ProductFilesService) DownloadForRelease(
 	releaseID int,
 	productFileID int,
 	progressWriter io.Writer,
+) error {
+	return p.downloadForRelease(
+		location,
+		productSlug,
+		releaseID,
+		productFileID,
+		progressWriter,
+		nil,
+		true,
+	)
+}
+
+// DownloadForReleaseWithProgress is like DownloadForRelease but also
+// reports the download's progress events to listener, which may be nil.
+// Unlike DownloadForRelease, it only shows a progress bar when
+// progressWriter is set.
+func (p ProductFilesService) DownloadForReleaseWithProgress(
+	location *os.File,
+	productSlug string,
+	releaseID int,
+	productFileID int,
+	progressWriter io.Writer,
+	listener download.ProgressListener,
+) error {
+	return p.downloadForRelease(
+		location,
+		productSlug,
+		releaseID,
+		productFileID,
+		progressWriter,
+		listener,
+		progressWriter != nil,
+	)
+}
+
+func (p ProductFilesService) downloadForRelease(
+	location *os.File,
+	productSlug string,
+	releaseID int,
+	productFileID int,
+	progressWriter io.Writer,
+	listener download.ProgressListener,
+	showBar bool,
 ) error {
 	pf, err := p.GetForRelease(
 		productSlug,
@@ -475,6 +600,11 @@ func (p ProductFilesService) DownloadForRelease(
 		return err
 	}
 
+	if p.copyFromCache(location, pf) {
+		reportCached(listener, int64(pf.Size))
+		return nil
+	}
+
 	downloadLink, err := pf.DownloadLink()
 	if err != nil {
 		return err
@@ -484,9 +614,14 @@ func (p ProductFilesService) DownloadForRelease(
 
 	productFileDownloadLinkFetcher := NewProductFileLinkFetcher(downloadLink, p.client)
 
-	p.client.downloader.Bar = download.NewBar()
+	downloader := p.client.downloader
+	downloader.Bar = nil
+	if showBar {
+		downloader.Bar = download.NewBar()
+	}
+	downloader.Progress = listener
 
-	err = p.client.downloader.Get(
+	err = downloader.Get(
 		location,
 		productFileDownloadLinkFetcher,
 		progressWriter,
@@ -495,5 +630,275 @@ func (p ProductFilesService) DownloadForRelease(
 		return err
 	}
 
+	p.addToCache(pf, location.Name(), false)
+
 	return nil
 }
+
+type AtomicDownloadConfig struct {
+	ProductSlug    string
+	ReleaseID      int
+	ProductFileID  int
+	Path           string
+	ProgressWriter io.Writer
+
+	// Progress, if set, receives the download's progress events.
+	Progress download.ProgressListener
+}
+
+// DownloadForReleaseAtomically downloads a product file to a temporary file
+// next to config.Path, verifies its size and checksums, and only then renames
+// it into place. The temporary file is removed if anything fails or ctx is
+// canceled, so config.Path never holds a partial download.
+func (p ProductFilesService) DownloadForReleaseAtomically(
+	ctx context.Context,
+	config AtomicDownloadConfig,
+) (ProductFile, error) {
+	pf, err := p.GetForRelease(
+		config.ProductSlug,
+		config.ReleaseID,
+		config.ProductFileID,
+	)
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	return p.downloadAtomically(ctx, pf, config)
+}
+
+// downloadAtomically downloads pf as described by config, which only needs
+// its Path and progress fields set.
+func (p ProductFilesService) downloadAtomically(
+	ctx context.Context,
+	pf ProductFile,
+	config AtomicDownloadConfig,
+) (ProductFile, error) {
+	dir := filepath.Dir(config.Path)
+
+	if p.client.cache != nil && pf.SHA256 != "" {
+		found, err := p.client.cache.Get(pf.SHA256, int64(pf.Size), config.Path)
+		if err != nil {
+			p.client.logger.Info("Failed to use cached file", logger.Data{"sha256": pf.SHA256, "error": err.Error()})
+		}
+		if err == nil && found {
+			p.client.logger.Debug("Using cached file", logger.Data{"sha256": pf.SHA256, "path": config.Path})
+			reportCached(config.Progress, int64(pf.Size))
+			return pf, syncDir(dir)
+		}
+	}
+
+	downloadLink, err := pf.DownloadLink()
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	tmpFile, err := ioutil.TempFile(dir, fmt.Sprintf(".%s.partial-", filepath.Base(config.Path)))
+	if err != nil {
+		return ProductFile{}, fmt.Errorf("failed to create temporary file: %s", err)
+	}
+
+	renamed := false
+	defer func() {
+		if !renamed {
+			tmpFile.Close()
+			os.Remove(tmpFile.Name())
+		}
+	}()
+
+	p.client.logger.Debug("Downloading file", logger.Data{
+		"downloadLink": downloadLink,
+		"tempFile":     tmpFile.Name(),
+	})
+
+	productFileDownloadLinkFetcher := NewProductFileLinkFetcher(downloadLink, p.client)
+
+	downloader := p.client.downloader
+	downloader.Bar = nil
+	if config.ProgressWriter != nil {
+		downloader.Bar = download.NewBar()
+	}
+	downloader.Progress = config.Progress
+
+	err = downloader.GetVerified(
+		ctx,
+		tmpFile,
+		productFileDownloadLinkFetcher,
+		config.ProgressWriter,
+		download.Expected{
+			Size:   int64(pf.Size),
+			SHA256: pf.SHA256,
+			MD5:    pf.MD5,
+		},
+	)
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	err = tmpFile.Sync()
+	if err != nil {
+		return ProductFile{}, fmt.Errorf("failed to sync temporary file: %s", err)
+	}
+
+	// Temporary files are only readable by their owner; the download
+	// should be as readable as any other.
+	err = tmpFile.Chmod(0644)
+	if err != nil {
+		return ProductFile{}, fmt.Errorf("failed to set permissions of temporary file: %s", err)
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return ProductFile{}, fmt.Errorf("failed to close temporary file: %s", err)
+	}
+
+	if ctx.Err() != nil {
+		return ProductFile{}, ctx.Err()
+	}
+
+	err = os.Rename(tmpFile.Name(), config.Path)
+	if err != nil {
+		return ProductFile{}, fmt.Errorf("failed to move download into place: %s", err)
+	}
+	renamed = true
+
+	err = syncDir(dir)
+	if err != nil {
+		return ProductFile{}, err
+	}
+
+	p.addToCache(pf, config.Path, true)
+
+	return pf, nil
+}
+
+// copyFromCache replaces the contents of location with a cached copy of pf
+// and reports whether it did. location is only changed when a cached copy
+// is found. Cache errors are logged and reported as a miss, so that the
+// file is downloaded instead.
+func (p ProductFilesService) copyFromCache(location *os.File, pf ProductFile) bool {
+	if p.client.cache == nil || pf.SHA256 == "" {
+		return false
+	}
+
+	blob, found, err := p.client.cache.Open(pf.SHA256, int64(pf.Size))
+	if err != nil {
+		p.client.logger.Info("Failed to use cached file", logger.Data{"sha256": pf.SHA256, "error": err.Error()})
+		return false
+	}
+	if !found {
+		return false
+	}
+	defer blob.Close()
+
+	err = replaceContents(location, blob)
+	if err != nil {
+		p.client.logger.Info("Failed to use cached file", logger.Data{"sha256": pf.SHA256, "error": err.Error()})
+		return false
+	}
+
+	p.client.logger.Debug("Using cached file", logger.Data{"sha256": pf.SHA256, "path": location.Name()})
+
+	return true
+}
+
+func replaceContents(location *os.File, r io.Reader) error {
+	_, err := location.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	err = location.Truncate(0)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(location, r)
+	return err
+}
+
+// addToCache stores a downloaded product file in the cache. A verified file
+// has already been checked against its SHA256 and is not hashed again.
+// Failing to cache a file does not fail its download.
+func (p ProductFilesService) addToCache(pf ProductFile, path string, verified bool) {
+	if p.client.cache == nil || pf.SHA256 == "" {
+		return
+	}
+
+	put := p.client.cache.Put
+	if verified {
+		put = p.client.cache.PutVerified
+	}
+
+	err := put(pf.SHA256, path)
+	if err != nil {
+		p.client.logger.Info("Failed to cache file", logger.Data{"path": path, "error": err.Error()})
+	}
+}
+
+// reportCached tells listener that a download was satisfied by the cache.
+func reportCached(listener download.ProgressListener, size int64) {
+	if listener == nil {
+		return
+	}
+
+	for _, t := range []download.EventType{download.EventStarted, download.EventFinished} {
+		listener.OnEvent(download.Event{
+			Type:         t,
+			Time:         time.Now(),
+			TotalBytes:   size,
+			BytesWritten: size,
+		})
+	}
+}
+
+// syncDir flushes a directory entry so a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory for sync: %s", err)
+	}
+	defer d.Close()
+
+	err = d.Sync()
+	if err != nil && runtime.GOOS != "windows" {
+		return fmt.Errorf("failed to sync directory: %s", err)
+	}
+
+	return nil
+}
+
+// TileMetadataForRelease reads the metadata of a .pivotal product file
+// with ranged requests, without downloading the whole file.
+func (p ProductFilesService) TileMetadataForRelease(
+	productSlug string,
+	releaseID int,
+	productFileID int,
+) (tile.TileMetadata, error) {
+	pf, err := p.GetForRelease(
+		productSlug,
+		releaseID,
+		productFileID,
+	)
+	if err != nil {
+		return tile.TileMetadata{}, err
+	}
+
+	downloadLink, err := pf.DownloadLink()
+	if err != nil {
+		return tile.TileMetadata{}, err
+	}
+
+	p.client.logger.Debug("Reading tile metadata", logger.Data{"downloadLink": downloadLink})
+
+	productFileDownloadLinkFetcher := NewProductFileLinkFetcher(downloadLink, p.client)
+
+	remoteFile, err := download.NewRemoteFile(
+		p.client.downloader.HTTPClient,
+		productFileDownloadLinkFetcher,
+	)
+	if err != nil {
+		return tile.TileMetadata{}, err
+	}
+
+	return tile.Read(remoteFile, remoteFile.Size())
+}
@@ -1,16 +1,25 @@
 package pivnet_test
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"time"
 
 	"github.com/onsi/gomega/ghttp"
 	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/cache"
+	"github.com/pivotal-cf/go-pivnet/download"
 	"github.com/pivotal-cf/go-pivnet/logger"
 	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -686,6 +695,94 @@ var _ = Describe("PivnetClient - product files", func() {
 		})
 	})
 
+	Describe("Patch Product File", func() {
+		var patchURL string
+
+		BeforeEach(func() {
+			patchURL = fmt.Sprintf("%s/products/%s/product_files/%d", apiPrefix, "banana-slug", 1234)
+		})
+
+		It("submits only the fields in the patch", func() {
+			docsURL := "https://example.com/docs"
+			releasedAt := "2018-01-01"
+			platforms := []string{"Linux"}
+			systemRequirements := []string{}
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", patchURL),
+					ghttp.VerifyJSON(`{"product_file":{"docs_url":"https://example.com/docs","platforms":["Linux"],"released_at":"2018-01-01","system_requirements":[]}}`),
+					ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 1234, "docs_url": "https://example.com/docs"}}`),
+				),
+			)
+
+			productFile, err := client.ProductFiles.Patch("banana-slug", 1234, pivnet.ProductFilePatch{
+				DocsURL:            &docsURL,
+				Platforms:          &platforms,
+				ReleasedAt:         &releasedAt,
+				SystemRequirements: &systemRequirements,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(productFile.DocsURL).To(Equal("https://example.com/docs"))
+		})
+
+		Context("when CheckUpdatedAt is set", func() {
+			var name string
+
+			BeforeEach(func() {
+				name = "Tile"
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", patchURL),
+						ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 1234, "updated_at": "2018-01-01T00:00:00Z"}}`),
+					),
+				)
+			})
+
+			It("patches a product file that has not changed", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", patchURL),
+						ghttp.VerifyJSON(`{"product_file":{"name":"Tile"}}`),
+						ghttp.RespondWith(http.StatusOK, `{"product_file": {"id": 1234, "name": "Tile"}}`),
+					),
+				)
+
+				productFile, err := client.ProductFiles.Patch("banana-slug", 1234, pivnet.ProductFilePatch{
+					Name:           &name,
+					CheckUpdatedAt: "2018-01-01T00:00:00Z",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(productFile.Name).To(Equal("Tile"))
+			})
+
+			It("returns a conflict for a product file that has changed", func() {
+				_, err := client.ProductFiles.Patch("banana-slug", 1234, pivnet.ProductFilePatch{
+					Name:           &name,
+					CheckUpdatedAt: "2017-12-31T00:00:00Z",
+				})
+				Expect(err).To(BeAssignableToTypeOf(pivnet.ErrConflict{}))
+				Expect(err).To(MatchError("product file 1234 was updated at 2018-01-01T00:00:00Z, after it was read at 2017-12-31T00:00:00Z"))
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns the error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", patchURL),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				_, err := client.ProductFiles.Patch("banana-slug", 1234, pivnet.ProductFilePatch{})
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
 	Describe("Delete Product File", func() {
 		var (
 			id = 1234
@@ -1124,9 +1221,8 @@ var _ = Describe("PivnetClient - product files", func() {
 			getStatusCode int
 			getResponse   interface{}
 
-			downloadLinkResponseStatusCode   int
-			cloudfrontLinkResponseStatusCode int
-			cloudfrontDownloadPath           string
+			downloadLinkResponseStatusCode int
+			cloudfrontDownloadPath         string
 		)
 
 		BeforeEach(func() {
@@ -1155,8 +1251,10 @@ var _ = Describe("PivnetClient - product files", func() {
 			}
 
 			downloadLinkResponseStatusCode = http.StatusFound
-			cloudfrontLinkResponseStatusCode = http.StatusOK
 			cloudfrontDownloadPath = "/download"
+
+			newClientConfig.DownloadMinChunkSize = 1
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
 		})
 
 		AfterEach(func() {
@@ -1380,4 +1478,437 @@ var _ = Describe("PivnetClient - product files", func() {
 			})
 		})
 	})
+	Describe("TileMetadataForRelease", func() {
+		var (
+			cloudfront    *ghttp.Server
+			releaseID     int
+			productFileID int
+			downloadLink  string
+			tileContents  []byte
+		)
+
+		BeforeEach(func() {
+			releaseID = 1234
+			productFileID = 2345
+			downloadLink = "/some/download/link"
+
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			f, err := w.Create("metadata/cf.yml")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.Write([]byte("name: cf\nproduct_version: 2.1.0\nstemcell_criteria:\n  os: ubuntu-trusty\n  version: '3541'\n"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(w.Close()).To(Succeed())
+			tileContents = buf.Bytes()
+
+			cloudfront = ghttp.NewServer()
+			cloudfront.RouteToHandler("HEAD", "/cf.pivotal", func(w http.ResponseWriter, req *http.Request) {
+				http.ServeContent(w, req, "cf.pivotal", time.Time{}, bytes.NewReader(tileContents))
+			})
+			cloudfront.RouteToHandler("GET", "/cf.pivotal", func(w http.ResponseWriter, req *http.Request) {
+				http.ServeContent(w, req, "cf.pivotal", time.Time{}, bytes.NewReader(tileContents))
+			})
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf(
+						"%s/products/%s/releases/%d/product_files/%d",
+						apiPrefix,
+						productSlug,
+						releaseID,
+						productFileID,
+					)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{
+						pivnet.ProductFile{
+							ID:           productFileID,
+							AWSObjectKey: "product-files/cf/cf.pivotal",
+							Links: &pivnet.Links{
+								Download: map[string]string{"href": downloadLink},
+							},
+						},
+					}),
+				),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", fmt.Sprintf("%s%s", apiPrefix, downloadLink)),
+					ghttp.RespondWith(http.StatusFound, []byte(`{}`),
+						http.Header{"Location": []string{cloudfront.URL() + "/cf.pivotal"}},
+					),
+				),
+			)
+		})
+
+		AfterEach(func() {
+			cloudfront.Close()
+		})
+
+		It("reads the tile metadata using ranged requests", func() {
+			metadata, err := client.ProductFiles.TileMetadataForRelease(
+				productSlug,
+				releaseID,
+				productFileID,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(metadata.Name).To(Equal("cf"))
+			Expect(metadata.ProductVersion).To(Equal("2.1.0"))
+			Expect(metadata.StemcellCriteria.Version).To(Equal("3541"))
+		})
+	})
+
+	Describe("DownloadForReleaseAtomically", func() {
+		var (
+			cloudfront    *ghttp.Server
+			releaseID     int
+			productFileID int
+			downloadLink  string
+			contents      []byte
+			productFile   pivnet.ProductFile
+			dir           string
+			path          string
+			ctx           context.Context
+			cancel        context.CancelFunc
+			getHandler    http.HandlerFunc
+		)
+
+		BeforeEach(func() {
+			releaseID = 1234
+			productFileID = 2345
+			downloadLink = "/some/download/link"
+			contents = []byte("some file contents")
+
+			productFile = pivnet.ProductFile{
+				ID:     productFileID,
+				Size:   len(contents),
+				SHA256: "cf57fcf9d6d7fb8fd7d8c30527c8f51026aa1d99ad77cc769dd0c757d4fe8667",
+				Links: &pivnet.Links{
+					Download: map[string]string{"href": downloadLink},
+				},
+			}
+
+			var err error
+			dir, err = ioutil.TempDir("", "atomic-download")
+			Expect(err).NotTo(HaveOccurred())
+			path = filepath.Join(dir, "product.tgz")
+
+			ctx, cancel = context.WithCancel(context.Background())
+
+			cloudfront = ghttp.NewServer()
+			cloudfront.AllowUnhandledRequests = true
+			cloudfront.RouteToHandler("HEAD", "/download", func(w http.ResponseWriter, req *http.Request) {
+				http.ServeContent(w, req, "product.tgz", time.Time{}, bytes.NewReader(contents))
+			})
+			getHandler = func(w http.ResponseWriter, req *http.Request) {
+				http.ServeContent(w, req, "product.tgz", time.Time{}, bytes.NewReader(contents))
+			}
+			cloudfront.RouteToHandler("GET", "/download", func(w http.ResponseWriter, req *http.Request) {
+				getHandler(w, req)
+			})
+
+			newClientConfig.DownloadMinChunkSize = 1
+			client = pivnet.NewClient(newClientConfig, fakeLogger)
+		})
+
+		JustBeforeEach(func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf(
+						"%s/products/%s/releases/%d/product_files/%d",
+						apiPrefix,
+						productSlug,
+						releaseID,
+						productFileID,
+					)),
+					ghttp.RespondWithJSONEncoded(http.StatusOK, pivnet.ProductFileResponse{productFile}),
+				),
+			)
+			server.RouteToHandler("POST", fmt.Sprintf("%s%s", apiPrefix, downloadLink),
+				ghttp.RespondWith(http.StatusFound, []byte(`{}`),
+					http.Header{"Location": []string{cloudfront.URL() + "/download"}},
+				),
+			)
+		})
+
+		AfterEach(func() {
+			cancel()
+			cloudfront.Close()
+			os.RemoveAll(dir)
+		})
+
+		It("downloads, verifies and moves the file into place", func() {
+			var events []download.Event
+			pf, err := client.ProductFiles.DownloadForReleaseAtomically(ctx, pivnet.AtomicDownloadConfig{
+				ProductSlug:    productSlug,
+				ReleaseID:      releaseID,
+				ProductFileID:  productFileID,
+				Path:           path,
+				ProgressWriter: GinkgoWriter,
+				Progress: download.ProgressListenerFunc(func(e download.Event) {
+					events = append(events, e)
+				}),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pf.ID).To(Equal(productFileID))
+
+			Expect(events[0].Type).To(Equal(download.EventStarted))
+			Expect(events[len(events)-2].Type).To(Equal(download.EventVerified))
+			Expect(events[len(events)-1].Type).To(Equal(download.EventFinished))
+
+			downloaded, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(downloaded).To(Equal(contents))
+
+			info, err := os.Stat(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+
+			entries, err := ioutil.ReadDir(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+		})
+
+		Context("when the checksum does not match", func() {
+			BeforeEach(func() {
+				productFile.SHA256 = "not-the-right-sha"
+			})
+
+			It("returns an error and leaves nothing behind", func() {
+				_, err := client.ProductFiles.DownloadForReleaseAtomically(ctx, pivnet.AtomicDownloadConfig{
+					ProductSlug:   productSlug,
+					ReleaseID:     releaseID,
+					ProductFileID: productFileID,
+					Path:          path,
+				})
+				Expect(err).To(BeAssignableToTypeOf(download.ErrChecksumMismatch{}))
+
+				entries, err := ioutil.ReadDir(dir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+
+		Context("when the size does not match", func() {
+			BeforeEach(func() {
+				productFile.Size = len(contents) + 1
+			})
+
+			It("returns an error and leaves nothing behind", func() {
+				_, err := client.ProductFiles.DownloadForReleaseAtomically(ctx, pivnet.AtomicDownloadConfig{
+					ProductSlug:   productSlug,
+					ReleaseID:     releaseID,
+					ProductFileID: productFileID,
+					Path:          path,
+				})
+				Expect(err).To(BeAssignableToTypeOf(download.ErrSizeMismatch{}))
+
+				_, err = os.Stat(path)
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			})
+		})
+
+		Context("when the context is canceled during the download", func() {
+			BeforeEach(func() {
+				getHandler = func(w http.ResponseWriter, req *http.Request) {
+					cancel()
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			})
+
+			It("returns the context error and removes the temporary file", func() {
+				_, err := client.ProductFiles.DownloadForReleaseAtomically(ctx, pivnet.AtomicDownloadConfig{
+					ProductSlug:   productSlug,
+					ReleaseID:     releaseID,
+					ProductFileID: productFileID,
+					Path:          path,
+				})
+				Expect(err).To(Equal(context.Canceled))
+
+				entries, err := ioutil.ReadDir(dir)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(entries).To(BeEmpty())
+			})
+		})
+	})
+})
+
+var _ = Describe("PivnetClient - product file cache", func() {
+	var (
+		server    *pivnettest.Server
+		client    pivnet.Client
+		fileCache *cache.Cache
+		dir       string
+
+		release     pivnet.Release
+		productFile pivnet.ProductFile
+		contents    []byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "product-file-cache")
+		Expect(err).NotTo(HaveOccurred())
+
+		fileCache, err = cache.New(filepath.Join(dir, "cache"), 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		contents = bytes.Repeat([]byte("stemcell"), 1000)
+
+		server = pivnettest.NewServer()
+		release = server.AddRelease("banana", pivnet.Release{Version: "1.2.3"})
+		productFile = server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/stemcell.tgz",
+		}, contents)
+
+		config := server.ClientConfig()
+		config.Cache = fileCache
+		client = pivnet.NewClient(config, &loggerfakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+		os.RemoveAll(dir)
+	})
+
+	It("downloads a product file once for DownloadForRelease", func() {
+		for _, name := range []string{"first", "second"} {
+			location, err := os.Create(filepath.Join(dir, name))
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = location.Write([]byte("previous contents that are longer than nothing"))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = client.ProductFiles.DownloadForRelease(location, "banana", release.ID, productFile.ID, nil)
+			Expect(err).NotTo(HaveOccurred())
+			location.Close()
+
+			Expect(ioutil.ReadFile(location.Name())).To(Equal(contents))
+		}
+
+		Expect(server.Downloads(productFile.ID)).To(Equal(1))
+
+		stats, err := fileCache.Stats()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stats.Entries).To(Equal(1))
+		Expect(stats.Hits).To(Equal(int64(1)))
+		Expect(stats.Misses).To(Equal(int64(1)))
+	})
+
+	It("downloads a product file once for DownloadForReleaseAtomically", func() {
+		for _, name := range []string{"first", "second"} {
+			var events []download.EventType
+
+			_, err := client.ProductFiles.DownloadForReleaseAtomically(context.Background(), pivnet.AtomicDownloadConfig{
+				ProductSlug:   "banana",
+				ReleaseID:     release.ID,
+				ProductFileID: productFile.ID,
+				Path:          filepath.Join(dir, name),
+				Progress: download.ProgressListenerFunc(func(e download.Event) {
+					events = append(events, e.Type)
+				}),
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.ReadFile(filepath.Join(dir, name))).To(Equal(contents))
+			Expect(events[len(events)-1]).To(Equal(download.EventFinished))
+		}
+
+		Expect(server.Downloads(productFile.ID)).To(Equal(1))
+	})
+
+	It("reports progress events for DownloadForReleaseWithProgress", func() {
+		for _, name := range []string{"first", "second"} {
+			var events []download.Event
+
+			location, err := os.Create(filepath.Join(dir, name))
+			Expect(err).NotTo(HaveOccurred())
+
+			err = client.ProductFiles.DownloadForReleaseWithProgress(
+				location,
+				"banana",
+				release.ID,
+				productFile.ID,
+				nil,
+				download.ProgressListenerFunc(func(e download.Event) {
+					events = append(events, e)
+				}),
+			)
+			Expect(err).NotTo(HaveOccurred())
+			location.Close()
+
+			Expect(ioutil.ReadFile(location.Name())).To(Equal(contents))
+
+			Expect(events[0].Type).To(Equal(download.EventStarted))
+			last := events[len(events)-1]
+			Expect(last.Type).To(Equal(download.EventFinished))
+			Expect(last.BytesWritten).To(Equal(int64(len(contents))))
+		}
+
+		Expect(server.Downloads(productFile.ID)).To(Equal(1))
+	})
+
+	It("downloads the file when the cache cannot be used", func() {
+		unusable := server.AddProductFile("banana", release.ID, pivnet.ProductFile{
+			AWSObjectKey: "product-files/banana/unusable.tgz",
+			SHA256:       "not-a-sha256",
+		}, contents)
+
+		location, err := os.Create(filepath.Join(dir, "unusable"))
+		Expect(err).NotTo(HaveOccurred())
+		defer location.Close()
+
+		err = client.ProductFiles.DownloadForRelease(location, "banana", release.ID, unusable.ID, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.ReadFile(location.Name())).To(Equal(contents))
+		Expect(server.Downloads(unusable.ID)).To(Equal(1))
+	})
+
+	It("downloads again when the cached blob has been corrupted", func() {
+		for _, name := range []string{"first", "second"} {
+			path := filepath.Join(dir, name)
+			_, err := client.ProductFiles.DownloadForReleaseAtomically(context.Background(), pivnet.AtomicDownloadConfig{
+				ProductSlug:   "banana",
+				ReleaseID:     release.ID,
+				ProductFileID: productFile.ID,
+				Path:          path,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.ReadFile(path)).To(Equal(contents))
+
+			blobs, err := filepath.Glob(filepath.Join(dir, "cache", "sha256", "*", "*"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(blobs).To(HaveLen(1))
+			Expect(ioutil.WriteFile(blobs[0], bytes.Repeat([]byte("x"), len(contents)), 0644)).To(Succeed())
+		}
+
+		location, err := os.Create(filepath.Join(dir, "third"))
+		Expect(err).NotTo(HaveOccurred())
+		defer location.Close()
+
+		err = client.ProductFiles.DownloadForRelease(location, "banana", release.ID, productFile.ID, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.ReadFile(location.Name())).To(Equal(contents))
+
+		Expect(server.Downloads(productFile.ID)).To(Equal(3))
+	})
+
+	It("downloads again when the cached blob has been removed", func() {
+		path := filepath.Join(dir, "first")
+		config := pivnet.AtomicDownloadConfig{
+			ProductSlug:   "banana",
+			ReleaseID:     release.ID,
+			ProductFileID: productFile.ID,
+			Path:          path,
+		}
+
+		_, err := client.ProductFiles.DownloadForReleaseAtomically(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.RemoveAll(filepath.Join(dir, "cache", "sha256"))).To(Succeed())
+
+		_, err = client.ProductFiles.DownloadForReleaseAtomically(context.Background(), config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(ioutil.ReadFile(path)).To(Equal(contents))
+		Expect(server.Downloads(productFile.ID)).To(Equal(2))
+	})
 })
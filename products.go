@@ -14,9 +14,11 @@ type ProductsService struct {
 }
 
 type Product struct {
-	ID   int    `json:"id,omitempty" yaml:"id,omitempty"`
-	Slug string `json:"slug,omitempty" yaml:"slug,omitempty"`
-	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	ID          int    `json:"id,omitempty" yaml:"id,omitempty"`
+	Slug        string `json:"slug,omitempty" yaml:"slug,omitempty"`
+	Name        string `json:"name,omitempty" yaml:"name,omitempty"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	LogoURL     string `json:"logo_url,omitempty" yaml:"logo_url,omitempty"`
 }
 
 type ProductsResponse struct {
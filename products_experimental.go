@@ -0,0 +1,182 @@
+package pivnet
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+// ExperimentalProductsService creates, updates and deletes products and
+// manages their settings.
+//
+// Experimental: POST /products, PATCH and DELETE /products/:slug, and GET
+// and PUT /products/:slug/settings are not described in the Pivotal
+// Network API documentation. They follow the conventions of the other
+// resources and have only been exercised against pivnettest, so Pivotal
+// Network may refuse them. This service may change or be removed without
+// notice until the endpoints are confirmed.
+type ExperimentalProductsService struct {
+	client Client
+	l      logger.Logger
+}
+
+type CreateProductConfig struct {
+	Slug        string
+	Name        string
+	Description string
+	LogoURL     string
+}
+
+type createProductBody struct {
+	Product Product `json:"product"`
+}
+
+// ProductPatch holds the product fields to change. Fields left nil are
+// unchanged, so a pointer to an empty string clears a field.
+type ProductPatch struct {
+	Slug        *string `json:"slug,omitempty"`
+	Name        *string `json:"name,omitempty"`
+	Description *string `json:"description,omitempty"`
+	LogoURL     *string `json:"logo_url,omitempty"`
+}
+
+type patchProductBody struct {
+	Product ProductPatch `json:"product"`
+}
+
+// ProductSettings are the settings of a product. The defaults apply to
+// releases created without their own values. They are not described in
+// the API documentation; see ExperimentalProductsService.
+type ProductSettings struct {
+	DefaultEULASlug    string `json:"default_eula_slug" yaml:"default_eula_slug"`
+	DefaultReleaseType string `json:"default_release_type" yaml:"default_release_type"`
+	Controlled         bool   `json:"controlled" yaml:"controlled"`
+	ECCN               string `json:"eccn" yaml:"eccn"`
+	LicenseException   string `json:"license_exception" yaml:"license_exception"`
+}
+
+type productSettingsBody struct {
+	Settings ProductSettings `json:"settings"`
+}
+
+func (p ExperimentalProductsService) Create(config CreateProductConfig) (Product, error) {
+	body := createProductBody{
+		Product: Product{
+			Slug:        config.Slug,
+			Name:        config.Name,
+			Description: config.Description,
+			LogoURL:     config.LogoURL,
+		},
+	}
+
+	return p.send("POST", "/products", http.StatusCreated, body)
+}
+
+// Patch changes only the fields set in the patch.
+func (p ExperimentalProductsService) Patch(slug string, patch ProductPatch) (Product, error) {
+	url := fmt.Sprintf("/products/%s", slug)
+
+	return p.send("PATCH", url, http.StatusOK, patchProductBody{Product: patch})
+}
+
+func (p ExperimentalProductsService) Delete(slug string) error {
+	url := fmt.Sprintf("/products/%s", slug)
+
+	resp, err := p.client.MakeRequest(
+		"DELETE",
+		url,
+		http.StatusNoContent,
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return nil
+}
+
+func (p ExperimentalProductsService) GetSettings(slug string) (ProductSettings, error) {
+	url := fmt.Sprintf("/products/%s/settings", slug)
+
+	var response productSettingsBody
+	resp, err := p.client.MakeRequest(
+		"GET",
+		url,
+		http.StatusOK,
+		nil,
+	)
+	if err != nil {
+		return ProductSettings{}, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ProductSettings{}, err
+	}
+
+	return response.Settings, nil
+}
+
+// UpdateSettings replaces all of a product's settings.
+func (p ExperimentalProductsService) UpdateSettings(slug string, settings ProductSettings) (ProductSettings, error) {
+	url := fmt.Sprintf("/products/%s/settings", slug)
+
+	b, err := json.Marshal(productSettingsBody{Settings: settings})
+	if err != nil {
+		// Untested as we cannot force an error because we are marshalling
+		// a known-good body
+		return ProductSettings{}, err
+	}
+
+	var response productSettingsBody
+	resp, err := p.client.MakeRequest(
+		"PUT",
+		url,
+		http.StatusOK,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return ProductSettings{}, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return ProductSettings{}, err
+	}
+
+	return response.Settings, nil
+}
+
+func (p ExperimentalProductsService) send(method string, url string, expectedStatusCode int, body interface{}) (Product, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		// Untested as we cannot force an error because we are marshalling
+		// a known-good body
+		return Product{}, err
+	}
+
+	var response Product
+	resp, err := p.client.MakeRequest(
+		method,
+		url,
+		expectedStatusCode,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return Product{}, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return Product{}, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,387 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PivnetClient - experimental products", func() {
+	var (
+		server     *ghttp.Server
+		client     pivnet.Client
+		token      string
+		apiAddress string
+		userAgent  string
+
+		newClientConfig pivnet.ClientConfig
+		fakeLogger      logger.Logger
+	)
+
+	BeforeEach(func() {
+		server = ghttp.NewServer()
+		apiAddress = server.URL()
+		token = "my-auth-token"
+		userAgent = "pivnet-resource/0.1.0 (some-url)"
+
+		fakeLogger = &loggerfakes.FakeLogger{}
+		newClientConfig = pivnet.ClientConfig{
+			Host:      apiAddress,
+			Token:     token,
+			UserAgent: userAgent,
+		}
+		client = pivnet.NewClient(newClientConfig, fakeLogger)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Create", func() {
+		var (
+			config pivnet.CreateProductConfig
+		)
+
+		BeforeEach(func() {
+			config = pivnet.CreateProductConfig{
+				Slug:        "my-product",
+				Name:        "My Product",
+				Description: "some description",
+				LogoURL:     "https://example.com/logo.png",
+			}
+		})
+
+		It("creates the product", func() {
+			expectedRequestBody := `{"product":{"slug":"my-product","name":"My Product","description":"some description","logo_url":"https://example.com/logo.png"}}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", fmt.Sprintf("%s/products", apiPrefix)),
+					ghttp.VerifyJSON(expectedRequestBody),
+					ghttp.RespondWith(http.StatusCreated, `{"id":3,"slug":"my-product","name":"My Product"}`),
+				),
+			)
+
+			product, err := client.ExperimentalProducts.Create(config)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(product.ID).To(Equal(3))
+			Expect(product.Slug).To(Equal("my-product"))
+		})
+
+		Context("when the server responds with a non-201 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", fmt.Sprintf("%s/products", apiPrefix)),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				_, err := client.ExperimentalProducts.Create(config)
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
+	Describe("Patch", func() {
+		var (
+			slug = "my-product"
+		)
+
+		It("sends only the fields set", func() {
+			expectedRequestBody := `{"product":{"slug":"new-product","name":"New Product","description":""}}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", fmt.Sprintf("%s/products/%s", apiPrefix, slug)),
+					ghttp.VerifyJSON(expectedRequestBody),
+					ghttp.RespondWith(http.StatusOK, `{"id":3,"slug":"new-product","name":"New Product"}`),
+				),
+			)
+
+			newSlug := "new-product"
+			name := "New Product"
+			description := ""
+
+			product, err := client.ExperimentalProducts.Patch(slug, pivnet.ProductPatch{
+				Slug:        &newSlug,
+				Name:        &name,
+				Description: &description,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(product.Slug).To(Equal("new-product"))
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", fmt.Sprintf("%s/products/%s", apiPrefix, slug)),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				name := "New Product"
+
+				_, err := client.ExperimentalProducts.Patch(slug, pivnet.ProductPatch{Name: &name})
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
+	Describe("Delete", func() {
+		var (
+			slug = "my-product"
+		)
+
+		It("deletes the product", func() {
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("DELETE", fmt.Sprintf("%s/products/%s", apiPrefix, slug)),
+					ghttp.RespondWith(http.StatusNoContent, nil),
+				),
+			)
+
+			err := client.ExperimentalProducts.Delete(slug)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		Context("when the server responds with a non-204 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("DELETE", fmt.Sprintf("%s/products/%s", apiPrefix, slug)),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				err := client.ExperimentalProducts.Delete(slug)
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
+	Describe("GetSettings", func() {
+		var (
+			slug = "my-product"
+		)
+
+		It("returns the product's settings", func() {
+			response := `{"settings":{"default_eula_slug":"my-eula","default_release_type":"Major Release","controlled":true,"eccn":"5D002","license_exception":"ENC"}}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s/settings", apiPrefix, slug)),
+					ghttp.RespondWith(http.StatusOK, response),
+				),
+			)
+
+			settings, err := client.ExperimentalProducts.GetSettings(slug)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings).To(Equal(pivnet.ProductSettings{
+				DefaultEULASlug:    "my-eula",
+				DefaultReleaseType: "Major Release",
+				Controlled:         true,
+				ECCN:               "5D002",
+				LicenseException:   "ENC",
+			}))
+		})
+
+		Context("when the server responds with a non-2XX status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", fmt.Sprintf("%s/products/%s/settings", apiPrefix, slug)),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				_, err := client.ExperimentalProducts.GetSettings(slug)
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
+	Describe("UpdateSettings", func() {
+		var (
+			slug = "my-product"
+		)
+
+		It("sends every setting", func() {
+			expectedRequestBody := `{"settings":{"default_eula_slug":"my-eula","default_release_type":"","controlled":false,"eccn":"","license_exception":""}}`
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PUT", fmt.Sprintf("%s/products/%s/settings", apiPrefix, slug)),
+					ghttp.VerifyJSON(expectedRequestBody),
+					ghttp.RespondWith(http.StatusOK, expectedRequestBody),
+				),
+			)
+
+			settings, err := client.ExperimentalProducts.UpdateSettings(slug, pivnet.ProductSettings{DefaultEULASlug: "my-eula"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings.DefaultEULASlug).To(Equal("my-eula"))
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns an error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PUT", fmt.Sprintf("%s/products/%s/settings", apiPrefix, slug)),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				_, err := client.ExperimentalProducts.UpdateSettings(slug, pivnet.ProductSettings{})
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+})
+
+var _ = Describe("PivnetClient - experimental product management", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("creates, updates and deletes a product", func() {
+		created, err := client.ExperimentalProducts.Create(pivnet.CreateProductConfig{
+			Slug:        "banana",
+			Name:        "Banana",
+			Description: "A fruit",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(created.ID).NotTo(BeZero())
+
+		product, err := client.Products.Get("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(product).To(Equal(created))
+
+		products, err := client.Products.List()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(products).To(Equal([]pivnet.Product{created}))
+
+		logoURL := "https://example.com/banana.png"
+		updated, err := client.ExperimentalProducts.Patch("banana", pivnet.ProductPatch{LogoURL: &logoURL})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Name).To(Equal("Banana"))
+		Expect(updated.Description).To(Equal("A fruit"))
+		Expect(updated.LogoURL).To(Equal("https://example.com/banana.png"))
+
+		cleared := ""
+		updated, err = client.ExperimentalProducts.Patch("banana", pivnet.ProductPatch{Description: &cleared, LogoURL: &cleared})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Name).To(Equal("Banana"))
+		Expect(updated.Description).To(BeEmpty())
+		Expect(updated.LogoURL).To(BeEmpty())
+
+		Expect(client.ExperimentalProducts.Delete("banana")).To(Succeed())
+
+		_, err = client.Products.Get("banana")
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNotFound{}))
+	})
+
+	It("refuses a product without a name", func() {
+		_, err := client.ExperimentalProducts.Create(pivnet.CreateProductConfig{Slug: "banana"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("refuses to clear a product's name", func() {
+		server.AddProduct(pivnet.Product{Slug: "banana", Name: "Banana"})
+
+		cleared := ""
+		_, err := client.ExperimentalProducts.Patch("banana", pivnet.ProductPatch{Name: &cleared})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("refuses a slug that is taken", func() {
+		server.AddProduct(pivnet.Product{Slug: "banana", Name: "Banana"})
+
+		_, err := client.ExperimentalProducts.Create(pivnet.CreateProductConfig{Slug: "banana", Name: "Other"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the product has releases", func() {
+		var (
+			release pivnet.Release
+		)
+
+		BeforeEach(func() {
+			server.AddProduct(pivnet.Product{Slug: "banana", Name: "Banana"})
+			release = server.AddRelease("banana", pivnet.Release{Version: "1.0.0"})
+		})
+
+		It("moves them with a change of slug", func() {
+			slug := "plantain"
+			_, err := client.ExperimentalProducts.Patch("banana", pivnet.ProductPatch{Slug: &slug})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = client.Products.Get("banana")
+			Expect(err).To(HaveOccurred())
+
+			releases, err := client.Releases.List("plantain")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(releases).To(HaveLen(1))
+			Expect(releases[0].ID).To(Equal(release.ID))
+		})
+
+		It("refuses to delete the product", func() {
+			err := client.ExperimentalProducts.Delete("banana")
+			Expect(err).To(HaveOccurred())
+
+			_, err = client.Products.Get("banana")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	It("lists no releases for a product without any", func() {
+		server.AddProduct(pivnet.Product{Slug: "banana", Name: "Banana"})
+
+		releases, err := client.Releases.List("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releases).To(BeEmpty())
+	})
+
+	It("manages the product's settings", func() {
+		server.AddProduct(pivnet.Product{Slug: "banana", Name: "Banana"})
+		server.AddEULA(pivnet.EULA{Slug: "banana-eula", Name: "Banana EULA"})
+
+		settings, err := client.ExperimentalProducts.GetSettings("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(Equal(pivnet.ProductSettings{}))
+
+		desired := pivnet.ProductSettings{
+			DefaultEULASlug:    "banana-eula",
+			DefaultReleaseType: "Major Release",
+			Controlled:         true,
+		}
+		updated, err := client.ExperimentalProducts.UpdateSettings("banana", desired)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated).To(Equal(desired))
+
+		settings, err = client.ExperimentalProducts.GetSettings("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(Equal(desired))
+
+		_, err = client.ExperimentalProducts.UpdateSettings("banana", pivnet.ProductSettings{DefaultEULASlug: "no-such-eula"})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,395 @@
+package pivnet
+
+import (
+	"fmt"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+type CloneReleaseConfig struct {
+	ProductSlug string
+
+	// SourceReleaseID is the release to clone.
+	SourceReleaseID int
+
+	// Version is the version of the new release.
+	Version string
+
+	// Customize, when set, is called with the new release before it is
+	// created, to change any of the fields copied from the source release.
+	// Every field that can be set when creating a release can be changed,
+	// as can Availability and OSSCompliant, which are patched once
+	// everything is attached. The new release is Admins Only unless
+	// Customize changes its availability. Changes to other fields, such as
+	// the ID or links, are ignored.
+	Customize func(release *Release)
+
+	// CopyProductFiles attaches the source release's product files to the
+	// new release.
+	CopyProductFiles bool
+
+	// ReplaceProductFiles maps IDs of the source release's product files to
+	// IDs of existing product files attached in their place, directly and
+	// in copied file groups.
+	ReplaceProductFiles map[int]int
+
+	// CopyFileGroups attaches the source release's file groups to the new
+	// release. A file group that contains a replaced product file is
+	// copied to a new file group of the same name, so that the source
+	// release is left unchanged.
+	CopyFileGroups bool
+
+	CopyUserGroups            bool
+	CopyDependencies          bool
+	CopyDependencySpecifiers  bool
+	CopyUpgradePaths          bool
+	CopyUpgradePathSpecifiers bool
+}
+
+// replacement returns the ID of the product file to attach in place of
+// one of the source release's.
+func (c CloneReleaseConfig) replacement(productFileID int) int {
+	if id, ok := c.ReplaceProductFiles[productFileID]; ok {
+		return id
+	}
+	return productFileID
+}
+
+// releaseAttachments is everything attached to a release that can be
+// cloned.
+type releaseAttachments struct {
+	productFiles          []ProductFile
+	fileGroups            []FileGroup
+	userGroups            []UserGroup
+	dependencies          []ReleaseDependency
+	dependencySpecifiers  []DependencySpecifier
+	upgradePaths          []ReleaseUpgradePath
+	upgradePathSpecifiers []UpgradePathSpecifier
+}
+
+// CloneRelease creates a new version of a release, copying its fields and, as
+// configured, what is attached to it. If the new release is created but
+// attaching to it fails, CloneRelease returns the new release along with the
+// error.
+func (c Client) CloneRelease(config CloneReleaseConfig) (Release, error) {
+	if config.Version == "" {
+		return Release{}, fmt.Errorf("cannot clone release %d: no version given", config.SourceReleaseID)
+	}
+
+	source, err := c.Releases.Get(config.ProductSlug, config.SourceReleaseID)
+	if err != nil {
+		return Release{}, err
+	}
+
+	attachments, err := c.cloneAttachments(config)
+	if err != nil {
+		return Release{}, err
+	}
+
+	err = checkReplacements(config, attachments)
+	if err != nil {
+		return Release{}, err
+	}
+
+	desired := source
+	desired.ID = 0
+	desired.Version = config.Version
+	desired.Availability = AvailabilityAdminsOnly
+	desired.Links = nil
+	desired.UpdatedAt = ""
+	desired.SoftwareFilesUpdatedAt = ""
+	if config.Customize != nil {
+		config.Customize(&desired)
+	}
+
+	eulaSlug := ""
+	if desired.EULA != nil {
+		eulaSlug = desired.EULA.Slug
+	}
+
+	release, err := c.Releases.Create(CreateReleaseConfig{
+		ProductSlug:           config.ProductSlug,
+		Version:               desired.Version,
+		ReleaseType:           string(desired.ReleaseType),
+		ReleaseDate:           desired.ReleaseDate,
+		EULASlug:              eulaSlug,
+		Description:           desired.Description,
+		ReleaseNotesURL:       desired.ReleaseNotesURL,
+		Controlled:            desired.Controlled,
+		ECCN:                  desired.ECCN,
+		LicenseException:      desired.LicenseException,
+		EndOfSupportDate:      desired.EndOfSupportDate,
+		EndOfGuidanceDate:     desired.EndOfGuidanceDate,
+		EndOfAvailabilityDate: desired.EndOfAvailabilityDate,
+	})
+	if err != nil {
+		return Release{}, err
+	}
+
+	c.logger.Info("Cloned release", logger.Data{
+		"product":       config.ProductSlug,
+		"source":        source.Version,
+		"version":       release.Version,
+		"release id":    release.ID,
+		"source id":     source.ID,
+		"product files": len(attachments.productFiles),
+		"file groups":   len(attachments.fileGroups),
+	})
+
+	err = c.attachClone(config, release.ID, attachments)
+	if err != nil {
+		return release, fmt.Errorf("cloned release %s to %s but failed to attach to it: %s", source.Version, release.Version, err)
+	}
+
+	return c.finishClone(config.ProductSlug, release, desired)
+}
+
+// finishClone patches the fields of a cloned release that are not set when
+// it is created.
+func (c Client) finishClone(productSlug string, release Release, desired Release) (Release, error) {
+	live, err := c.Releases.Get(productSlug, release.ID)
+	if err != nil {
+		return release, err
+	}
+
+	var patch ReleasePatch
+	if desired.Availability != "" && desired.Availability != live.Availability {
+		patch.Availability = &desired.Availability
+	}
+	if desired.OSSCompliant != "" && desired.OSSCompliant != live.OSSCompliant {
+		patch.OSSCompliant = &desired.OSSCompliant
+	}
+	if patch == (ReleasePatch{}) {
+		return live, nil
+	}
+
+	patch.CheckUpdatedAt = live.UpdatedAt
+	patched, err := c.Releases.Patch(productSlug, release.ID, patch)
+	if err != nil {
+		return live, err
+	}
+
+	return patched, nil
+}
+
+func (c Client) cloneAttachments(config CloneReleaseConfig) (releaseAttachments, error) {
+	var (
+		a   releaseAttachments
+		err error
+	)
+
+	slug := config.ProductSlug
+	id := config.SourceReleaseID
+
+	if config.CopyProductFiles {
+		a.productFiles, err = c.ProductFiles.ListForRelease(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyFileGroups {
+		a.fileGroups, err = c.FileGroups.ListForRelease(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyUserGroups {
+		a.userGroups, err = c.UserGroups.ListForRelease(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyDependencies {
+		a.dependencies, err = c.ReleaseDependencies.List(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyDependencySpecifiers {
+		a.dependencySpecifiers, err = c.DependencySpecifiers.List(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyUpgradePaths {
+		a.upgradePaths, err = c.ReleaseUpgradePaths.Get(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+	if config.CopyUpgradePathSpecifiers {
+		a.upgradePathSpecifiers, err = c.UpgradePathSpecifiers.List(slug, id)
+		if err != nil {
+			return a, err
+		}
+	}
+
+	return a, nil
+}
+
+// checkReplacements makes sure that every replaced product file is one
+// being copied, so that a mistyped ID is caught before anything is created.
+func checkReplacements(config CloneReleaseConfig, a releaseAttachments) error {
+	copied := map[int]bool{}
+	for _, pf := range a.productFiles {
+		copied[pf.ID] = true
+	}
+	for _, fg := range a.fileGroups {
+		for _, pf := range fg.ProductFiles {
+			copied[pf.ID] = true
+		}
+	}
+
+	for id := range config.ReplaceProductFiles {
+		if !copied[id] {
+			return fmt.Errorf("cannot replace product file %d: it is not copied from release %d", id, config.SourceReleaseID)
+		}
+	}
+
+	return nil
+}
+
+// attachClone attaches everything to the new release. File groups copied
+// for it are deleted again if attaching fails.
+func (c Client) attachClone(config CloneReleaseConfig, releaseID int, a releaseAttachments) error {
+	slug := config.ProductSlug
+
+	fileGroupIDs, clones, err := c.cloneFileGroups(config, a.fileGroups)
+	if err != nil {
+		return err
+	}
+
+	err = c.attachCloneTo(config, releaseID, a, fileGroupIDs)
+	if err != nil {
+		return c.deleteFileGroups(slug, clones, err)
+	}
+
+	return nil
+}
+
+// attachCloneTo attaches everything to the new release, with the given
+// file groups in place of the source release's.
+func (c Client) attachCloneTo(config CloneReleaseConfig, releaseID int, a releaseAttachments, fileGroupIDs []int) error {
+	slug := config.ProductSlug
+
+	for _, pf := range a.productFiles {
+		err := c.ProductFiles.AddToRelease(slug, releaseID, config.replacement(pf.ID))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fileGroupID := range fileGroupIDs {
+		err := c.FileGroups.AddToRelease(slug, releaseID, fileGroupID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, ug := range a.userGroups {
+		err := c.UserGroups.AddToRelease(slug, releaseID, ug.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, d := range a.dependencies {
+		err := c.ReleaseDependencies.Add(slug, releaseID, d.Release.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range a.dependencySpecifiers {
+		_, err := c.DependencySpecifiers.Create(slug, releaseID, s.Product.Slug, s.Specifier)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, u := range a.upgradePaths {
+		err := c.ReleaseUpgradePaths.Add(slug, releaseID, u.Release.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range a.upgradePathSpecifiers {
+		_, err := c.UpgradePathSpecifiers.Create(slug, releaseID, s.Specifier)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cloneFileGroups returns the IDs of the file groups to attach in place of
+// the source release's, and of the new file groups among them.
+func (c Client) cloneFileGroups(config CloneReleaseConfig, fileGroups []FileGroup) ([]int, []int, error) {
+	var ids, clones []int
+
+	for _, fg := range fileGroups {
+		id, cloned, err := c.cloneFileGroup(config, fg)
+		if cloned {
+			clones = append(clones, id)
+		}
+		if err != nil {
+			return nil, nil, c.deleteFileGroups(config.ProductSlug, clones, err)
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, clones, nil
+}
+
+// cloneFileGroup returns the file group to attach in place of fg: fg
+// itself, or a new file group with its replaced product files swapped in.
+// It reports whether the file group is new, even when filling it fails.
+func (c Client) cloneFileGroup(config CloneReleaseConfig, fg FileGroup) (int, bool, error) {
+	replaced := false
+	for _, pf := range fg.ProductFiles {
+		if _, ok := config.ReplaceProductFiles[pf.ID]; ok {
+			replaced = true
+		}
+	}
+	if !replaced {
+		return fg.ID, false, nil
+	}
+
+	clone, err := c.FileGroups.Create(CreateFileGroupConfig{
+		ProductSlug: config.ProductSlug,
+		Name:        fg.Name,
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	for _, pf := range fg.ProductFiles {
+		err := c.ProductFiles.AddToFileGroup(config.ProductSlug, clone.ID, config.replacement(pf.ID))
+		if err != nil {
+			return clone.ID, true, err
+		}
+	}
+
+	return clone.ID, true, nil
+}
+
+// deleteFileGroups deletes the file groups copied for a clone that failed,
+// and returns the failure along with any file groups left behind.
+func (c Client) deleteFileGroups(productSlug string, fileGroupIDs []int, cause error) error {
+	var left []int
+	for _, id := range fileGroupIDs {
+		_, err := c.FileGroups.Delete(productSlug, id)
+		if err != nil {
+			left = append(left, id)
+		}
+	}
+
+	if len(left) > 0 {
+		return fmt.Errorf("%s (file groups %v copied for the clone could not be deleted)", cause, left)
+	}
+
+	return cause
+}
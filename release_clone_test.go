@@ -0,0 +1,262 @@
+package pivnet_test
+
+import (
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PivnetClient - clone release", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+
+		source     pivnet.Release
+		previous   pivnet.Release
+		dependency pivnet.Release
+		tile       pivnet.ProductFile
+		stemcell   pivnet.ProductFile
+		fileGroup  pivnet.FileGroup
+		userGroup  pivnet.UserGroup
+		config     pivnet.CloneReleaseConfig
+	)
+
+	productFileIDs := func(productFiles []pivnet.ProductFile) []int {
+		var ids []int
+		for _, pf := range productFiles {
+			ids = append(ids, pf.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		server.AddEULA(pivnet.EULA{Slug: "banana-eula"})
+		userGroup = server.AddUserGroup(pivnet.UserGroup{Name: "Beta Testers"})
+		dependency = server.AddRelease("apple", pivnet.Release{Version: "2.0.0"})
+		previous = server.AddRelease("banana", pivnet.Release{Version: "1.2.2"})
+		source = server.AddRelease("banana", pivnet.Release{
+			Version:         "1.2.3",
+			ReleaseType:     "Minor Release",
+			ReleaseDate:     "2018-01-01",
+			EULA:            &pivnet.EULA{Slug: "banana-eula"},
+			Description:     "Bananas",
+			ReleaseNotesURL: "https://example.com/notes",
+			Availability:    "All Users",
+		})
+
+		tile = server.AddProductFile("banana", source.ID, pivnet.ProductFile{AWSObjectKey: "banana-1.2.3.pivotal"}, []byte("tile"))
+		stemcell = server.AddProductFile("banana", source.ID, pivnet.ProductFile{AWSObjectKey: "stemcell-1.tgz"}, []byte("stemcell"))
+		fileGroup = server.AddFileGroup("banana", source.ID, "Stemcells", stemcell.ID)
+		server.AddDependency("banana", source.ID, pivnet.DependentRelease{ID: dependency.ID, Version: dependency.Version, Product: pivnet.Product{Slug: "apple"}})
+		server.AddUpgradePath("banana", source.ID, pivnet.UpgradePathRelease{ID: previous.ID, Version: previous.Version})
+
+		Expect(client.UserGroups.AddToRelease("banana", source.ID, userGroup.ID)).To(Succeed())
+		_, err := client.DependencySpecifiers.Create("banana", source.ID, "apple", "2.0.*")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.UpgradePathSpecifiers.Create("banana", source.ID, "1.1.*")
+		Expect(err).NotTo(HaveOccurred())
+
+		config = pivnet.CloneReleaseConfig{
+			ProductSlug:     "banana",
+			SourceReleaseID: source.ID,
+			Version:         "1.2.4",
+		}
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("copies the release's fields to a new Admins Only version", func() {
+		release, err := client.CloneRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(release.ID).NotTo(Equal(source.ID))
+		Expect(release.Version).To(Equal("1.2.4"))
+		Expect(release.ReleaseType).To(Equal(pivnet.ReleaseType("Minor Release")))
+		Expect(release.ReleaseDate).To(Equal("2018-01-01"))
+		Expect(release.EULA.Slug).To(Equal("banana-eula"))
+		Expect(release.Description).To(Equal("Bananas"))
+		Expect(release.ReleaseNotesURL).To(Equal("https://example.com/notes"))
+		Expect(release.Availability).To(Equal("Admins Only"))
+
+		productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(BeEmpty())
+	})
+
+	It("overrides fields with Customize", func() {
+		config.Customize = func(r *pivnet.Release) {
+			r.Description = "More bananas"
+			r.ReleaseDate = "2018-02-01"
+			r.Availability = "Selected User Groups Only"
+			r.OSSCompliant = "exempt"
+		}
+
+		release, err := client.CloneRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(release.Description).To(Equal("More bananas"))
+		Expect(release.ReleaseDate).To(Equal("2018-02-01"))
+		Expect(release.Availability).To(Equal("Selected User Groups Only"))
+		Expect(release.OSSCompliant).To(Equal("exempt"))
+
+		fetched, err := client.Releases.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fetched.Availability).To(Equal("Selected User Groups Only"))
+		Expect(fetched.OSSCompliant).To(Equal("exempt"))
+	})
+
+	It("copies everything attached to the release", func() {
+		config.CopyProductFiles = true
+		config.CopyFileGroups = true
+		config.CopyUserGroups = true
+		config.CopyDependencies = true
+		config.CopyDependencySpecifiers = true
+		config.CopyUpgradePaths = true
+		config.CopyUpgradePathSpecifiers = true
+
+		release, err := client.CloneRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFileIDs(productFiles)).To(Equal([]int{tile.ID, stemcell.ID}))
+
+		fileGroups, err := client.FileGroups.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileGroups).To(HaveLen(1))
+		Expect(fileGroups[0].ID).To(Equal(fileGroup.ID))
+
+		userGroups, err := client.UserGroups.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userGroups).To(HaveLen(1))
+		Expect(userGroups[0].ID).To(Equal(userGroup.ID))
+
+		dependencies, err := client.ReleaseDependencies.List("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies).To(HaveLen(1))
+		Expect(dependencies[0].Release.ID).To(Equal(dependency.ID))
+
+		dependencySpecifiers, err := client.DependencySpecifiers.List("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencySpecifiers).To(HaveLen(1))
+		Expect(dependencySpecifiers[0].Product.Slug).To(Equal("apple"))
+		Expect(dependencySpecifiers[0].Specifier).To(Equal("2.0.*"))
+
+		upgradePaths, err := client.ReleaseUpgradePaths.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePaths).To(HaveLen(1))
+		Expect(upgradePaths[0].Release.ID).To(Equal(previous.ID))
+
+		upgradePathSpecifiers, err := client.UpgradePathSpecifiers.List("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePathSpecifiers).To(HaveLen(1))
+		Expect(upgradePathSpecifiers[0].Specifier).To(Equal("1.1.*"))
+	})
+
+	Context("when product files are replaced", func() {
+		var newStemcell pivnet.ProductFile
+
+		BeforeEach(func() {
+			var err error
+			newStemcell, err = client.ProductFiles.Create(pivnet.CreateProductFileConfig{
+				ProductSlug:  "banana",
+				AWSObjectKey: "stemcell-2.tgz",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			config.CopyProductFiles = true
+			config.CopyFileGroups = true
+			config.ReplaceProductFiles = map[int]int{stemcell.ID: newStemcell.ID}
+		})
+
+		It("attaches the replacements instead", func() {
+			release, err := client.CloneRelease(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(productFileIDs(productFiles)).To(Equal([]int{tile.ID, newStemcell.ID}))
+		})
+
+		It("copies file groups containing them, leaving the source release unchanged", func() {
+			release, err := client.CloneRelease(config)
+			Expect(err).NotTo(HaveOccurred())
+
+			fileGroups, err := client.FileGroups.ListForRelease("banana", release.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileGroups).To(HaveLen(1))
+			Expect(fileGroups[0].ID).NotTo(Equal(fileGroup.ID))
+			Expect(fileGroups[0].Name).To(Equal("Stemcells"))
+			Expect(productFileIDs(fileGroups[0].ProductFiles)).To(Equal([]int{newStemcell.ID}))
+
+			sourceGroups, err := client.FileGroups.ListForRelease("banana", source.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sourceGroups).To(HaveLen(1))
+			Expect(productFileIDs(sourceGroups[0].ProductFiles)).To(Equal([]int{stemcell.ID}))
+
+			sourceFiles, err := client.ProductFiles.ListForRelease("banana", source.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(productFileIDs(sourceFiles)).To(Equal([]int{tile.ID, stemcell.ID}))
+		})
+
+		It("deletes the copied file groups when attaching fails", func() {
+			config.CopyDependencies = true
+			err := client.Releases.Delete("apple", dependency)
+			Expect(err).NotTo(HaveOccurred())
+
+			release, err := client.CloneRelease(config)
+			Expect(err).To(MatchError(ContainSubstring("failed to attach to it")))
+
+			fileGroups, err := client.FileGroups.List("banana")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fileGroups).To(HaveLen(1))
+			Expect(fileGroups[0].ID).To(Equal(fileGroup.ID))
+
+			releaseGroups, err := client.FileGroups.ListForRelease("banana", release.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(releaseGroups).To(BeEmpty())
+		})
+
+		It("fails before creating anything for a product file that is not copied", func() {
+			config.ReplaceProductFiles = map[int]int{12345: newStemcell.ID}
+
+			_, err := client.CloneRelease(config)
+			Expect(err).To(MatchError(ContainSubstring("cannot replace product file 12345")))
+
+			releases, err := client.Releases.List("banana")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(releases).To(HaveLen(2))
+		})
+	})
+
+	It("returns the new release when attaching fails", func() {
+		config.CopyProductFiles = true
+		config.ReplaceProductFiles = map[int]int{tile.ID: 12345}
+
+		release, err := client.CloneRelease(config)
+		Expect(err).To(MatchError(ContainSubstring("cloned release 1.2.3 to 1.2.4 but failed to attach to it")))
+		Expect(release.Version).To(Equal("1.2.4"))
+	})
+
+	It("requires a version", func() {
+		config.Version = ""
+
+		_, err := client.CloneRelease(config)
+		Expect(err).To(MatchError(ContainSubstring("no version given")))
+	})
+
+	It("fails when the source release does not exist", func() {
+		config.SourceReleaseID = 12345
+
+		_, err := client.CloneRelease(config)
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNotFound{}))
+	})
+})
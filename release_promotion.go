@@ -0,0 +1,285 @@
+package pivnet
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+// Availabilities of a release, in the order it is promoted through them.
+const (
+	AvailabilityAdminsOnly             = "Admins Only"
+	AvailabilitySelectedUserGroupsOnly = "Selected User Groups Only"
+	AvailabilityAllUsers               = "All Users"
+)
+
+var availabilityStages = []string{
+	AvailabilityAdminsOnly,
+	AvailabilitySelectedUserGroupsOnly,
+	AvailabilityAllUsers,
+}
+
+type PromoteReleaseConfig struct {
+	ProductSlug string
+	ReleaseID   int
+
+	// To is the availability to promote the release to. When empty, the
+	// release is promoted to the stage after its current one. Stages may
+	// be skipped, but a release is never demoted.
+	To string
+
+	// RequiredUserGroups are the names of user groups that must be
+	// attached to the release before it is made available to selected
+	// user groups.
+	RequiredUserGroups []string
+
+	// SkipReleaseNotesCheck skips checking that the release notes URL is
+	// set and reachable.
+	SkipReleaseNotesCheck bool
+
+	// HTTPClient checks the release notes URL. It defaults to a client
+	// with a 30 second timeout.
+	HTTPClient *http.Client
+}
+
+// Promotion records a change of a release's availability.
+type Promotion struct {
+	ProductSlug string
+	ReleaseID   int
+	Version     string
+	From        string
+	To          string
+	PromotedAt  time.Time
+}
+
+// ErrPromotionBlocked is returned when a release does not meet the
+// preconditions for its promotion. Problems lists every unmet one.
+type ErrPromotionBlocked struct {
+	Version  string
+	To       string
+	Problems []string
+}
+
+func (e ErrPromotionBlocked) Error() string {
+	return fmt.Sprintf(
+		"release %s cannot be made %s: %s",
+		e.Version,
+		e.To,
+		strings.Join(e.Problems, "; "),
+	)
+}
+
+// PromoteRelease moves a release to a wider availability once it meets the
+// preconditions checked by CheckReleasePromotion.
+func (c Client) PromoteRelease(config PromoteReleaseConfig) (Promotion, error) {
+	release, to, err := c.checkReleasePromotion(config)
+	if err != nil {
+		return Promotion{}, err
+	}
+
+	promotion := Promotion{
+		ProductSlug: config.ProductSlug,
+		ReleaseID:   release.ID,
+		Version:     release.Version,
+		From:        release.Availability,
+		To:          to,
+	}
+
+	_, err = c.Releases.Patch(config.ProductSlug, release.ID, ReleasePatch{
+		Availability:   &to,
+		CheckUpdatedAt: release.UpdatedAt,
+	})
+	if err != nil {
+		return Promotion{}, err
+	}
+
+	promotion.PromotedAt = time.Now()
+
+	c.logger.Info("Promoted release", logger.Data{
+		"product": promotion.ProductSlug,
+		"version": promotion.Version,
+		"from":    promotion.From,
+		"to":      promotion.To,
+	})
+
+	return promotion, nil
+}
+
+// CheckReleasePromotion checks that a release can be promoted without
+// changing it. Every release must have a EULA, product files that are
+// ready to serve and have checksums, and reachable release notes before
+// leaving Admins Only; one made available to selected user groups must
+// also have the required user groups attached.
+func (c Client) CheckReleasePromotion(config PromoteReleaseConfig) error {
+	_, _, err := c.checkReleasePromotion(config)
+	return err
+}
+
+func (c Client) checkReleasePromotion(config PromoteReleaseConfig) (Release, string, error) {
+	release, err := c.Releases.Get(config.ProductSlug, config.ReleaseID)
+	if err != nil {
+		return Release{}, "", err
+	}
+
+	from := stage(release.Availability)
+	if from < 0 {
+		return Release{}, "", fmt.Errorf("release %s has unknown availability %q", release.Version, release.Availability)
+	}
+
+	to := config.To
+	if to == "" {
+		if from == len(availabilityStages)-1 {
+			return Release{}, "", fmt.Errorf("release %s is already available to %s", release.Version, AvailabilityAllUsers)
+		}
+		to = availabilityStages[from+1]
+	}
+
+	switch s := stage(to); {
+	case s < 0:
+		return Release{}, "", fmt.Errorf("unknown availability %q", to)
+	case s <= from:
+		return Release{}, "", fmt.Errorf("release %s is %s and cannot be promoted to %s", release.Version, release.Availability, to)
+	}
+
+	var problems []string
+	if release.EULA == nil || release.EULA.Slug == "" {
+		problems = append(problems, "no EULA is set")
+	}
+
+	fileProblems, err := c.productFileProblems(config.ProductSlug, release.ID)
+	if err != nil {
+		return Release{}, "", err
+	}
+	problems = append(problems, fileProblems...)
+
+	if to == AvailabilitySelectedUserGroupsOnly {
+		userGroupProblems, err := c.userGroupProblems(config, release.ID)
+		if err != nil {
+			return Release{}, "", err
+		}
+		problems = append(problems, userGroupProblems...)
+	}
+
+	if !config.SkipReleaseNotesCheck {
+		problem := releaseNotesProblem(config.HTTPClient, release.ReleaseNotesURL)
+		if problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+
+	if len(problems) > 0 {
+		return Release{}, "", ErrPromotionBlocked{
+			Version:  release.Version,
+			To:       to,
+			Problems: problems,
+		}
+	}
+
+	return release, to, nil
+}
+
+func stage(availability string) int {
+	for i, a := range availabilityStages {
+		if a == availability {
+			return i
+		}
+	}
+	return -1
+}
+
+// productFileProblems checks every product file of a release, attached
+// directly or through a file group. Each is fetched on its own, for its
+// current transfer status.
+func (c Client) productFileProblems(productSlug string, releaseID int) ([]string, error) {
+	productFiles, err := c.ProductFiles.ListForRelease(productSlug, releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	fileGroups, err := c.FileGroups.ListForRelease(productSlug, releaseID)
+	if err != nil {
+		return nil, err
+	}
+	for _, fg := range fileGroups {
+		productFiles = append(productFiles, fg.ProductFiles...)
+	}
+
+	var problems []string
+	seen := map[int]bool{}
+	for _, listed := range productFiles {
+		if seen[listed.ID] {
+			continue
+		}
+		seen[listed.ID] = true
+
+		pf, err := c.ProductFiles.Get(productSlug, listed.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pf.ReadyToServe {
+			problems = append(problems, fmt.Sprintf("product file %s is not ready to serve", pf.AWSObjectKey))
+		}
+		if pf.SHA256 == "" && pf.MD5 == "" {
+			problems = append(problems, fmt.Sprintf("product file %s has no checksum", pf.AWSObjectKey))
+		}
+	}
+
+	return problems, nil
+}
+
+func (c Client) userGroupProblems(config PromoteReleaseConfig, releaseID int) ([]string, error) {
+	userGroups, err := c.UserGroups.ListForRelease(config.ProductSlug, releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(userGroups) == 0 {
+		return []string{"no user groups are attached"}, nil
+	}
+
+	attached := map[string]bool{}
+	for _, ug := range userGroups {
+		attached[ug.Name] = true
+	}
+
+	var problems []string
+	for _, name := range config.RequiredUserGroups {
+		if !attached[name] {
+			problems = append(problems, fmt.Sprintf("user group %s is not attached", name))
+		}
+	}
+
+	return problems, nil
+}
+
+// releaseNotesProblem checks that the release notes can be fetched from
+// here. Servers that do not allow HEAD requests are asked with GET.
+func releaseNotesProblem(httpClient *http.Client, url string) string {
+	if url == "" {
+		return "no release notes URL is set"
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := httpClient.Head(url)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = httpClient.Get(url)
+	}
+	if err != nil {
+		return fmt.Sprintf("release notes %s are unreachable: %s", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Sprintf("release notes %s are unreachable: %s", url, resp.Status)
+	}
+
+	return ""
+}
@@ -0,0 +1,232 @@
+package pivnet_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PivnetClient - promote release", func() {
+	var (
+		server      *pivnettest.Server
+		notes       *httptest.Server
+		notesStatus int
+		notesMethod string
+		onNotes     func()
+		client      pivnet.Client
+
+		release pivnet.Release
+		config  pivnet.PromoteReleaseConfig
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+		notesStatus = http.StatusOK
+		notesMethod = ""
+		onNotes = nil
+		notes = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if notesMethod != "" && req.Method != notesMethod {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			if onNotes != nil {
+				onNotes()
+			}
+			w.WriteHeader(notesStatus)
+		}))
+
+		release = server.AddRelease("banana", pivnet.Release{
+			Version:         "1.2.3",
+			Availability:    pivnet.AvailabilityAdminsOnly,
+			EULA:            &pivnet.EULA{Slug: "banana-eula"},
+			ReleaseNotesURL: notes.URL + "/notes",
+			OSSCompliant:    "exempt",
+		})
+		server.AddProductFile("banana", release.ID, pivnet.ProductFile{AWSObjectKey: "banana.pivotal", ReadyToServe: true}, []byte("tile"))
+
+		beta := server.AddUserGroup(pivnet.UserGroup{Name: "Beta Testers"})
+		Expect(client.UserGroups.AddToRelease("banana", release.ID, beta.ID)).To(Succeed())
+
+		config = pivnet.PromoteReleaseConfig{
+			ProductSlug:        "banana",
+			ReleaseID:          release.ID,
+			RequiredUserGroups: []string{"Beta Testers"},
+		}
+	})
+
+	AfterEach(func() {
+		notes.Close()
+		server.Close()
+	})
+
+	availability := func() string {
+		r, err := client.Releases.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		return r.Availability
+	}
+
+	It("promotes a release to the next stage and records the change", func() {
+		promotion, err := client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(promotion.ProductSlug).To(Equal("banana"))
+		Expect(promotion.ReleaseID).To(Equal(release.ID))
+		Expect(promotion.Version).To(Equal("1.2.3"))
+		Expect(promotion.From).To(Equal(pivnet.AvailabilityAdminsOnly))
+		Expect(promotion.To).To(Equal(pivnet.AvailabilitySelectedUserGroupsOnly))
+		Expect(promotion.PromotedAt).NotTo(BeZero())
+		Expect(availability()).To(Equal(pivnet.AvailabilitySelectedUserGroupsOnly))
+
+		promotion, err = client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promotion.From).To(Equal(pivnet.AvailabilitySelectedUserGroupsOnly))
+		Expect(promotion.To).To(Equal(pivnet.AvailabilityAllUsers))
+		Expect(availability()).To(Equal(pivnet.AvailabilityAllUsers))
+	})
+
+	It("changes nothing but the availability", func() {
+		_, err := client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		r, err := client.Releases.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.OSSCompliant).To(Equal("exempt"))
+		Expect(r.ReleaseNotesURL).To(Equal(notes.URL + "/notes"))
+	})
+
+	It("does not promote a release changed while it is checked", func() {
+		onNotes = func() {
+			defer GinkgoRecover()
+			onNotes = nil
+
+			description := "Changed meanwhile"
+			_, err := client.Releases.Patch("banana", release.ID, pivnet.ReleasePatch{Description: &description})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		_, err := client.PromoteRelease(config)
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrConflict{}))
+
+		r, err := client.Releases.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Availability).To(Equal(pivnet.AvailabilityAdminsOnly))
+		Expect(r.Description).To(Equal("Changed meanwhile"))
+	})
+
+	It("skips stages when asked to", func() {
+		config.To = pivnet.AvailabilityAllUsers
+
+		promotion, err := client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(promotion.To).To(Equal(pivnet.AvailabilityAllUsers))
+		Expect(availability()).To(Equal(pivnet.AvailabilityAllUsers))
+	})
+
+	It("does not promote past All Users", func() {
+		config.To = pivnet.AvailabilityAllUsers
+		_, err := client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		config.To = ""
+		_, err = client.PromoteRelease(config)
+		Expect(err).To(MatchError("release 1.2.3 is already available to All Users"))
+	})
+
+	It("does not demote a release", func() {
+		_, err := client.PromoteRelease(config)
+		Expect(err).NotTo(HaveOccurred())
+
+		config.To = pivnet.AvailabilityAdminsOnly
+		_, err = client.PromoteRelease(config)
+		Expect(err).To(MatchError("release 1.2.3 is Selected User Groups Only and cannot be promoted to Admins Only"))
+	})
+
+	It("rejects unknown availabilities", func() {
+		config.To = "Everyone"
+
+		_, err := client.PromoteRelease(config)
+		Expect(err).To(MatchError(`unknown availability "Everyone"`))
+	})
+
+	It("reports every unmet precondition without changing the release", func() {
+		unready := server.AddRelease("banana", pivnet.Release{
+			Version:      "1.2.4",
+			Availability: pivnet.AvailabilityAdminsOnly,
+		})
+		pf := server.AddProductFile("banana", unready.ID, pivnet.ProductFile{AWSObjectKey: "unready.pivotal"}, nil)
+		grouped := server.AddProductFile("banana", release.ID, pivnet.ProductFile{AWSObjectKey: "grouped.tgz", ReadyToServe: true, SHA256: "abc", MD5: "def"}, nil)
+		server.AddFileGroup("banana", unready.ID, "Stemcells", grouped.ID, pf.ID)
+
+		config.ReleaseID = unready.ID
+
+		_, err := client.PromoteRelease(config)
+		Expect(err).To(HaveOccurred())
+
+		blocked, ok := err.(pivnet.ErrPromotionBlocked)
+		Expect(ok).To(BeTrue())
+		Expect(blocked.Version).To(Equal("1.2.4"))
+		Expect(blocked.To).To(Equal(pivnet.AvailabilitySelectedUserGroupsOnly))
+		Expect(blocked.Problems).To(Equal([]string{
+			"no EULA is set",
+			"product file unready.pivotal is not ready to serve",
+			"no user groups are attached",
+			"no release notes URL is set",
+		}))
+		Expect(err.Error()).To(HavePrefix("release 1.2.4 cannot be made Selected User Groups Only: no EULA is set; "))
+
+		r, err := client.Releases.Get("banana", unready.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Availability).To(Equal(pivnet.AvailabilityAdminsOnly))
+	})
+
+	It("requires checksums", func() {
+		pf, err := client.ProductFiles.Create(pivnet.CreateProductFileConfig{ProductSlug: "banana", AWSObjectKey: "docs.pdf"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(client.ProductFiles.AddToRelease("banana", release.ID, pf.ID)).To(Succeed())
+
+		err = client.CheckReleasePromotion(config)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(pivnet.ErrPromotionBlocked).Problems).To(Equal([]string{
+			"product file docs.pdf is not ready to serve",
+			"product file docs.pdf has no checksum",
+		}))
+	})
+
+	It("requires the named user groups for selected user groups only", func() {
+		config.RequiredUserGroups = []string{"Beta Testers", "Partners"}
+
+		err := client.CheckReleasePromotion(config)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(pivnet.ErrPromotionBlocked).Problems).To(Equal([]string{"user group Partners is not attached"}))
+
+		config.To = pivnet.AvailabilityAllUsers
+		Expect(client.CheckReleasePromotion(config)).To(Succeed())
+	})
+
+	It("requires the release notes to be reachable", func() {
+		notesStatus = http.StatusNotFound
+
+		err := client.CheckReleasePromotion(config)
+		Expect(err).To(HaveOccurred())
+		Expect(err.(pivnet.ErrPromotionBlocked).Problems).To(Equal([]string{
+			"release notes " + notes.URL + "/notes are unreachable: 404 Not Found",
+		}))
+
+		config.SkipReleaseNotesCheck = true
+		Expect(client.CheckReleasePromotion(config)).To(Succeed())
+	})
+
+	It("falls back to GET when the release notes server does not allow HEAD", func() {
+		notesMethod = "GET"
+
+		Expect(client.CheckReleasePromotion(config)).To(Succeed())
+	})
+})
@@ -201,6 +201,89 @@ func (r ReleasesService) Update(productSlug string, release Release) (Release, e
 	return response.Release, nil
 }
 
+// ReleasePatch holds the release fields to change. Nil fields are left as
+// they are.
+type ReleasePatch struct {
+	Version               *string      `json:"version,omitempty"`
+	ReleaseType           *ReleaseType `json:"release_type,omitempty"`
+	ReleaseDate           *string      `json:"release_date,omitempty"`
+	EULASlug              *string      `json:"-"`
+	Availability          *string      `json:"availability,omitempty"`
+	OSSCompliant          *string      `json:"oss_compliant,omitempty"`
+	Description           *string      `json:"description,omitempty"`
+	ReleaseNotesURL       *string      `json:"release_notes_url,omitempty"`
+	Controlled            *bool        `json:"controlled,omitempty"`
+	ECCN                  *string      `json:"eccn,omitempty"`
+	LicenseException      *string      `json:"license_exception,omitempty"`
+	EndOfSupportDate      *string      `json:"end_of_support_date,omitempty"`
+	EndOfGuidanceDate     *string      `json:"end_of_guidance_date,omitempty"`
+	EndOfAvailabilityDate *string      `json:"end_of_availability_date,omitempty"`
+
+	// CheckUpdatedAt, when set, is the UpdatedAt of the release as last read.
+	// The patch fails with ErrConflict if the release has changed since.
+	// The API documents no conditional update, so the release is read again
+	// just before it is patched: the check is best-effort, and a change made
+	// between that read and the patch goes undetected.
+	CheckUpdatedAt string `json:"-"`
+}
+
+type patchReleaseBody struct {
+	Release struct {
+		ReleasePatch
+		EULA *EULA `json:"eula,omitempty"`
+	} `json:"release"`
+}
+
+// Patch changes only the fields set in the patch, leaving any other
+// changes made since the release was read in place.
+func (r ReleasesService) Patch(productSlug string, releaseID int, patch ReleasePatch) (Release, error) {
+	if patch.CheckUpdatedAt != "" {
+		current, err := r.Get(productSlug, releaseID)
+		if err != nil {
+			return Release{}, err
+		}
+
+		if current.UpdatedAt != patch.CheckUpdatedAt {
+			resource := fmt.Sprintf("release %d", releaseID)
+			return Release{}, newErrConflict(resource, patch.CheckUpdatedAt, current.UpdatedAt)
+		}
+	}
+
+	url := fmt.Sprintf("/products/%s/releases/%d", productSlug, releaseID)
+
+	var body patchReleaseBody
+	body.Release.ReleasePatch = patch
+	if patch.EULASlug != nil {
+		body.Release.EULA = &EULA{Slug: *patch.EULASlug}
+	}
+
+	b, err := json.Marshal(body)
+	if err != nil {
+		// Untested as we cannot force an error because we are marshalling
+		// a known-good body
+		return Release{}, err
+	}
+
+	var response CreateReleaseResponse
+	resp, err := r.client.MakeRequest(
+		"PATCH",
+		url,
+		http.StatusOK,
+		bytes.NewReader(b),
+	)
+	if err != nil {
+		return Release{}, err
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return Release{}, err
+	}
+
+	return response.Release, nil
+}
+
 func (r ReleasesService) Delete(productSlug string, release Release) error {
 	url := fmt.Sprintf(
 		"/products/%s/releases/%d",
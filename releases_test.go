@@ -507,6 +507,94 @@ var _ = Describe("PivnetClient - product files", func() {
 		})
 	})
 
+	Describe("Patch", func() {
+		var patchURL string
+
+		BeforeEach(func() {
+			patchURL = fmt.Sprintf("%s/products/%s/releases/%d", apiPrefix, "banana-slug", 42)
+		})
+
+		It("submits only the fields in the patch", func() {
+			description := ""
+			eulaSlug := "some-eula"
+			controlled := false
+
+			server.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("PATCH", patchURL),
+					ghttp.VerifyJSON(`{"release":{"description":"","controlled":false,"eula":{"slug":"some-eula"}}}`),
+					ghttp.RespondWith(http.StatusOK, `{"release": {"id": 42, "version": "1.2.3"}}`),
+				),
+			)
+
+			release, err := client.Releases.Patch("banana-slug", 42, pivnet.ReleasePatch{
+				Description: &description,
+				EULASlug:    &eulaSlug,
+				Controlled:  &controlled,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(release.ID).To(Equal(42))
+		})
+
+		Context("when CheckUpdatedAt is set", func() {
+			var version string
+
+			BeforeEach(func() {
+				version = "1.2.4"
+
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("GET", patchURL),
+						ghttp.RespondWith(http.StatusOK, `{"id": 42, "updated_at": "2018-01-01T00:00:00Z"}`),
+					),
+				)
+			})
+
+			It("patches a release that has not changed", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", patchURL),
+						ghttp.VerifyJSON(`{"release":{"version":"1.2.4"}}`),
+						ghttp.RespondWith(http.StatusOK, `{"release": {"id": 42, "version": "1.2.4"}}`),
+					),
+				)
+
+				release, err := client.Releases.Patch("banana-slug", 42, pivnet.ReleasePatch{
+					Version:        &version,
+					CheckUpdatedAt: "2018-01-01T00:00:00Z",
+				})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(release.Version).To(Equal("1.2.4"))
+			})
+
+			It("returns a conflict for a release that has changed", func() {
+				_, err := client.Releases.Patch("banana-slug", 42, pivnet.ReleasePatch{
+					Version:        &version,
+					CheckUpdatedAt: "2017-12-31T00:00:00Z",
+				})
+				Expect(err).To(Equal(pivnet.ErrConflict{
+					ResponseCode: http.StatusConflict,
+					Message:      "release 42 was updated at 2018-01-01T00:00:00Z, after it was read at 2017-12-31T00:00:00Z",
+				}))
+				Expect(server.ReceivedRequests()).To(HaveLen(1))
+			})
+		})
+
+		Context("when the server responds with a non-200 status code", func() {
+			It("returns the error", func() {
+				server.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("PATCH", patchURL),
+						ghttp.RespondWith(http.StatusTeapot, `{"message":"foo message"}`),
+					),
+				)
+
+				_, err := client.Releases.Patch("banana-slug", 42, pivnet.ReleasePatch{})
+				Expect(err.Error()).To(ContainSubstring("foo message"))
+			})
+		})
+	})
+
 	Describe("Delete", func() {
 		var (
 			release pivnet.Release
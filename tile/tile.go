@@ -0,0 +1,154 @@
+package tile
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+var ErrMetadataNotFound = errors.New("no metadata/*.yml file found in tile")
+
+type TileMetadata struct {
+	Name                        string              `json:"name,omitempty" yaml:"name,omitempty"`
+	Label                       string              `json:"label,omitempty" yaml:"label,omitempty"`
+	Description                 string              `json:"description,omitempty" yaml:"description,omitempty"`
+	ProductVersion              string              `json:"product_version,omitempty" yaml:"product_version,omitempty"`
+	MetadataVersion             string              `json:"metadata_version,omitempty" yaml:"metadata_version,omitempty"`
+	MinimumVersionForUpgrade    string              `json:"minimum_version_for_upgrade,omitempty" yaml:"minimum_version_for_upgrade,omitempty"`
+	StemcellCriteria            StemcellCriteria    `json:"stemcell_criteria,omitempty" yaml:"stemcell_criteria,omitempty"`
+	AdditionalStemcellsCriteria []StemcellCriteria  `json:"additional_stemcells_criteria,omitempty" yaml:"additional_stemcells_criteria,omitempty"`
+	Releases                    []Release           `json:"releases,omitempty" yaml:"releases,omitempty"`
+	ProvidesProductVersions     []ProductVersion    `json:"provides_product_versions,omitempty" yaml:"provides_product_versions,omitempty"`
+	RequiresProductVersions     []ProductVersion    `json:"requires_product_versions,omitempty" yaml:"requires_product_versions,omitempty"`
+	PropertyBlueprints          []PropertyBlueprint `json:"property_blueprints,omitempty" yaml:"property_blueprints,omitempty"`
+}
+
+type StemcellCriteria struct {
+	OS                         string `json:"os,omitempty" yaml:"os,omitempty"`
+	Version                    string `json:"version,omitempty" yaml:"version,omitempty"`
+	RequiresCPI                bool   `json:"requires_cpi,omitempty" yaml:"requires_cpi,omitempty"`
+	EnablePatchSecurityUpdates bool   `json:"enable_patch_security_updates,omitempty" yaml:"enable_patch_security_updates,omitempty"`
+}
+
+type Release struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	File    string `json:"file,omitempty" yaml:"file,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+type ProductVersion struct {
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+}
+
+type PropertyBlueprint struct {
+	Name         string      `json:"name,omitempty" yaml:"name,omitempty"`
+	Type         string      `json:"type,omitempty" yaml:"type,omitempty"`
+	Label        string      `json:"label,omitempty" yaml:"label,omitempty"`
+	Configurable bool        `json:"configurable,omitempty" yaml:"configurable,omitempty"`
+	Optional     bool        `json:"optional,omitempty" yaml:"optional,omitempty"`
+	Default      interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// ReadFile returns the metadata of a .pivotal tile on the local filesystem.
+func ReadFile(filepath string) (TileMetadata, error) {
+	f, err := os.Open(filepath)
+	if err != nil {
+		return TileMetadata{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return TileMetadata{}, err
+	}
+
+	return Read(f, info.Size())
+}
+
+// Read returns the metadata of the .pivotal tile readable through r.
+// Only the zip central directory and the metadata file are read, so r may
+// be backed by ranged remote reads (see download.RemoteFile).
+func Read(r io.ReaderAt, size int64) (TileMetadata, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return TileMetadata{}, fmt.Errorf("failed to open tile as zip: %s", err)
+	}
+
+	var metadataFile *zip.File
+	for _, f := range zr.File {
+		if isMetadataFile(f.Name) {
+			metadataFile = f
+			break
+		}
+	}
+
+	if metadataFile == nil {
+		return TileMetadata{}, ErrMetadataNotFound
+	}
+
+	rc, err := metadataFile.Open()
+	if err != nil {
+		return TileMetadata{}, fmt.Errorf("failed to open %s: %s", metadataFile.Name, err)
+	}
+	defer rc.Close()
+
+	b, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return TileMetadata{}, fmt.Errorf("failed to read %s: %s", metadataFile.Name, err)
+	}
+
+	return Parse(b)
+}
+
+// Parse decodes the contents of a tile metadata file.
+func Parse(b []byte) (TileMetadata, error) {
+	var metadata TileMetadata
+	err := yaml.Unmarshal(b, &metadata)
+	if err != nil {
+		return TileMetadata{}, fmt.Errorf("failed to parse tile metadata: %s", err)
+	}
+
+	for i, pb := range metadata.PropertyBlueprints {
+		metadata.PropertyBlueprints[i].Default = normalize(pb.Default)
+	}
+
+	return metadata, nil
+}
+
+func isMetadataFile(name string) bool {
+	dir, file := path.Split(name)
+	if strings.TrimPrefix(dir, "./") != "metadata/" {
+		return false
+	}
+
+	ext := path.Ext(file)
+	return ext == ".yml" || ext == ".yaml"
+}
+
+// normalize converts the map[interface{}]interface{} values produced by
+// yaml.v2 into map[string]interface{} so the metadata can be JSON encoded.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprintf("%v", k)] = normalize(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalize(val)
+		}
+		return t
+	default:
+		return v
+	}
+}
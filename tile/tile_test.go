@@ -0,0 +1,156 @@
+package tile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/pivotal-cf/go-pivnet/tile"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+const metadataYAML = `---
+name: cf
+label: Pivotal Application Service
+product_version: 2.1.0
+metadata_version: "2.1"
+minimum_version_for_upgrade: 2.0.0-build.1
+stemcell_criteria:
+  os: ubuntu-trusty
+  version: "3541"
+  enable_patch_security_updates: true
+releases:
+- name: cf-networking
+  file: cf-networking-1.11.0.tgz
+  version: 1.11.0
+requires_product_versions:
+- name: p-bosh
+  version: ~> 2.1
+property_blueprints:
+- name: apps_domain
+  type: wildcard_domain
+  configurable: true
+- name: limits
+  type: collection
+  default:
+    memory: 1024
+`
+
+func buildTile(files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for name, contents := range files {
+		f, err := w.Create(name)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = f.Write([]byte(contents))
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Expect(w.Close()).To(Succeed())
+
+	return buf.Bytes()
+}
+
+var _ = Describe("Tile", func() {
+	Describe("Read", func() {
+		It("returns the metadata from metadata/*.yml", func() {
+			b := buildTile(map[string]string{
+				"releases/cf-networking-1.11.0.tgz": "not really a release",
+				"metadata/cf.yml":                   metadataYAML,
+				"migrations/v1/201712011200_foo.js": "",
+			})
+
+			metadata, err := tile.Read(bytes.NewReader(b), int64(len(b)))
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(metadata.Name).To(Equal("cf"))
+			Expect(metadata.ProductVersion).To(Equal("2.1.0"))
+			Expect(metadata.MinimumVersionForUpgrade).To(Equal("2.0.0-build.1"))
+			Expect(metadata.StemcellCriteria).To(Equal(tile.StemcellCriteria{
+				OS:                         "ubuntu-trusty",
+				Version:                    "3541",
+				EnablePatchSecurityUpdates: true,
+			}))
+			Expect(metadata.Releases).To(Equal([]tile.Release{
+				{Name: "cf-networking", File: "cf-networking-1.11.0.tgz", Version: "1.11.0"},
+			}))
+			Expect(metadata.RequiresProductVersions).To(Equal([]tile.ProductVersion{
+				{Name: "p-bosh", Version: "~> 2.1"},
+			}))
+			Expect(metadata.PropertyBlueprints).To(HaveLen(2))
+			Expect(metadata.PropertyBlueprints[1].Default).To(Equal(map[string]interface{}{
+				"memory": 1024,
+			}))
+		})
+
+		Context("when the tile has no metadata file", func() {
+			It("returns ErrMetadataNotFound", func() {
+				b := buildTile(map[string]string{
+					"releases/foo.tgz":        "",
+					"metadata/nested/bar.yml": metadataYAML,
+				})
+
+				_, err := tile.Read(bytes.NewReader(b), int64(len(b)))
+				Expect(err).To(Equal(tile.ErrMetadataNotFound))
+			})
+		})
+
+		Context("when the file is not a zip", func() {
+			It("returns an error", func() {
+				b := []byte("definitely not a zip")
+
+				_, err := tile.Read(bytes.NewReader(b), int64(len(b)))
+				Expect(err).To(MatchError(ContainSubstring("failed to open tile as zip")))
+			})
+		})
+
+		Context("when the metadata is not valid YAML", func() {
+			It("returns an error", func() {
+				b := buildTile(map[string]string{
+					"metadata/cf.yml": "name: [",
+				})
+
+				_, err := tile.Read(bytes.NewReader(b), int64(len(b)))
+				Expect(err).To(MatchError(ContainSubstring("failed to parse tile metadata")))
+			})
+		})
+	})
+
+	Describe("ReadFile", func() {
+		var path string
+
+		BeforeEach(func() {
+			f, err := ioutil.TempFile("", "tile")
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = f.Write(buildTile(map[string]string{"metadata/cf.yml": metadataYAML}))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+
+			path = f.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("reads the metadata of a tile on disk", func() {
+			metadata, err := tile.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(metadata.ProductVersion).To(Equal("2.1.0"))
+		})
+
+		Context("when the file does not exist", func() {
+			It("returns an error", func() {
+				_, err := tile.ReadFile(path + "-missing")
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+})
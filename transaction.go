@@ -0,0 +1,394 @@
+package pivnet
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pivotal-cf/go-pivnet/logger"
+)
+
+// Transaction publishes a release through changes that can be undone. It
+// records each change it makes, and Rollback undoes them in reverse order,
+// so that a publication that fails midway leaves nothing behind.
+//
+// Attachments are undone by removing them. Attaching something that is
+// already attached is not recorded, so rolling back leaves it attached.
+type Transaction struct {
+	client Client
+
+	mu        sync.Mutex
+	mutations []mutation
+	finished  bool
+}
+
+type mutation struct {
+	description string
+	undo        func() error
+}
+
+// RollbackFailure is a change that could not be undone.
+type RollbackFailure struct {
+	Mutation string
+	Err      error
+}
+
+// ErrRollbackIncomplete is returned by Rollback when some changes could not
+// be undone and must be cleaned up by hand.
+type ErrRollbackIncomplete struct {
+	Failures []RollbackFailure
+}
+
+func (e ErrRollbackIncomplete) Error() string {
+	var failures []string
+	for _, f := range e.Failures {
+		failures = append(failures, fmt.Sprintf("%s: %s", f.Mutation, f.Err))
+	}
+
+	return fmt.Sprintf(
+		"failed to roll back %d changes: %s",
+		len(e.Failures),
+		strings.Join(failures, "; "),
+	)
+}
+
+var errTransactionFinished = fmt.Errorf("transaction has already been committed or rolled back")
+
+func NewTransaction(client Client) *Transaction {
+	return &Transaction{client: client}
+}
+
+// Mutations describes the changes made so far, in the order they were
+// made.
+func (t *Transaction) Mutations() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var descriptions []string
+	for _, m := range t.mutations {
+		descriptions = append(descriptions, m.description)
+	}
+
+	return descriptions
+}
+
+// Commit keeps the changes made. Rollback after Commit does nothing, so it
+// can be deferred.
+func (t *Transaction) Commit() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.finished = true
+	t.mutations = nil
+}
+
+// Rollback undoes every change in reverse order. It carries on past changes
+// that cannot be undone and returns them in an ErrRollbackIncomplete.
+func (t *Transaction) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.finished {
+		return nil
+	}
+	t.finished = true
+
+	var failures []RollbackFailure
+	for i := len(t.mutations) - 1; i >= 0; i-- {
+		m := t.mutations[i]
+
+		err := m.undo()
+		if err != nil {
+			failures = append(failures, RollbackFailure{Mutation: m.description, Err: err})
+			continue
+		}
+
+		t.client.logger.Info("Rolled back change", logger.Data{"change": m.description})
+	}
+	t.mutations = nil
+
+	if len(failures) > 0 {
+		return ErrRollbackIncomplete{Failures: failures}
+	}
+
+	return nil
+}
+
+// do makes a change unless the transaction is finished, and records how to
+// undo it if it succeeds. A change that returns no undo changed nothing and
+// is not recorded. If the transaction is finished while the change is being
+// made, the change is undone at once.
+func (t *Transaction) do(change func() (string, func() error, error)) error {
+	t.mu.Lock()
+	finished := t.finished
+	t.mu.Unlock()
+
+	if finished {
+		return errTransactionFinished
+	}
+
+	description, undo, err := change()
+	if err != nil {
+		return err
+	}
+
+	if undo == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.finished {
+		err := undo()
+		if err != nil {
+			return ErrRollbackIncomplete{Failures: []RollbackFailure{{Mutation: description, Err: err}}}
+		}
+
+		return errTransactionFinished
+	}
+
+	t.mutations = append(t.mutations, mutation{description: description, undo: undo})
+	return nil
+}
+
+func (t *Transaction) CreateRelease(config CreateReleaseConfig) (Release, error) {
+	var release Release
+	err := t.do(func() (string, func() error, error) {
+		var err error
+		release, err = t.client.Releases.Create(config)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("create release %s of %s", release.Version, config.ProductSlug)
+		return description, func() error {
+			return t.client.Releases.Delete(config.ProductSlug, release)
+		}, nil
+	})
+
+	return release, err
+}
+
+func (t *Transaction) CreateProductFile(config CreateProductFileConfig) (ProductFile, error) {
+	var productFile ProductFile
+	err := t.do(func() (string, func() error, error) {
+		var err error
+		productFile, err = t.client.ProductFiles.Create(config)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("create product file %s", productFile.AWSObjectKey)
+		return description, func() error {
+			_, err := t.client.ProductFiles.Delete(config.ProductSlug, productFile.ID)
+			return err
+		}, nil
+	})
+
+	return productFile, err
+}
+
+func (t *Transaction) AddProductFileToRelease(productSlug string, releaseID int, productFileID int) error {
+	return t.do(func() (string, func() error, error) {
+		productFiles, err := t.client.ProductFiles.ListForRelease(productSlug, releaseID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, pf := range productFiles {
+			if pf.ID == productFileID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.ProductFiles.AddToRelease(productSlug, releaseID, productFileID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add product file %d to release %d", productFileID, releaseID)
+		return description, func() error {
+			return t.client.ProductFiles.RemoveFromRelease(productSlug, releaseID, productFileID)
+		}, nil
+	})
+}
+
+func (t *Transaction) CreateFileGroup(config CreateFileGroupConfig) (FileGroup, error) {
+	var fileGroup FileGroup
+	err := t.do(func() (string, func() error, error) {
+		var err error
+		fileGroup, err = t.client.FileGroups.Create(config)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("create file group %s", fileGroup.Name)
+		return description, func() error {
+			_, err := t.client.FileGroups.Delete(config.ProductSlug, fileGroup.ID)
+			return err
+		}, nil
+	})
+
+	return fileGroup, err
+}
+
+func (t *Transaction) AddProductFileToFileGroup(productSlug string, fileGroupID int, productFileID int) error {
+	return t.do(func() (string, func() error, error) {
+		fileGroup, err := t.client.FileGroups.Get(productSlug, fileGroupID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, pf := range fileGroup.ProductFiles {
+			if pf.ID == productFileID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.ProductFiles.AddToFileGroup(productSlug, fileGroupID, productFileID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add product file %d to file group %d", productFileID, fileGroupID)
+		return description, func() error {
+			return t.client.ProductFiles.RemoveFromFileGroup(productSlug, fileGroupID, productFileID)
+		}, nil
+	})
+}
+
+func (t *Transaction) AddFileGroupToRelease(productSlug string, releaseID int, fileGroupID int) error {
+	return t.do(func() (string, func() error, error) {
+		fileGroups, err := t.client.FileGroups.ListForRelease(productSlug, releaseID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, fg := range fileGroups {
+			if fg.ID == fileGroupID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.FileGroups.AddToRelease(productSlug, releaseID, fileGroupID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add file group %d to release %d", fileGroupID, releaseID)
+		return description, func() error {
+			return t.client.FileGroups.RemoveFromRelease(productSlug, releaseID, fileGroupID)
+		}, nil
+	})
+}
+
+func (t *Transaction) AddUserGroupToRelease(productSlug string, releaseID int, userGroupID int) error {
+	return t.do(func() (string, func() error, error) {
+		userGroups, err := t.client.UserGroups.ListForRelease(productSlug, releaseID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, ug := range userGroups {
+			if ug.ID == userGroupID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.UserGroups.AddToRelease(productSlug, releaseID, userGroupID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add user group %d to release %d", userGroupID, releaseID)
+		return description, func() error {
+			return t.client.UserGroups.RemoveFromRelease(productSlug, releaseID, userGroupID)
+		}, nil
+	})
+}
+
+func (t *Transaction) AddReleaseDependency(productSlug string, releaseID int, dependentReleaseID int) error {
+	return t.do(func() (string, func() error, error) {
+		dependencies, err := t.client.ReleaseDependencies.List(productSlug, releaseID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, d := range dependencies {
+			if d.Release.ID == dependentReleaseID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.ReleaseDependencies.Add(productSlug, releaseID, dependentReleaseID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add dependency on release %d to release %d", dependentReleaseID, releaseID)
+		return description, func() error {
+			return t.client.ReleaseDependencies.Remove(productSlug, releaseID, dependentReleaseID)
+		}, nil
+	})
+}
+
+func (t *Transaction) AddReleaseUpgradePath(productSlug string, releaseID int, previousReleaseID int) error {
+	return t.do(func() (string, func() error, error) {
+		upgradePaths, err := t.client.ReleaseUpgradePaths.Get(productSlug, releaseID)
+		if err != nil {
+			return "", nil, err
+		}
+		for _, u := range upgradePaths {
+			if u.Release.ID == previousReleaseID {
+				return "", nil, nil
+			}
+		}
+
+		err = t.client.ReleaseUpgradePaths.Add(productSlug, releaseID, previousReleaseID)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("add upgrade path from release %d to release %d", previousReleaseID, releaseID)
+		return description, func() error {
+			return t.client.ReleaseUpgradePaths.Remove(productSlug, releaseID, previousReleaseID)
+		}, nil
+	})
+}
+
+func (t *Transaction) CreateDependencySpecifier(
+	productSlug string,
+	releaseID int,
+	dependentProductSlug string,
+	specifier string,
+) (DependencySpecifier, error) {
+	var dependencySpecifier DependencySpecifier
+	err := t.do(func() (string, func() error, error) {
+		var err error
+		dependencySpecifier, err = t.client.DependencySpecifiers.Create(productSlug, releaseID, dependentProductSlug, specifier)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("create dependency specifier %s %s for release %d", dependentProductSlug, specifier, releaseID)
+		return description, func() error {
+			return t.client.DependencySpecifiers.Delete(productSlug, releaseID, dependencySpecifier.ID)
+		}, nil
+	})
+
+	return dependencySpecifier, err
+}
+
+func (t *Transaction) CreateUpgradePathSpecifier(productSlug string, releaseID int, specifier string) (UpgradePathSpecifier, error) {
+	var upgradePathSpecifier UpgradePathSpecifier
+	err := t.do(func() (string, func() error, error) {
+		var err error
+		upgradePathSpecifier, err = t.client.UpgradePathSpecifiers.Create(productSlug, releaseID, specifier)
+		if err != nil {
+			return "", nil, err
+		}
+
+		description := fmt.Sprintf("create upgrade path specifier %s for release %d", specifier, releaseID)
+		return description, func() error {
+			return t.client.UpgradePathSpecifiers.Delete(productSlug, releaseID, upgradePathSpecifier.ID)
+		}, nil
+	})
+
+	return upgradePathSpecifier, err
+}
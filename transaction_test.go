@@ -0,0 +1,277 @@
+package pivnet_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transaction", func() {
+	var (
+		server *pivnettest.Server
+		client pivnet.Client
+		tx     *pivnet.Transaction
+
+		previous   pivnet.Release
+		dependency pivnet.Release
+		userGroup  pivnet.UserGroup
+	)
+
+	BeforeEach(func() {
+		server = pivnettest.NewServer()
+		client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+		tx = pivnet.NewTransaction(client)
+
+		server.AddEULA(pivnet.EULA{Slug: "banana-eula"})
+		previous = server.AddRelease("banana", pivnet.Release{Version: "1.2.2"})
+		dependency = server.AddRelease("apple", pivnet.Release{Version: "2.0.0"})
+		userGroup = server.AddUserGroup(pivnet.UserGroup{Name: "Beta Testers"})
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	// publish builds a release with everything attached, failing with the
+	// first error.
+	publish := func() (pivnet.Release, error) {
+		release, err := tx.CreateRelease(pivnet.CreateReleaseConfig{
+			ProductSlug: "banana",
+			Version:     "1.2.3",
+			EULASlug:    "banana-eula",
+		})
+		if err != nil {
+			return pivnet.Release{}, err
+		}
+
+		fileGroup, err := tx.CreateFileGroup(pivnet.CreateFileGroupConfig{ProductSlug: "banana", Name: "Stemcells"})
+		if err != nil {
+			return release, err
+		}
+
+		for _, key := range []string{"tile.pivotal", "stemcell.tgz", "docs.pdf"} {
+			pf, err := tx.CreateProductFile(pivnet.CreateProductFileConfig{ProductSlug: "banana", AWSObjectKey: key})
+			if err != nil {
+				return release, err
+			}
+
+			if key == "stemcell.tgz" {
+				err = tx.AddProductFileToFileGroup("banana", fileGroup.ID, pf.ID)
+			} else {
+				err = tx.AddProductFileToRelease("banana", release.ID, pf.ID)
+			}
+			if err != nil {
+				return release, err
+			}
+		}
+
+		steps := []func() error{
+			func() error { return tx.AddFileGroupToRelease("banana", release.ID, fileGroup.ID) },
+			func() error { return tx.AddUserGroupToRelease("banana", release.ID, userGroup.ID) },
+			func() error { return tx.AddReleaseDependency("banana", release.ID, dependency.ID) },
+			func() error { return tx.AddReleaseUpgradePath("banana", release.ID, previous.ID) },
+			func() error {
+				_, err := tx.CreateDependencySpecifier("banana", release.ID, "apple", "2.0.*")
+				return err
+			},
+			func() error {
+				_, err := tx.CreateUpgradePathSpecifier("banana", release.ID, "1.1.*")
+				return err
+			},
+		}
+		for _, step := range steps {
+			err := step()
+			if err != nil {
+				return release, err
+			}
+		}
+
+		return release, nil
+	}
+
+	expectNothingLeft := func() {
+		releases, err := client.Releases.List("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(releases).To(HaveLen(1))
+		Expect(releases[0].ID).To(Equal(previous.ID))
+
+		productFiles, err := client.ProductFiles.List("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(BeEmpty())
+
+		fileGroups, err := client.FileGroups.List("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileGroups).To(BeEmpty())
+	}
+
+	It("records each change", func() {
+		release, err := publish()
+		Expect(err).NotTo(HaveOccurred())
+
+		mutations := tx.Mutations()
+		Expect(mutations).To(HaveLen(14))
+		Expect(mutations[0]).To(Equal("create release 1.2.3 of banana"))
+		Expect(mutations[2]).To(Equal("create product file tile.pivotal"))
+		Expect(mutations[len(mutations)-1]).To(Equal(fmt.Sprintf("create upgrade path specifier 1.1.* for release %d", release.ID)))
+	})
+
+	It("keeps the changes once committed", func() {
+		release, err := publish()
+		Expect(err).NotTo(HaveOccurred())
+
+		tx.Commit()
+		Expect(tx.Rollback()).To(Succeed())
+
+		_, err = client.Releases.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+
+		productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(2))
+	})
+
+	It("undoes every change when rolled back", func() {
+		_, err := publish()
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(tx.Rollback()).To(Succeed())
+		expectNothingLeft()
+
+		Expect(tx.Mutations()).To(BeEmpty())
+	})
+
+	It("undoes a publication that fails midway", func() {
+		release, err := tx.CreateRelease(pivnet.CreateReleaseConfig{ProductSlug: "banana", Version: "1.2.3"})
+		Expect(err).NotTo(HaveOccurred())
+
+		var productFiles []pivnet.ProductFile
+		for _, key := range []string{"tile.pivotal", "stemcell.tgz", "docs.pdf"} {
+			pf, err := tx.CreateProductFile(pivnet.CreateProductFileConfig{ProductSlug: "banana", AWSObjectKey: key})
+			Expect(err).NotTo(HaveOccurred())
+			productFiles = append(productFiles, pf)
+		}
+
+		Expect(tx.AddProductFileToRelease("banana", release.ID, productFiles[0].ID)).To(Succeed())
+		Expect(tx.AddProductFileToRelease("banana", release.ID, productFiles[1].ID)).To(Succeed())
+
+		server.Fail("PATCH", fmt.Sprintf("/products/banana/releases/%d/add_product_file", release.ID), http.StatusInternalServerError, 1)
+
+		err = tx.AddProductFileToRelease("banana", release.ID, productFiles[2].ID)
+		Expect(err).To(HaveOccurred())
+		Expect(tx.Mutations()).To(HaveLen(6))
+
+		Expect(tx.Rollback()).To(Succeed())
+		expectNothingLeft()
+	})
+
+	It("reports changes that could not be undone, and undoes the rest", func() {
+		release, err := publish()
+		Expect(err).NotTo(HaveOccurred())
+
+		productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		tile := productFiles[0]
+
+		server.Fail("DELETE", fmt.Sprintf("/products/banana/product_files/%d", tile.ID), http.StatusInternalServerError, 1)
+
+		err = tx.Rollback()
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrRollbackIncomplete{}))
+
+		failures := err.(pivnet.ErrRollbackIncomplete).Failures
+		Expect(failures).To(HaveLen(1))
+		Expect(failures[0].Mutation).To(Equal("create product file tile.pivotal"))
+		Expect(failures[0].Err).To(HaveOccurred())
+		Expect(err.Error()).To(HavePrefix("failed to roll back 1 changes: create product file tile.pivotal: "))
+
+		_, err = client.Releases.Get("banana", release.ID)
+		Expect(err).To(BeAssignableToTypeOf(pivnet.ErrNotFound{}))
+
+		remaining, err := client.ProductFiles.List("banana")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(remaining).To(HaveLen(1))
+		Expect(remaining[0].ID).To(Equal(tile.ID))
+	})
+
+	It("leaves what was already attached in place when rolled back", func() {
+		release := server.AddRelease("banana", pivnet.Release{Version: "1.2.3"})
+		tile := server.AddProductFile("banana", release.ID, pivnet.ProductFile{AWSObjectKey: "tile.pivotal"}, []byte("tile"))
+		stemcell := server.AddProductFile("banana", previous.ID, pivnet.ProductFile{AWSObjectKey: "stemcell.tgz"}, []byte("stemcell"))
+		fileGroup := server.AddFileGroup("banana", release.ID, "Stemcells", stemcell.ID)
+		server.AddDependency("banana", release.ID, pivnet.DependentRelease{ID: dependency.ID, Version: dependency.Version, Product: pivnet.Product{Slug: "apple"}})
+		server.AddUpgradePath("banana", release.ID, pivnet.UpgradePathRelease{ID: previous.ID, Version: previous.Version})
+		Expect(client.UserGroups.AddToRelease("banana", release.ID, userGroup.ID)).To(Succeed())
+
+		Expect(tx.AddProductFileToRelease("banana", release.ID, tile.ID)).To(Succeed())
+		Expect(tx.AddProductFileToFileGroup("banana", fileGroup.ID, stemcell.ID)).To(Succeed())
+		Expect(tx.AddFileGroupToRelease("banana", release.ID, fileGroup.ID)).To(Succeed())
+		Expect(tx.AddUserGroupToRelease("banana", release.ID, userGroup.ID)).To(Succeed())
+		Expect(tx.AddReleaseDependency("banana", release.ID, dependency.ID)).To(Succeed())
+		Expect(tx.AddReleaseUpgradePath("banana", release.ID, previous.ID)).To(Succeed())
+		Expect(tx.Mutations()).To(BeEmpty())
+
+		Expect(tx.Rollback()).To(Succeed())
+
+		productFiles, err := client.ProductFiles.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(productFiles).To(HaveLen(1))
+
+		fileGroups, err := client.FileGroups.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fileGroups).To(HaveLen(1))
+		Expect(fileGroups[0].ProductFiles).To(HaveLen(1))
+
+		userGroups, err := client.UserGroups.ListForRelease("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(userGroups).To(HaveLen(1))
+
+		dependencies, err := client.ReleaseDependencies.List("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dependencies).To(HaveLen(1))
+
+		upgradePaths, err := client.ReleaseUpgradePaths.Get("banana", release.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upgradePaths).To(HaveLen(1))
+	})
+
+	It("undoes a change made while the transaction was rolled back", func() {
+		target, err := url.Parse(server.URL)
+		Expect(err).NotTo(HaveOccurred())
+
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		rollingBack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+
+			if req.Method == "POST" {
+				Expect(tx.Rollback()).To(Succeed())
+			}
+			proxy.ServeHTTP(w, req)
+		}))
+		defer rollingBack.Close()
+
+		config := server.ClientConfig()
+		config.Host = rollingBack.URL
+		tx = pivnet.NewTransaction(pivnet.NewClient(config, &loggerfakes.FakeLogger{}))
+
+		_, err = tx.CreateRelease(pivnet.CreateReleaseConfig{ProductSlug: "banana", Version: "1.2.3"})
+		Expect(err).To(MatchError("transaction has already been committed or rolled back"))
+		Expect(tx.Mutations()).To(BeEmpty())
+
+		expectNothingLeft()
+	})
+
+	It("refuses changes once finished", func() {
+		Expect(tx.Rollback()).To(Succeed())
+
+		_, err := tx.CreateRelease(pivnet.CreateReleaseConfig{ProductSlug: "banana", Version: "1.2.3"})
+		Expect(err).To(MatchError("transaction has already been committed or rolled back"))
+	})
+})
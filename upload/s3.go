@@ -0,0 +1,221 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrS3 is returned when an S3 request fails.
+type ErrS3 struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e ErrS3) Error() string {
+	return fmt.Sprintf("s3 error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// s3Client makes the multipart upload requests of the S3 API, addressing
+// buckets by path so that it works with S3-compatible stores.
+type s3Client struct {
+	endpoint *url.URL
+	bucket   string
+	region   string
+	creds    credentials
+	http     *http.Client
+	now      func() time.Time
+}
+
+type part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+	Size   int64  `xml:"Size,omitempty"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type listPartsResult struct {
+	IsTruncated          bool   `xml:"IsTruncated"`
+	NextPartNumberMarker int    `xml:"NextPartNumberMarker"`
+	Parts                []part `xml:"Part"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name `xml:"CompleteMultipartUpload"`
+	Parts   []part   `xml:"Part"`
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (c *s3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	var result initiateMultipartUploadResult
+
+	err := c.do(ctx, "POST", key, url.Values{"uploads": {""}}, nil, nil, &result)
+	if err != nil {
+		return "", err
+	}
+
+	if result.UploadID == "" {
+		return "", fmt.Errorf("s3 did not return an upload ID")
+	}
+
+	return result.UploadID, nil
+}
+
+// uploadPart uploads one part and returns its ETag.
+func (c *s3Client) uploadPart(ctx context.Context, key string, uploadID string, number int, data []byte) (string, error) {
+	sum := md5.Sum(data)
+
+	query := url.Values{
+		"partNumber": {strconv.Itoa(number)},
+		"uploadId":   {uploadID},
+	}
+	headers := http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+
+	resp, err := c.request(ctx, "PUT", key, query, data, headers)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("s3 did not return an ETag for part %d", number)
+	}
+
+	return etag, nil
+}
+
+func (c *s3Client) listParts(ctx context.Context, key string, uploadID string) ([]part, error) {
+	var parts []part
+
+	marker := 0
+	for {
+		query := url.Values{"uploadId": {uploadID}}
+		if marker > 0 {
+			query.Set("part-number-marker", strconv.Itoa(marker))
+		}
+
+		var result listPartsResult
+		err := c.do(ctx, "GET", key, query, nil, nil, &result)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, result.Parts...)
+
+		if !result.IsTruncated || result.NextPartNumberMarker <= marker {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (c *s3Client) completeMultipartUpload(ctx context.Context, key string, uploadID string, parts []part) error {
+	body := completeMultipartUpload{}
+	for _, p := range parts {
+		body.Parts = append(body.Parts, part{Number: p.Number, ETag: p.ETag})
+	}
+
+	b, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	// S3 may report a failure to complete in the body of a 200 response.
+	var result s3Error
+	err = c.do(ctx, "POST", key, url.Values{"uploadId": {uploadID}}, b, http.Header{"Content-Type": {"application/xml"}}, &result)
+	if err != nil {
+		return err
+	}
+
+	if result.Code != "" {
+		return ErrS3{StatusCode: http.StatusOK, Code: result.Code, Message: result.Message}
+	}
+
+	return nil
+}
+
+func (c *s3Client) abortMultipartUpload(ctx context.Context, key string, uploadID string) error {
+	return c.do(ctx, "DELETE", key, url.Values{"uploadId": {uploadID}}, nil, nil, nil)
+}
+
+// do makes a request and decodes an XML response into result, if set.
+func (c *s3Client) do(ctx context.Context, method string, key string, query url.Values, body []byte, headers http.Header, result interface{}) error {
+	resp, err := c.request(ctx, method, key, query, body, headers)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	err = xml.Unmarshal(b, result)
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("invalid s3 response: %s", err)
+	}
+
+	return nil
+}
+
+// request makes a signed request, returning an ErrS3 for responses other
+// than 2xx.
+func (c *s3Client) request(ctx context.Context, method string, key string, query url.Values, body []byte, headers http.Header) (*http.Response, error) {
+	u := *c.endpoint
+	u.Path = strings.TrimSuffix(c.endpoint.Path, "/") + "/" + c.bucket + "/" + key
+	u.RawPath = strings.TrimSuffix(c.endpoint.EscapedPath(), "/") + "/" + awsEscape(c.bucket, true) + "/" + awsEscape(key, false)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	signRequest(req, hashHex(body), c.creds, c.region, "s3", c.now())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+
+		var e s3Error
+		b, _ := ioutil.ReadAll(resp.Body)
+		xml.Unmarshal(b, &e)
+
+		return nil, ErrS3{StatusCode: resp.StatusCode, Code: e.Code, Message: e.Message}
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,373 @@
+// Package s3test provides an in-memory stand-in for an S3-compatible store,
+// such as MinIO, supporting the requests made by the upload package.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccessKeyID     = "s3test-access-key"
+	SecretAccessKey = "s3test-secret-key"
+)
+
+type upload struct {
+	bucket string
+	key    string
+	parts  map[int][]byte
+}
+
+// Server is a fake S3-compatible store. Requests must carry a signature
+// header for AccessKeyID and a payload hash matching their body, but
+// signatures themselves are not checked.
+type Server struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	nextID      int
+	buckets     map[string]bool
+	objects     map[string][]byte
+	uploads     map[string]*upload
+	failParts   map[int]int
+	partUploads int
+	inFlight    int
+	maxInFlight int
+	holdParts   int
+}
+
+func NewServer(buckets ...string) *Server {
+	s := &Server{
+		buckets:   map[string]bool{},
+		objects:   map[string][]byte{},
+		uploads:   map[string]*upload{},
+		failParts: map[int]int{},
+	}
+
+	for _, b := range buckets {
+		s.buckets[b] = true
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// Object returns the contents of a stored object.
+func (s *Server) Object(bucket string, key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.objects[bucket+"/"+key]
+	return b, ok
+}
+
+// FailPart makes the next n uploads of the given part number fail with a
+// 500.
+func (s *Server) FailPart(number int, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failParts[number] = n
+}
+
+// HoldParts makes part uploads wait, for up to five seconds, until n of
+// them are in progress at once.
+func (s *Server) HoldParts(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.holdParts = n
+}
+
+// PartUploads returns how many part uploads succeeded.
+func (s *Server) PartUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.partUploads
+}
+
+// MaxConcurrentParts returns the largest number of part uploads that were
+// in progress at once.
+func (s *Server) MaxConcurrentParts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxInFlight
+}
+
+// Uploads returns how many multipart uploads are neither completed nor
+// aborted.
+func (s *Server) Uploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.uploads)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+AccessKeyID+"/") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing or unknown credentials")
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	if req.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		writeError(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch", "payload hash does not match body")
+		return
+	}
+
+	path := strings.TrimPrefix(req.URL.Path, "/")
+	i := strings.Index(path, "/")
+	if i < 0 {
+		writeError(w, http.StatusBadRequest, "InvalidRequest", "bucket operations are not supported")
+		return
+	}
+	bucket, key := path[:i], path[i+1:]
+
+	query := req.URL.Query()
+	_, initiate := query["uploads"]
+	uploadID := query.Get("uploadId")
+
+	if req.Method == "PUT" && uploadID != "" {
+		s.uploadPart(w, req, bucket, key, uploadID, body)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.buckets[bucket] {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "bucket does not exist")
+		return
+	}
+
+	switch {
+	case req.Method == "POST" && initiate:
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = &upload{bucket: bucket, key: key, parts: map[int][]byte{}}
+
+		writeXML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadID string `xml:"UploadId"`
+		}{Bucket: bucket, Key: key, UploadID: id})
+	case req.Method == "GET" && uploadID != "":
+		u, ok := s.upload(w, bucket, key, uploadID)
+		if ok {
+			s.listParts(w, u, query)
+		}
+	case req.Method == "POST" && uploadID != "":
+		u, ok := s.upload(w, bucket, key, uploadID)
+		if ok {
+			s.complete(w, u, uploadID, body)
+		}
+	case req.Method == "DELETE" && uploadID != "":
+		_, ok := s.upload(w, bucket, key, uploadID)
+		if ok {
+			delete(s.uploads, uploadID)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case req.Method == "GET":
+		b, ok := s.objects[bucket+"/"+key]
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", "key does not exist")
+			return
+		}
+		w.Write(b)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "unsupported request")
+	}
+}
+
+func (s *Server) upload(w http.ResponseWriter, bucket string, key string, uploadID string) (*upload, bool) {
+	u, ok := s.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return nil, false
+	}
+
+	return u, true
+}
+
+// uploadPart stores a part. While held, it waits without the lock so that
+// other part uploads can proceed.
+func (s *Server) uploadPart(w http.ResponseWriter, req *http.Request, bucket string, key string, uploadID string, body []byte) {
+	number, err := strconv.Atoi(req.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > 10000 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid part number")
+		return
+	}
+
+	md5sum := md5.Sum(body)
+	if req.Header.Get("Content-Md5") != base64.StdEncoding.EncodeToString(md5sum[:]) {
+		writeError(w, http.StatusBadRequest, "BadDigest", "Content-MD5 does not match body")
+		return
+	}
+
+	s.mu.Lock()
+	u, ok := s.uploads[uploadID]
+	if !ok || u.bucket != bucket || u.key != key {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "upload does not exist")
+		return
+	}
+	if s.failParts[number] > 0 {
+		s.failParts[number]--
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, "InternalError", "injected failure")
+		return
+	}
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		if s.maxInFlight >= s.holdParts || time.Now().After(deadline) {
+			break
+		}
+		s.mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+	}
+	defer s.mu.Unlock()
+
+	s.inFlight--
+	s.partUploads++
+	u.parts[number] = body
+
+	w.Header().Set("ETag", etag(body))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listParts(w http.ResponseWriter, u *upload, query map[string][]string) {
+	type part struct {
+		PartNumber int
+		ETag       string
+		Size       int
+	}
+
+	marker := 0
+	if m, ok := query["part-number-marker"]; ok {
+		marker, _ = strconv.Atoi(m[0])
+	}
+
+	var numbers []int
+	for n := range u.parts {
+		if n > marker {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+
+	// Pages are kept small to exercise pagination.
+	const pageSize = 2
+	result := struct {
+		XMLName              xml.Name `xml:"ListPartsResult"`
+		IsTruncated          bool
+		NextPartNumberMarker int
+		Parts                []part `xml:"Part"`
+	}{}
+
+	for i, n := range numbers {
+		if i == pageSize {
+			result.IsTruncated = true
+			break
+		}
+		result.Parts = append(result.Parts, part{PartNumber: n, ETag: etag(u.parts[n]), Size: len(u.parts[n])})
+		result.NextPartNumberMarker = n
+	}
+
+	writeXML(w, result)
+}
+
+func (s *Server) complete(w http.ResponseWriter, u *upload, uploadID string, body []byte) {
+	var request struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+
+	err := xml.Unmarshal(body, &request)
+	if err != nil || len(request.Parts) == 0 {
+		writeError(w, http.StatusBadRequest, "MalformedXML", "invalid part list")
+		return
+	}
+
+	var object bytes.Buffer
+	for i, p := range request.Parts {
+		data, ok := u.parts[p.PartNumber]
+		if !ok || etag(data) != p.ETag {
+			writeError(w, http.StatusBadRequest, "InvalidPart", fmt.Sprintf("part %d not found", p.PartNumber))
+			return
+		}
+		if i > 0 && p.PartNumber <= request.Parts[i-1].PartNumber {
+			writeError(w, http.StatusBadRequest, "InvalidPartOrder", "parts must be in ascending order")
+			return
+		}
+		if i < len(request.Parts)-1 && len(data) < 5<<20 {
+			writeError(w, http.StatusBadRequest, "EntityTooSmall", fmt.Sprintf("part %d is too small", p.PartNumber))
+			return
+		}
+		object.Write(data)
+	}
+
+	s.objects[u.bucket+"/"+u.key] = object.Bytes()
+	delete(s.uploads, uploadID)
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Bucket  string
+		Key     string
+	}{Bucket: u.bucket, Key: u.key})
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(statusCode)
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+}
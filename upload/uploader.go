@@ -0,0 +1,433 @@
+// Package upload puts product files into S3-compatible storage and
+// registers them with Pivotal Network.
+package upload
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// MinPartSize is the smallest part size S3 accepts for every part but
+	// the last.
+	MinPartSize = 5 << 20
+
+	// MaxParts is the largest number of parts in a multipart upload.
+	MaxParts = 10000
+
+	DefaultPartSize    = 64 << 20
+	DefaultConcurrency = 4
+	DefaultRegion      = "us-east-1"
+
+	partAttempts = 3
+)
+
+type Config struct {
+	// Endpoint is the URL of the S3-compatible store, such as
+	// https://s3.amazonaws.com or http://localhost:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// PartSize is the size of each uploaded part. It is raised when needed
+	// to stay within MaxParts. Defaults to DefaultPartSize.
+	PartSize int64
+
+	// Concurrency is the number of parts uploaded at once. A part is held
+	// in memory while it is uploaded. Defaults to DefaultConcurrency.
+	Concurrency int
+
+	// StateDirectory, if set, records unfinished uploads so that uploading
+	// the same file to the same key again resumes them. Without it a
+	// failed upload is aborted.
+	StateDirectory string
+
+	HTTPClient *http.Client
+}
+
+type Result struct {
+	Key    string
+	Size   int64
+	SHA256 string
+	MD5    string
+
+	// PartsUploaded and PartsResumed count the parts sent by this upload
+	// and those reused from an earlier, interrupted one.
+	PartsUploaded int
+	PartsResumed  int
+}
+
+// Uploader streams local files to an S3-compatible store with multipart
+// uploads.
+type Uploader struct {
+	s3          *s3Client
+	partSize    int64
+	concurrency int
+	stateDir    string
+}
+
+func New(config Config) (*Uploader, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("upload endpoint and bucket must be set")
+	}
+
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload endpoint: %s", err)
+	}
+
+	region := config.Region
+	if region == "" {
+		region = DefaultRegion
+	}
+
+	partSize := config.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < MinPartSize {
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+
+	concurrency := config.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Uploader{
+		s3: &s3Client{
+			endpoint: endpoint,
+			bucket:   config.Bucket,
+			region:   region,
+			creds: credentials{
+				accessKeyID:     config.AccessKeyID,
+				secretAccessKey: config.SecretAccessKey,
+				sessionToken:    config.SessionToken,
+			},
+			http: httpClient,
+			now:  time.Now,
+		},
+		partSize:    partSize,
+		concurrency: concurrency,
+		stateDir:    config.StateDirectory,
+	}, nil
+}
+
+// state is the record of an unfinished upload.
+type state struct {
+	UploadID string    `json:"upload_id"`
+	Bucket   string    `json:"bucket"`
+	Key      string    `json:"key"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	PartSize int64     `json:"part_size"`
+}
+
+type job struct {
+	number int
+	data   []byte
+}
+
+// Upload streams the file at path to key. The file is read once, in order,
+// to compute its SHA256 and MD5, while its parts are uploaded in parallel.
+func (u *Uploader) Upload(ctx context.Context, path string, key string) (Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Result{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Result{}, err
+	}
+
+	size := info.Size()
+	partSize := u.partSize
+	if size > partSize*MaxParts {
+		partSize = (size + MaxParts - 1) / MaxParts
+	}
+
+	numParts := int((size + partSize - 1) / partSize)
+	if numParts == 0 {
+		numParts = 1
+	}
+
+	current := state{
+		Bucket:   u.s3.bucket,
+		Key:      key,
+		Size:     size,
+		ModTime:  info.ModTime().UTC(),
+		PartSize: partSize,
+	}
+
+	uploadID, existing, err := u.resume(ctx, path, current)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if uploadID == "" {
+		uploadID, err = u.s3.createMultipartUpload(ctx, key)
+		if err != nil {
+			return Result{}, err
+		}
+
+		current.UploadID = uploadID
+		err = u.saveState(path, current)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+
+	result := Result{Key: key, Size: size}
+	parts := make([]part, numParts)
+
+	sha256Hash := sha256.New()
+	md5Hash := md5.New()
+
+	var mu sync.Mutex
+	g, gctx := errgroup.WithContext(ctx)
+
+	jobs := make(chan job)
+	buffers := make(chan []byte, u.concurrency+1)
+	for i := 0; i < cap(buffers); i++ {
+		buffers <- nil
+	}
+
+	for i := 0; i < u.concurrency; i++ {
+		g.Go(func() error {
+			for j := range jobs {
+				etag, err := u.uploadPart(gctx, key, uploadID, j.number, j.data)
+				buffers <- j.data
+				if err != nil {
+					return err
+				}
+
+				mu.Lock()
+				parts[j.number-1] = part{Number: j.number, ETag: etag}
+				result.PartsUploaded++
+				mu.Unlock()
+			}
+			return nil
+		})
+	}
+
+	g.Go(func() error {
+		defer close(jobs)
+
+		for number := 1; number <= numParts; number++ {
+			var buf []byte
+			select {
+			case buf = <-buffers:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+
+			n := partSize
+			if remaining := size - int64(number-1)*partSize; remaining < n {
+				n = remaining
+			}
+			if int64(cap(buf)) < n {
+				buf = make([]byte, n)
+			}
+			buf = buf[:n]
+
+			_, err := io.ReadFull(f, buf)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %s", path, err)
+			}
+
+			sha256Hash.Write(buf)
+			md5Hash.Write(buf)
+
+			if etag, ok := existing[number]; ok && etag == partETag(buf) {
+				mu.Lock()
+				parts[number-1] = part{Number: number, ETag: etag}
+				result.PartsResumed++
+				mu.Unlock()
+
+				buffers <- buf
+				continue
+			}
+
+			select {
+			case jobs <- job{number: number, data: buf}:
+			case <-gctx.Done():
+				return gctx.Err()
+			}
+		}
+
+		return nil
+	})
+
+	err = g.Wait()
+	if err == nil {
+		err = u.s3.completeMultipartUpload(ctx, key, uploadID, parts)
+	}
+	if err != nil {
+		if u.stateDir == "" {
+			u.s3.abortMultipartUpload(context.Background(), key, uploadID)
+		}
+		return Result{}, err
+	}
+
+	u.removeState(path, current)
+
+	result.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+	result.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+
+	return result, nil
+}
+
+// UploadProductFile uploads the file at path and creates a product file
+// for it with the upload's key and checksums. When config.AWSObjectKey is
+// empty the file is uploaded to product-files/<product slug>/<file name>.
+func (u *Uploader) UploadProductFile(
+	ctx context.Context,
+	client pivnet.Client,
+	path string,
+	config pivnet.CreateProductFileConfig,
+) (pivnet.ProductFile, error) {
+	if config.AWSObjectKey == "" {
+		config.AWSObjectKey = fmt.Sprintf("product-files/%s/%s", config.ProductSlug, filepath.Base(path))
+	}
+
+	result, err := u.Upload(ctx, path, config.AWSObjectKey)
+	if err != nil {
+		return pivnet.ProductFile{}, err
+	}
+
+	config.SHA256 = result.SHA256
+	config.MD5 = result.MD5
+
+	return client.ProductFiles.Create(config)
+}
+
+// uploadPart uploads a part, retrying failures other than client errors.
+func (u *Uploader) uploadPart(ctx context.Context, key string, uploadID string, number int, data []byte) (string, error) {
+	var err error
+
+	for attempt := 1; attempt <= partAttempts; attempt++ {
+		var etag string
+		etag, err = u.s3.uploadPart(ctx, key, uploadID, number, data)
+		if err == nil {
+			return etag, nil
+		}
+
+		if e, ok := err.(ErrS3); ok && e.StatusCode < 500 {
+			break
+		}
+
+		select {
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	return "", fmt.Errorf("failed to upload part %d: %s", number, err)
+}
+
+// resume returns the upload ID and uploaded parts of an unfinished upload
+// of the same file to the same key, if there is one.
+func (u *Uploader) resume(ctx context.Context, path string, current state) (string, map[int]string, error) {
+	if u.stateDir == "" {
+		return "", nil, nil
+	}
+
+	b, err := ioutil.ReadFile(u.statePath(path, current))
+	if err != nil {
+		return "", nil, nil
+	}
+
+	var previous state
+	err = json.Unmarshal(b, &previous)
+	if err != nil || previous.UploadID == "" {
+		return "", nil, nil
+	}
+
+	uploadID := previous.UploadID
+	previous.UploadID = ""
+	if previous != current {
+		u.s3.abortMultipartUpload(ctx, previous.Key, uploadID)
+		return "", nil, nil
+	}
+
+	parts, err := u.s3.listParts(ctx, current.Key, uploadID)
+	if e, ok := err.(ErrS3); ok && e.StatusCode == http.StatusNotFound {
+		return "", nil, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	existing := map[int]string{}
+	for _, p := range parts {
+		existing[p.Number] = p.ETag
+	}
+
+	return uploadID, existing, nil
+}
+
+func (u *Uploader) statePath(path string, s state) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+
+	return filepath.Join(u.stateDir, hashHex([]byte(s.Bucket+"\n"+s.Key+"\n"+abs))+".json")
+}
+
+func (u *Uploader) saveState(path string, s state) error {
+	if u.stateDir == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(u.stateDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(u.statePath(path, s), b, 0644)
+}
+
+func (u *Uploader) removeState(path string, s state) {
+	if u.stateDir != "" {
+		os.Remove(u.statePath(path, s))
+	}
+}
+
+// partETag returns the ETag S3 gives a part with the given contents.
+func partETag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
@@ -0,0 +1,237 @@
+package upload_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+	"github.com/pivotal-cf/go-pivnet/upload"
+	"github.com/pivotal-cf/go-pivnet/upload/s3test"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Uploader", func() {
+	var (
+		s3     *s3test.Server
+		dir    string
+		path   string
+		data   []byte
+		config upload.Config
+	)
+
+	BeforeEach(func() {
+		s3 = s3test.NewServer("pivnet-uploads")
+
+		var err error
+		dir, err = ioutil.TempDir("", "upload")
+		Expect(err).NotTo(HaveOccurred())
+
+		data = make([]byte, 11<<20)
+		rand.New(rand.NewSource(1)).Read(data)
+
+		path = filepath.Join(dir, "banana.pivotal")
+		err = ioutil.WriteFile(path, data, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		config = upload.Config{
+			Endpoint:        s3.URL,
+			Bucket:          "pivnet-uploads",
+			AccessKeyID:     s3test.AccessKeyID,
+			SecretAccessKey: s3test.SecretAccessKey,
+			PartSize:        upload.MinPartSize,
+			Concurrency:     3,
+		}
+	})
+
+	AfterEach(func() {
+		s3.Close()
+		os.RemoveAll(dir)
+	})
+
+	newUploader := func() *upload.Uploader {
+		u, err := upload.New(config)
+		Expect(err).NotTo(HaveOccurred())
+		return u
+	}
+
+	It("uploads the file in parallel parts and returns its checksums", func() {
+		s3.HoldParts(3)
+
+		result, err := newUploader().Upload(context.Background(), path, "product-files/banana/banana 1.0.pivotal")
+		Expect(err).NotTo(HaveOccurred())
+
+		sha256sum := sha256.Sum256(data)
+		md5sum := md5.Sum(data)
+
+		Expect(result.Key).To(Equal("product-files/banana/banana 1.0.pivotal"))
+		Expect(result.Size).To(Equal(int64(len(data))))
+		Expect(result.SHA256).To(Equal(hex.EncodeToString(sha256sum[:])))
+		Expect(result.MD5).To(Equal(hex.EncodeToString(md5sum[:])))
+		Expect(result.PartsUploaded).To(Equal(3))
+
+		object, ok := s3.Object("pivnet-uploads", "product-files/banana/banana 1.0.pivotal")
+		Expect(ok).To(BeTrue())
+		Expect(object).To(Equal(data))
+
+		Expect(s3.MaxConcurrentParts()).To(Equal(3))
+		Expect(s3.Uploads()).To(Equal(0))
+	})
+
+	It("uploads an empty file", func() {
+		err := ioutil.WriteFile(path, nil, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		result, err := newUploader().Upload(context.Background(), path, "empty")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.SHA256).To(Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+
+		object, ok := s3.Object("pivnet-uploads", "empty")
+		Expect(ok).To(BeTrue())
+		Expect(object).To(BeEmpty())
+	})
+
+	It("retries failed parts", func() {
+		s3.FailPart(2, 2)
+
+		_, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+		Expect(err).NotTo(HaveOccurred())
+
+		object, _ := s3.Object("pivnet-uploads", "banana.pivotal")
+		Expect(object).To(Equal(data))
+	})
+
+	It("rejects part sizes below the minimum", func() {
+		config.PartSize = upload.MinPartSize - 1
+
+		_, err := upload.New(config)
+		Expect(err).To(HaveOccurred())
+	})
+
+	Context("when the upload fails", func() {
+		BeforeEach(func() {
+			config.Concurrency = 1
+		})
+
+		It("aborts it", func() {
+			s3.FailPart(2, 100)
+
+			_, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+			Expect(err).To(HaveOccurred())
+
+			Expect(s3.Uploads()).To(Equal(0))
+		})
+
+		Context("when a state directory is set", func() {
+			BeforeEach(func() {
+				config.StateDirectory = filepath.Join(dir, "state")
+			})
+
+			It("resumes it, skipping the parts already uploaded", func() {
+				s3.FailPart(2, 100)
+
+				_, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+				Expect(err).To(HaveOccurred())
+				Expect(s3.Uploads()).To(Equal(1))
+				Expect(s3.PartUploads()).To(Equal(1))
+
+				s3.FailPart(2, 0)
+
+				result, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.PartsResumed).To(Equal(1))
+				Expect(result.PartsUploaded).To(Equal(2))
+
+				object, _ := s3.Object("pivnet-uploads", "banana.pivotal")
+				Expect(object).To(Equal(data))
+
+				Expect(s3.Uploads()).To(Equal(0))
+				states, err := ioutil.ReadDir(filepath.Join(dir, "state"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(states).To(BeEmpty())
+			})
+
+			It("starts over when the file has changed", func() {
+				s3.FailPart(2, 100)
+
+				_, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+				Expect(err).To(HaveOccurred())
+
+				s3.FailPart(2, 0)
+				data[0] ^= 0xff
+				err = ioutil.WriteFile(path, data[:10<<20], 0644)
+				Expect(err).NotTo(HaveOccurred())
+
+				result, err := newUploader().Upload(context.Background(), path, "banana.pivotal")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(result.PartsResumed).To(Equal(0))
+
+				object, _ := s3.Object("pivnet-uploads", "banana.pivotal")
+				Expect(object).To(Equal(data[:10<<20]))
+				Expect(s3.Uploads()).To(Equal(0))
+			})
+		})
+	})
+
+	Describe("UploadProductFile", func() {
+		var (
+			server *pivnettest.Server
+			client pivnet.Client
+		)
+
+		BeforeEach(func() {
+			server = pivnettest.NewServer()
+			client = pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("uploads the file and creates a product file with its key and checksums", func() {
+			pf, err := newUploader().UploadProductFile(context.Background(), client, path, pivnet.CreateProductFileConfig{
+				ProductSlug: "banana",
+				Name:        "Banana Tile",
+				FileType:    pivnet.FileTypeSoftware,
+				FileVersion: "1.0",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			sha256sum := sha256.Sum256(data)
+
+			Expect(pf.ID).NotTo(BeZero())
+			Expect(pf.AWSObjectKey).To(Equal("product-files/banana/banana.pivotal"))
+			Expect(pf.SHA256).To(Equal(hex.EncodeToString(sha256sum[:])))
+			Expect(pf.Name).To(Equal("Banana Tile"))
+
+			fetched, err := client.ProductFiles.Get("banana", pf.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetched).To(Equal(pf))
+
+			object, ok := s3.Object("pivnet-uploads", "product-files/banana/banana.pivotal")
+			Expect(ok).To(BeTrue())
+			Expect(object).To(Equal(data))
+		})
+
+		It("does not create a product file when the upload fails", func() {
+			config.Bucket = "missing"
+
+			_, err := newUploader().UploadProductFile(context.Background(), client, path, pivnet.CreateProductFileConfig{
+				ProductSlug: "banana",
+			})
+			Expect(err).To(HaveOccurred())
+
+			_, err = client.ProductFiles.Get("banana", 1)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
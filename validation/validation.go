@@ -0,0 +1,228 @@
+// Package validation checks release and product file configs before they
+// are sent to Pivotal Network, reporting every problem at once rather than
+// the first one the server rejects.
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pivotal-cf/go-pivnet"
+)
+
+// DateFormat is the format of release dates and end of support,
+// guidance and availability dates.
+const DateFormat = "2006-01-02"
+
+var (
+	sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	md5Pattern    = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+	fileTypes = []string{
+		pivnet.FileTypeSoftware,
+		pivnet.FileTypeDocumentation,
+		pivnet.FileTypeOpenSourceLicense,
+	}
+)
+
+// Problem is one thing wrong with a config.
+type Problem struct {
+	// Field is the name of the config field at fault.
+	Field   string
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s %s", p.Field, p.Message)
+}
+
+// ErrInvalid is returned for a config with problems.
+type ErrInvalid struct {
+	// Kind is what was validated, such as "release".
+	Kind     string
+	Problems []Problem
+}
+
+func (e ErrInvalid) Error() string {
+	var problems []string
+	for _, p := range e.Problems {
+		problems = append(problems, p.String())
+	}
+
+	return fmt.Sprintf("invalid %s: %s", e.Kind, strings.Join(problems, "; "))
+}
+
+// Validator checks configs. The zero Validator checks them on their own;
+// one returned by New also checks release types and EULA slugs against
+// those Pivotal Network knows.
+type Validator struct {
+	// ReleaseTypes and EULASlugs, when set, are the values accepted for
+	// a release's type and EULA.
+	ReleaseTypes []string
+	EULASlugs    []string
+}
+
+// New returns a Validator that accepts the release types and EULAs listed
+// by Pivotal Network.
+func New(client pivnet.Client) (Validator, error) {
+	releaseTypes, err := client.ReleaseTypes.Get()
+	if err != nil {
+		return Validator{}, err
+	}
+
+	eulas, err := client.EULA.List()
+	if err != nil {
+		return Validator{}, err
+	}
+
+	var v Validator
+	for _, t := range releaseTypes {
+		v.ReleaseTypes = append(v.ReleaseTypes, string(t))
+	}
+	for _, e := range eulas {
+		v.EULASlugs = append(v.EULASlugs, e.Slug)
+	}
+
+	return v, nil
+}
+
+// problems collects the problems found in a config.
+type problems []Problem
+
+func (ps *problems) add(field string, format string, args ...interface{}) {
+	*ps = append(*ps, Problem{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (ps *problems) required(field string, value string) bool {
+	if value == "" {
+		ps.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (ps *problems) oneOf(field string, value string, allowed []string) {
+	if len(allowed) > 0 && !contains(allowed, value) {
+		ps.add(field, "%q is not one of %s", value, strings.Join(allowed, ", "))
+	}
+}
+
+// date parses an optional date, returning the zero time if it is empty or
+// malformed.
+func (ps *problems) date(field string, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(DateFormat, value)
+	if err != nil {
+		ps.add(field, "%q is not a date like %s", value, DateFormat)
+		return time.Time{}
+	}
+
+	return t
+}
+
+func (ps *problems) url(field string, value string) {
+	if value == "" {
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		ps.add(field, "%q is not an http or https URL", value)
+	}
+}
+
+func (ps problems) err(kind string) error {
+	if len(ps) == 0 {
+		return nil
+	}
+
+	return ErrInvalid{Kind: kind, Problems: ps}
+}
+
+type datedField struct {
+	field string
+	date  time.Time
+}
+
+// Release checks a config for ReleasesService.Create. An empty release
+// date is allowed, as Create defaults it to today. The release date and
+// the end of support, guidance and availability dates that are set must
+// come in that order.
+func (v Validator) Release(config pivnet.CreateReleaseConfig) error {
+	var ps problems
+
+	ps.required("ProductSlug", config.ProductSlug)
+	ps.required("Version", config.Version)
+
+	if ps.required("ReleaseType", config.ReleaseType) {
+		ps.oneOf("ReleaseType", config.ReleaseType, v.ReleaseTypes)
+	}
+	if ps.required("EULASlug", config.EULASlug) {
+		ps.oneOf("EULASlug", config.EULASlug, v.EULASlugs)
+	}
+
+	ps.url("ReleaseNotesURL", config.ReleaseNotesURL)
+
+	dates := []datedField{
+		{"ReleaseDate", ps.date("ReleaseDate", config.ReleaseDate)},
+		{"EndOfSupportDate", ps.date("EndOfSupportDate", config.EndOfSupportDate)},
+		{"EndOfGuidanceDate", ps.date("EndOfGuidanceDate", config.EndOfGuidanceDate)},
+		{"EndOfAvailabilityDate", ps.date("EndOfAvailabilityDate", config.EndOfAvailabilityDate)},
+	}
+
+	var previous *datedField
+	for i := range dates {
+		d := &dates[i]
+		if d.date.IsZero() {
+			continue
+		}
+
+		if previous != nil && d.date.Before(previous.date) {
+			ps.add(d.field, "is before %s", previous.field)
+		}
+		previous = d
+	}
+
+	return ps.err("release")
+}
+
+// ProductFile checks a config for ProductFilesService.Create.
+func (v Validator) ProductFile(config pivnet.CreateProductFileConfig) error {
+	var ps problems
+
+	ps.required("ProductSlug", config.ProductSlug)
+	ps.required("AWSObjectKey", config.AWSObjectKey)
+	ps.required("Name", config.Name)
+	ps.required("FileVersion", config.FileVersion)
+
+	if ps.required("FileType", config.FileType) {
+		ps.oneOf("FileType", config.FileType, fileTypes)
+	}
+
+	if config.SHA256 != "" && !sha256Pattern.MatchString(config.SHA256) {
+		ps.add("SHA256", "is not 64 hexadecimal digits")
+	}
+	if config.MD5 != "" && !md5Pattern.MatchString(config.MD5) {
+		ps.add("MD5", "is not 32 hexadecimal digits")
+	}
+
+	ps.url("DocsURL", config.DocsURL)
+	ps.date("ReleasedAt", config.ReleasedAt)
+
+	return ps.err("product file")
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
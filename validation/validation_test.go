@@ -0,0 +1,205 @@
+package validation_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-cf/go-pivnet"
+	"github.com/pivotal-cf/go-pivnet/logger/loggerfakes"
+	"github.com/pivotal-cf/go-pivnet/pivnettest"
+	"github.com/pivotal-cf/go-pivnet/validation"
+)
+
+func problems(err error) []string {
+	Expect(err).To(BeAssignableToTypeOf(validation.ErrInvalid{}))
+
+	var s []string
+	for _, p := range err.(validation.ErrInvalid).Problems {
+		s = append(s, p.String())
+	}
+	return s
+}
+
+var _ = Describe("Validator", func() {
+	var v validation.Validator
+
+	BeforeEach(func() {
+		v = validation.Validator{}
+	})
+
+	Describe("Release", func() {
+		var config pivnet.CreateReleaseConfig
+
+		BeforeEach(func() {
+			config = pivnet.CreateReleaseConfig{
+				ProductSlug:           "banana",
+				Version:               "1.2.3",
+				ReleaseType:           "Minor Release",
+				ReleaseDate:           "2018-01-01",
+				EULASlug:              "banana-eula",
+				ReleaseNotesURL:       "https://example.com/notes",
+				EndOfSupportDate:      "2019-01-01",
+				EndOfGuidanceDate:     "2019-06-01",
+				EndOfAvailabilityDate: "2020-01-01",
+			}
+		})
+
+		It("accepts a valid config", func() {
+			Expect(v.Release(config)).To(Succeed())
+		})
+
+		It("accepts a config without dates", func() {
+			config.ReleaseDate = ""
+			config.EndOfSupportDate = ""
+			config.EndOfGuidanceDate = ""
+			config.EndOfAvailabilityDate = ""
+
+			Expect(v.Release(config)).To(Succeed())
+		})
+
+		It("reports every problem at once", func() {
+			config = pivnet.CreateReleaseConfig{
+				ReleaseDate:     "01/02/2018",
+				ReleaseNotesURL: "example.com/notes",
+			}
+
+			err := v.Release(config)
+			Expect(problems(err)).To(Equal([]string{
+				"ProductSlug is required",
+				"Version is required",
+				"ReleaseType is required",
+				"EULASlug is required",
+				`ReleaseNotesURL "example.com/notes" is not an http or https URL`,
+				`ReleaseDate "01/02/2018" is not a date like 2006-01-02`,
+			}))
+			Expect(err).To(MatchError(HavePrefix("invalid release: ProductSlug is required; Version is required; ")))
+		})
+
+		It("requires the end dates to come in order", func() {
+			config.EndOfSupportDate = "2017-12-01"
+			config.EndOfGuidanceDate = "2020-06-01"
+
+			Expect(problems(v.Release(config))).To(Equal([]string{
+				"EndOfSupportDate is before ReleaseDate",
+				"EndOfAvailabilityDate is before EndOfGuidanceDate",
+			}))
+		})
+
+		It("compares end dates that are set, skipping those that are not", func() {
+			config.EndOfGuidanceDate = ""
+			config.EndOfAvailabilityDate = "2018-06-01"
+
+			Expect(problems(v.Release(config))).To(Equal([]string{
+				"EndOfAvailabilityDate is before EndOfSupportDate",
+			}))
+		})
+
+		It("checks release types and EULAs when they are known", func() {
+			v.ReleaseTypes = []string{"Major Release", "Minor Release"}
+			v.EULASlugs = []string{"pivotal_software_eula"}
+			config.ReleaseType = "Patch Release"
+
+			Expect(problems(v.Release(config))).To(Equal([]string{
+				`ReleaseType "Patch Release" is not one of Major Release, Minor Release`,
+				`EULASlug "banana-eula" is not one of pivotal_software_eula`,
+			}))
+		})
+	})
+
+	Describe("ProductFile", func() {
+		var config pivnet.CreateProductFileConfig
+
+		BeforeEach(func() {
+			config = pivnet.CreateProductFileConfig{
+				ProductSlug:  "banana",
+				AWSObjectKey: "product-files/banana/banana-1.2.3.pivotal",
+				Name:         "Banana Tile",
+				FileVersion:  "1.2.3",
+				FileType:     pivnet.FileTypeSoftware,
+				SHA256:       strings.Repeat("a", 64),
+				MD5:          strings.Repeat("B", 32),
+				DocsURL:      "https://example.com/docs",
+				ReleasedAt:   "2018-01-01",
+			}
+		})
+
+		It("accepts a valid config", func() {
+			Expect(v.ProductFile(config)).To(Succeed())
+		})
+
+		It("accepts a config without checksums", func() {
+			config.SHA256 = ""
+			config.MD5 = ""
+
+			Expect(v.ProductFile(config)).To(Succeed())
+		})
+
+		It("reports every problem at once", func() {
+			config = pivnet.CreateProductFileConfig{
+				FileType:   "Binary",
+				SHA256:     "abc",
+				MD5:        strings.Repeat("z", 32),
+				DocsURL:    "ftp://example.com/docs",
+				ReleasedAt: "yesterday",
+			}
+
+			err := v.ProductFile(config)
+			Expect(problems(err)).To(Equal([]string{
+				"ProductSlug is required",
+				"AWSObjectKey is required",
+				"Name is required",
+				"FileVersion is required",
+				`FileType "Binary" is not one of Software, Documentation, Open Source License`,
+				"SHA256 is not 64 hexadecimal digits",
+				"MD5 is not 32 hexadecimal digits",
+				`DocsURL "ftp://example.com/docs" is not an http or https URL`,
+				`ReleasedAt "yesterday" is not a date like 2006-01-02`,
+			}))
+			Expect(err).To(MatchError(HavePrefix("invalid product file: ")))
+		})
+	})
+
+	Describe("New", func() {
+		var server *pivnettest.Server
+
+		BeforeEach(func() {
+			server = pivnettest.NewServer()
+			server.SetReleaseTypes("Major Release", "Minor Release")
+			server.AddEULA(pivnet.EULA{Slug: "banana-eula"})
+			server.AddEULA(pivnet.EULA{Slug: "pivotal_software_eula"})
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("looks up release types and EULAs", func() {
+			client := pivnet.NewClient(server.ClientConfig(), &loggerfakes.FakeLogger{})
+
+			v, err := validation.New(client)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(v.ReleaseTypes).To(Equal([]string{"Major Release", "Minor Release"}))
+			Expect(v.EULASlugs).To(Equal([]string{"banana-eula", "pivotal_software_eula"}))
+
+			err = v.Release(pivnet.CreateReleaseConfig{
+				ProductSlug: "banana",
+				Version:     "1.2.3",
+				ReleaseType: "Beta Release",
+				EULASlug:    "banana-eula",
+			})
+			Expect(problems(err)).To(Equal([]string{
+				`ReleaseType "Beta Release" is not one of Major Release, Minor Release`,
+			}))
+		})
+
+		It("returns errors from Pivotal Network", func() {
+			config := server.ClientConfig()
+			config.Token = "wrong-token"
+			client := pivnet.NewClient(config, &loggerfakes.FakeLogger{})
+
+			_, err := validation.New(client)
+			Expect(err).To(BeAssignableToTypeOf(pivnet.ErrUnauthorized{}))
+		})
+	})
+})